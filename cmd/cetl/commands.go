@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+func cmdCat(ctx context.Context, e *env, args []string) error {
+	var (
+		in     inputFlags
+		out    outputFlags
+		source bool
+	)
+	fs := newFlagSet(e, "cat", "[spec ...]")
+	in.register(fs)
+	out.register(fs, "")
+	fs.BoolVar(&source, "source", false, "prepend _source and _offset columns with the provenance of each record")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	recs, err := in.open(ctx, e, fs.Args())
+	if err != nil {
+		return err
+	}
+	var it transform.RecordIterator = recs
+	if source {
+		it = &sourceIterator{RecordIterator: recs}
+	}
+	return out.encode(ctx, e, &in, it)
+}
+
+func cmdHead(ctx context.Context, e *env, args []string) error {
+	var (
+		in  inputFlags
+		out outputFlags
+		n   int
+	)
+	fs := newFlagSet(e, "head", "[spec ...]")
+	in.register(fs)
+	out.register(fs, "")
+	fs.IntVar(&n, "n", 10, "number of records to print")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if n < 0 {
+		return usageError{fmt.Sprintf("invalid -n %d", n)}
+	}
+	recs, err := in.open(ctx, e, fs.Args())
+	if err != nil {
+		return err
+	}
+	return out.encode(ctx, e, &in, &limitIterator{RecordIterator: recs, left: n})
+}
+
+func cmdCount(ctx context.Context, e *env, args []string) error {
+	var (
+		in       inputFlags
+		bySource bool
+	)
+	fs := newFlagSet(e, "count", "[spec ...]")
+	in.register(fs)
+	fs.BoolVar(&bySource, "by-source", false, "print one tab-separated count per source")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	recs, err := in.open(ctx, e, fs.Args())
+	if err != nil {
+		return err
+	}
+	defer recs.Close()
+	var (
+		total  int64
+		counts = map[string]int64{}
+		order  []string
+	)
+	for recs.Next() {
+		total++
+		if !bySource {
+			continue
+		}
+		name := recs.Record().Meta().Name
+		if _, ok := counts[name]; !ok {
+			order = append(order, name)
+		}
+		counts[name]++
+	}
+	if err := recs.Err(); err != nil {
+		return err
+	}
+	if !bySource {
+		fmt.Fprintln(e.stdout, total)
+		return nil
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 8, 2, ' ', 0)
+	for _, name := range order {
+		fmt.Fprintf(tw, "%s\t%d\n", name, counts[name])
+	}
+	fmt.Fprintf(tw, "total\t%d\n", total)
+	return tw.Flush()
+}
+
+func cmdConvert(ctx context.Context, e *env, args []string) error {
+	var (
+		in  inputFlags
+		out outputFlags
+	)
+	fs := newFlagSet(e, "convert", "-to format [spec ...]")
+	in.register(fs)
+	out.register(fs, "")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if out.to == "" {
+		return usageError{"-to is required"}
+	}
+	recs, err := in.open(ctx, e, fs.Args())
+	if err != nil {
+		return err
+	}
+	return out.encode(ctx, e, &in, recs)
+}
+
+func cmdSchema(ctx context.Context, e *env, args []string) error {
+	var in inputFlags
+	fs := newFlagSet(e, "schema", "[spec ...]")
+	in.register(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	recs, err := in.open(ctx, e, fs.Args())
+	if err != nil {
+		return err
+	}
+	defer recs.Close()
+	type source struct {
+		name    string
+		records int64
+		columns string
+	}
+	var sources []*source
+	for recs.Next() {
+		rec := recs.Record()
+		name := rec.Meta().Name
+		if len(sources) == 0 || sources[len(sources)-1].name != name {
+			s := &source{name: name}
+			if names := rec.Names(); len(names) > 0 {
+				s.columns = strings.Join(names, ",")
+			} else {
+				s.columns = fmt.Sprintf("(%d unnamed fields)", rec.Len())
+			}
+			sources = append(sources, s)
+		}
+		sources[len(sources)-1].records++
+	}
+	if err := recs.Err(); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tRECORDS\tCOLUMNS")
+	for _, s := range sources {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", s.name, s.records, s.columns)
+	}
+	return tw.Flush()
+}
+
+func cmdValidate(ctx context.Context, e *env, args []string) error {
+	var (
+		in          inputFlags
+		required    string
+		maxProblems int
+	)
+	fs := newFlagSet(e, "validate", "[spec ...]")
+	in.register(fs)
+	fs.StringVar(&required, "required", "", "comma-separated columns that must be present and non-empty")
+	fs.IntVar(&maxProblems, "max-problems", 20, "stop reporting after this many problems (0 for no limit)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	var columns []string
+	for _, c := range strings.Split(required, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			columns = append(columns, c)
+		}
+	}
+	recs, err := in.open(ctx, e, fs.Args())
+	if err != nil {
+		return err
+	}
+	defer recs.Close()
+
+	var checked, problems int64
+	report := func(format string, args ...any) {
+		problems++
+		if maxProblems == 0 || problems <= int64(maxProblems) {
+			fmt.Fprintf(e.stderr, format+"\n", args...)
+		}
+	}
+	for recs.Next() {
+		checked++
+		rec := recs.Record()
+		for _, c := range columns {
+			if v, ok := rec.ByName(c); !ok || v == "" {
+				m := rec.Meta()
+				report("%s@%d: column %q is empty", m.Name, m.ByteOffset, c)
+			}
+		}
+	}
+	if err := recs.Err(); err != nil {
+		report("%v", err)
+	}
+	if maxProblems > 0 && problems > int64(maxProblems) {
+		fmt.Fprintf(e.stderr, "... %d more problems\n", problems-int64(maxProblems))
+	}
+	fmt.Fprintf(e.stdout, "checked %d records: %d problems\n", checked, problems)
+	if problems > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// limitIterator stops after left records.
+type limitIterator struct {
+	transform.RecordIterator
+	left int
+}
+
+func (l *limitIterator) Next() bool {
+	if l.left <= 0 {
+		return false
+	}
+	l.left--
+	return l.RecordIterator.Next()
+}
+
+// sourceIterator prepends the provenance of each record as two columns.
+type sourceIterator struct {
+	transform.RecordIterator
+	rec sourceRecord
+}
+
+func (s *sourceIterator) Record() transform.Extractor {
+	s.rec.Extractor = s.RecordIterator.Record()
+	return &s.rec
+}
+
+// sourceRecord is a record with _source and _offset columns in front of
+// its own.
+type sourceRecord struct {
+	transform.Extractor
+}
+
+func (r *sourceRecord) ByIndex(i int) (string, bool) {
+	switch i {
+	case 0:
+		return r.Meta().Name, true
+	case 1:
+		return strconv.FormatInt(r.Meta().ByteOffset, 10), true
+	}
+	return r.Extractor.ByIndex(i - 2)
+}
+
+func (r *sourceRecord) ByName(name string) (string, bool) {
+	switch name {
+	case "_source":
+		return r.ByIndex(0)
+	case "_offset":
+		return r.ByIndex(1)
+	}
+	return r.Extractor.ByName(name)
+}
+
+func (r *sourceRecord) Len() int { return r.Extractor.Len() + 2 }
+
+func (r *sourceRecord) Names() []string {
+	names := r.Extractor.Names()
+	if len(names) == 0 {
+		return nil
+	}
+	return append([]string{"_source", "_offset"}, names...)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/opener"
+	"github.com/carlodf/cetl/transform"
+)
+
+// inputFlags selects how the specs of a command are opened and decoded.
+type inputFlags struct {
+	format   string
+	comma    string
+	noHeader bool
+	sniff    bool
+	encoding string
+}
+
+func (f *inputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "from", "csv", "input format: csv, psv, tsv, lines or avro")
+	fs.StringVar(&f.format, "format", "csv", "same as -from")
+	fs.StringVar(&f.comma, "comma", "", `input field delimiter, overriding the format's ("tab" for \t)`)
+	fs.BoolVar(&f.noHeader, "no-header", false, "input has no header row; columns are named col0, col1, ...")
+	fs.BoolVar(&f.sniff, "sniff", false, "detect the delimiter and quoting of each CSV source")
+	fs.StringVar(&f.encoding, "encoding", "", "input text encoding, e.g. utf-16le or windows-1252 (default UTF-8)")
+}
+
+// isCSV reports whether format belongs to the CSV family.
+func isCSV(format string) bool {
+	return format == "csv" || format == "psv" || format == "tsv"
+}
+
+// formatComma returns the delimiter of a CSV-family format.
+func formatComma(format string) rune {
+	switch format {
+	case "psv":
+		return '|'
+	case "tsv":
+		return '\t'
+	}
+	return ','
+}
+
+// parseComma parses a -comma flag value.
+func parseComma(s string) (rune, error) {
+	switch s {
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, usageError{fmt.Sprintf("invalid delimiter %q", s)}
+	}
+	return r, nil
+}
+
+// decoder returns the Decoder selected by the flags.
+func (f *inputFlags) decoder() (transform.Decoder, error) {
+	switch {
+	case isCSV(f.format):
+		opt := transform.CSVDecoderOptions{
+			Comma:    formatComma(f.format),
+			NoHeader: f.noHeader,
+			Sniff:    f.sniff,
+		}
+		if f.comma != "" {
+			c, err := parseComma(f.comma)
+			if err != nil {
+				return nil, err
+			}
+			opt.Comma = c
+		}
+		return transform.NewCSVDecoder(opt), nil
+	case f.format == "lines":
+		return transform.NewLineDecoder(transform.LineDecoderOptions{}), nil
+	case f.format == "avro":
+		return transform.NewAvroDecoder(), nil
+	}
+	return nil, usageError{fmt.Sprintf("unknown input format %q", f.format)}
+}
+
+// openers resolves specs into openers; "-" and an empty spec list read
+// stdin.
+func (f *inputFlags) openers(e *env, specs []string) ([]opener.Opener, error) {
+	if len(specs) == 0 {
+		specs = []string{"-"}
+	}
+	var ops []opener.Opener
+	for _, spec := range specs {
+		if spec == "-" {
+			ops = append(ops, stdinOpener{r: e.stdin})
+			continue
+		}
+		found, err := opener.OpenerFromSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%s: no such file", spec)
+		}
+		ops = append(ops, found...)
+	}
+	if f.encoding != "" {
+		if f.format == "avro" {
+			return nil, usageError{"-encoding does not apply to avro input"}
+		}
+		enc, err := opener.ParseEncoding(f.encoding)
+		if err != nil {
+			return nil, usageError{err.Error()}
+		}
+		ops = opener.TranscodeAll(ops, enc)
+	}
+	return ops, nil
+}
+
+// records is an open input: the decoded records of all specs, read as one
+// stream.
+type records struct {
+	transform.RecordIterator
+	mux connector.SrcAwareStreamer
+	// last is the SrcMeta of the last record returned, for locate.
+	last connector.SrcMeta
+}
+
+// open decodes the sources of specs.
+func (f *inputFlags) open(ctx context.Context, e *env, specs []string) (*records, error) {
+	dec, err := f.decoder()
+	if err != nil {
+		return nil, err
+	}
+	ops, err := f.openers(e, specs)
+	if err != nil {
+		return nil, err
+	}
+	mux := connector.NewMuxReader(ctx, ops)
+	it, err := dec.Decode(ctx, mux)
+	if err != nil {
+		mux.Close()
+		return nil, locate(mux, connector.SrcMeta{}, err)
+	}
+	return &records{RecordIterator: it, mux: mux}, nil
+}
+
+// Next advances the iterator, remembering where the record came from.
+func (r *records) Next() bool {
+	if !r.RecordIterator.Next() {
+		return false
+	}
+	r.last = r.Record().Meta()
+	return true
+}
+
+// Err returns the error of the iterator, prefixed with the source being
+// decoded and an offset in it.
+func (r *records) Err() error {
+	err := r.RecordIterator.Err()
+	if err == nil {
+		return nil
+	}
+	return locate(r.mux, r.last, err)
+}
+
+// Close closes the iterator and the stream.
+func (r *records) Close() error {
+	err := r.RecordIterator.Close()
+	if cerr := r.mux.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// locate prefixes err with name@offset of the source mux is reading,
+// unless err is a *connector.SourceError, as open and read errors are,
+// which already names its source. The offset of mux is where it has read
+// ahead to, so the offset is the start of last, the last record decoded,
+// when it comes from the same source, and 0 otherwise: the failure lies at
+// or after it. CSV parse errors also give their line in the source.
+func locate(mux connector.SrcAwareStreamer, last connector.SrcMeta, err error) error {
+	var serr *connector.SourceError
+	if errors.As(err, &serr) {
+		return err
+	}
+	m := mux.Current()
+	if m.Name == "" {
+		return err
+	}
+	var offset int64
+	if last.Name == m.Name {
+		offset = last.ByteOffset
+	}
+	return fmt.Errorf("%s@%d: %w", m.Name, offset, err)
+}
+
+// stdinOpener reads the standard input of a run.
+type stdinOpener struct{ r io.Reader }
+
+func (s stdinOpener) Open(context.Context) (io.ReadCloser, error) { return io.NopCloser(s.r), nil }
+
+func (stdinOpener) Name() string { return "<stdin>" }
+
+// outputFlags selects how a command writes records.
+type outputFlags struct {
+	to       string
+	comma    string
+	noHeader bool
+	out      string
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet, to string) {
+	fs.StringVar(&f.to, "to", to, "output format: csv, psv, tsv or jsonl")
+	fs.StringVar(&f.comma, "out-comma", "", `output field delimiter, overriding the format's ("tab" for \t)`)
+	fs.BoolVar(&f.noHeader, "out-no-header", false, "omit the header row of CSV output")
+	fs.StringVar(&f.out, "o", "", "write to this file instead of stdout")
+}
+
+// encoder returns the Encoder selected by the flags. An empty -to follows
+// the input format: the same CSV dialect, or JSON Lines for other formats.
+func (f *outputFlags) encoder(in *inputFlags) (transform.Encoder, error) {
+	to := f.to
+	if to == "" {
+		to = "jsonl"
+		if isCSV(in.format) {
+			to = in.format
+		}
+	}
+	switch {
+	case to == "jsonl":
+		return transform.NewJSONLEncoder(), nil
+	case isCSV(to):
+		opt := transform.CSVEncoderOptions{Comma: formatComma(to), NoHeader: f.noHeader}
+		if f.comma != "" {
+			c, err := parseComma(f.comma)
+			if err != nil {
+				return nil, err
+			}
+			opt.Comma = c
+		}
+		return transform.NewCSVEncoder(opt), nil
+	}
+	return nil, usageError{fmt.Sprintf("unknown output format %q", to)}
+}
+
+// encode writes it with the encoder selected by the flags, to -o or stdout.
+// It closes it. A partially written -o file is removed on failure.
+func (f *outputFlags) encode(ctx context.Context, e *env, in *inputFlags, it transform.RecordIterator) error {
+	enc, err := f.encoder(in)
+	if err != nil {
+		it.Close()
+		return err
+	}
+	if f.out == "" {
+		_, err := enc.Encode(ctx, e.stdout, it)
+		return err
+	}
+	file, err := os.Create(f.out)
+	if err != nil {
+		it.Close()
+		return err
+	}
+	_, err = enc.Encode(ctx, file, it)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.out)
+	}
+	return err
+}
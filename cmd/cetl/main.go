@@ -0,0 +1,155 @@
+// Command cetl inspects and converts data files from the shell with the
+// cetl packages.
+//
+// Usage:
+//
+//	cetl <command> [flags] [spec ...]
+//
+// The commands are:
+//
+//	cat       print records, optionally with their source and byte offset
+//	head      print the first records
+//	count     count records, in total or per source
+//	convert   convert records to another format
+//	schema    list the columns and record counts of each source
+//	validate  decode every record and check required columns
+//
+// Specs are resolved with opener.OpenerFromSpec: paths, globs and file://
+// URLs; the sources of all specs are read as one stream. With no spec, or
+// with "-", cetl reads stdin. Output goes to stdout unless -o is given.
+//
+// Flags must come before the specs. Run "cetl <command> -h" for the flags
+// of a command.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/carlodf/cetl/opener"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// env holds the standard streams of a run.
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{"cat", "print records, optionally with their source and byte offset", cmdCat},
+	{"head", "print the first records", cmdHead},
+	{"count", "count records, in total or per source", cmdCount},
+	{"convert", "convert records to another format", cmdConvert},
+	{"schema", "list the columns and record counts of each source", cmdSchema},
+	{"validate", "decode every record and check required columns", cmdValidate},
+}
+
+// errFailed and errUsage report a failure and an invalid command line
+// already described on stderr; cetl exits with status 1 and 2.
+var (
+	errFailed = errors.New("failed")
+	errUsage  = errors.New("invalid usage")
+)
+
+// usageError is an invalid command line; cetl exits with status 2.
+type usageError struct{ msg string }
+
+func (u usageError) Error() string { return u.msg }
+
+var registerOnce sync.Once
+
+// run executes the command line args and returns the exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	registerOnce.Do(func() {
+		_ = opener.RegisterOpener("file", opener.RegularFileOpenerFactory)
+	})
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(ctx, e, args[1:])
+		var uerr usageError
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.As(err, &uerr):
+			fmt.Fprintf(stderr, "cetl %s: %v\n", c.name, err)
+			return 2
+		case errors.Is(err, errFailed):
+			return 1
+		case errors.Is(err, errUsage):
+			return 2
+		default:
+			fmt.Fprintf(stderr, "cetl %s: %v\n", c.name, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(stderr, "cetl: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: cetl <command> [flags] [spec ...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Specs are paths, globs or file:// URLs; "-" or no spec reads stdin.`)
+	fmt.Fprintln(w, `Run "cetl <command> -h" for the flags of a command.`)
+}
+
+// newFlagSet returns a FlagSet for command name that reports errors
+// instead of exiting.
+func newFlagSet(e *env, name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: cetl %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args with fs, turning parse errors into usage errors.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		// The FlagSet has already printed the error and usage.
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+)
+
+// runCLI runs cetl with args and stdin, returning its exit status and
+// output.
+func runCLI(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut strings.Builder
+	code = run(context.Background(), args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// writeFiles writes name → content files in a temporary directory and
+// returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.csv":     "id,name\n1,ann\n2,bob\n",
+		"b.csv":     "id,name\n3,\n",
+		"bad.csv":   "id,name\n4,dan\n5,\"eve\n",
+		"short.csv": "id,name\n6,fay\n77,gil\n8\n",
+	})
+	a, b, bad := filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv"), filepath.Join(dir, "bad.csv")
+	short := filepath.Join(dir, "short.csv")
+	if err := os.Mkdir(filepath.Join(dir, "dir.csv"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		stdin      string
+		args       []string
+		wantCode   int
+		wantOut    string
+		wantStderr string
+	}{
+		{
+			name:    "convert csv to jsonl",
+			args:    []string{"convert", "-to", "jsonl", a, b},
+			wantOut: `{"id":"1","name":"ann"}` + "\n" + `{"id":"2","name":"bob"}` + "\n" + `{"id":"3","name":""}` + "\n",
+		},
+		{
+			name:    "convert from csv to jsonl",
+			args:    []string{"convert", "--from", "csv", "--to", "jsonl", b},
+			wantOut: `{"id":"3","name":""}` + "\n",
+		},
+		{
+			name:    "convert psv stdin to tsv",
+			stdin:   "id|note\n1|a,b\n",
+			args:    []string{"convert", "-format", "psv", "-to", "tsv"},
+			wantOut: "id\tnote\n1\ta,b\n",
+		},
+		{
+			name:    "head from stdin",
+			stdin:   "x,y\n1,2\n3,4\n5,6\n",
+			args:    []string{"head", "-n", "2", "-"},
+			wantOut: "x,y\n1,2\n3,4\n",
+		},
+		{
+			name:    "lines default to jsonl",
+			stdin:   "first\nsecond\n",
+			args:    []string{"cat", "-format", "lines"},
+			wantOut: `{"line":"first"}` + "\n" + `{"line":"second"}` + "\n",
+		},
+		{
+			name:    "cat with source",
+			args:    []string{"cat", "-source", "-to", "csv", b},
+			wantOut: "_source,_offset,id,name\n" + b + ",8,3,\n",
+		},
+		{
+			name:    "count",
+			args:    []string{"count", a, b},
+			wantOut: "3\n",
+		},
+		{
+			name:    "count by source",
+			args:    []string{"count", "-by-source", a, b},
+			wantOut: a + "  2\n" + b + "  1\ntotal" + strings.Repeat(" ", len(a)-3) + "3\n",
+		},
+		{
+			name:    "schema",
+			stdin:   "1,2,3\n",
+			args:    []string{"schema", "-no-header"},
+			wantOut: "SOURCE   RECORDS  COLUMNS\n<stdin>  1        col0,col1,col2\n",
+		},
+		{
+			name:    "validate passes",
+			args:    []string{"validate", "-required", "id", a, b},
+			wantOut: "checked 3 records: 0 problems\n",
+		},
+		{
+			name:       "validate reports problems",
+			args:       []string{"validate", "-required", "id, name", a, b},
+			wantCode:   1,
+			wantOut:    "checked 3 records: 1 problems\n",
+			wantStderr: b + `@8: column "name" is empty` + "\n",
+		},
+		{
+			name:       "convert requires -to",
+			args:       []string{"convert", a},
+			wantCode:   2,
+			wantStderr: "cetl convert: -to is required\n",
+		},
+		{
+			name:       "unknown format",
+			args:       []string{"cat", "-format", "xml", a},
+			wantCode:   2,
+			wantStderr: "cetl cat: unknown input format \"xml\"\n",
+		},
+		{
+			name:       "missing file",
+			args:       []string{"count", filepath.Join(dir, "missing.csv")},
+			wantCode:   1,
+			wantStderr: "missing.csv",
+		},
+		{
+			name:       "parse error names its source, offset and line",
+			args:       []string{"count", a, bad},
+			wantCode:   1,
+			wantStderr: "cetl count: " + bad + "@8: parse error on line 3, column 8: extraneous or missing \" in quoted-field\n",
+		},
+		{
+			name:       "malformed second source names its source and offset",
+			args:       []string{"convert", "-to", "jsonl", a, short},
+			wantCode:   1,
+			wantStderr: "cetl convert: " + short + "@14: record on line 4: wrong number of fields\n",
+		},
+		{
+			name:       "read error of a later source",
+			args:       []string{"count", a, filepath.Join(dir, "dir.csv")},
+			wantCode:   1,
+			wantStderr: "cetl count: read " + filepath.Join(dir, "dir.csv") + ": ",
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"frobnicate"},
+			wantCode:   2,
+			wantStderr: "cetl: unknown command \"frobnicate\"\n",
+		},
+		{
+			name:       "bad flag",
+			args:       []string{"head", "-x"},
+			wantCode:   2,
+			wantStderr: "flag provided but not defined: -x",
+		},
+	}
+	for _, tc := range cases {
+		code, out, errOut := runCLI(t, tc.stdin, tc.args...)
+		if code != tc.wantCode {
+			t.Errorf("%s: exit %d, want %d (stderr %q)", tc.name, code, tc.wantCode, errOut)
+			continue
+		}
+		if tc.wantOut != "" || code == 0 {
+			if out != tc.wantOut {
+				t.Errorf("%s: stdout\ngot  %q\nwant %q", tc.name, out, tc.wantOut)
+			}
+		}
+		if !strings.Contains(errOut, tc.wantStderr) {
+			t.Errorf("%s: stderr %q does not contain %q", tc.name, errOut, tc.wantStderr)
+		}
+	}
+}
+
+func TestRun_OutputFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.tsv": "a\tb\n1\t2\n"})
+	out := filepath.Join(dir, "out.csv")
+	code, stdout, stderr := runCLI(t, "", "convert", "-format", "tsv", "-to", "csv", "-o", out, filepath.Join(dir, "in.tsv"))
+	if code != 0 || stdout != "" {
+		t.Fatalf("exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil || string(got) != "a,b\n1,2\n" {
+		t.Fatalf("output %q, %v", got, err)
+	}
+}
+
+// stubMux reports a fixed current source.
+type stubMux struct {
+	connector.SrcAwareStreamer
+	cur connector.SrcMeta
+}
+
+func (s stubMux) Current() connector.SrcMeta { return s.cur }
+
+func TestLocate(t *testing.T) {
+	mux := stubMux{cur: connector.SrcMeta{Name: "a.csv", ByteOffset: 99}}
+	readErr := &connector.SourceError{Op: "read", Source: "data.csv", Err: errors.New("boom")}
+	cases := []struct {
+		last connector.SrcMeta
+		err  error
+		want string
+	}{
+		// The message mentioning a source name does not make it located.
+		{connector.SrcMeta{Name: "a.csv", ByteOffset: 12}, errors.New(`value "a.csv" rejected`), `a.csv@12: value "a.csv" rejected`},
+		{connector.SrcMeta{Name: "b.csv", ByteOffset: 12}, errors.New("bad record"), "a.csv@0: bad record"},
+		{connector.SrcMeta{}, readErr, "read data.csv: boom"},
+		{connector.SrcMeta{}, fmt.Errorf("decode: %w", readErr), "decode: read data.csv: boom"},
+	}
+	for _, tc := range cases {
+		got := locate(mux, tc.last, tc.err)
+		if got.Error() != tc.want || !errors.Is(got, tc.err) {
+			t.Errorf("locate(%v, %q) = %q, want %q", tc.last, tc.err, got, tc.want)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package connector
 
 import (
+	"bytes"
 	"context"
-	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/carlodf/cetl/metrics"
 	"github.com/carlodf/cetl/opener"
 )
 
@@ -21,7 +24,10 @@ import (
 //     returned to the caller of Read.
 //
 // Boundary and position tracking:
-//   - Current() returns a snapshot of the current source name and byte offset.
+//   - Current() returns a snapshot of the source name and byte offset of the
+//     last bytes returned by Read. A single Read never returns bytes from two
+//     different sources, so Current() observed right after Read exactly
+//     describes the bytes just delivered.
 //   - AwaitBoundary(ctx) blocks until the next source becomes active, returning
 //     its metadata with ByteOffset==0.
 //   - The boundary channel is coalesced (buffer=1): if multiple boundaries occur
@@ -36,19 +42,118 @@ type muxReader struct {
 	pw *io.PipeWriter
 
 	// current holds the latest SrcMeta snapshot.
-	// Only the multiplexer goroutine writes; readers call Current().
+	// Only Read writes; any goroutine may call Current().
 	current atomic.Value
 
+	// chunksMu guards chunks.
+	chunksMu sync.Mutex
+	// chunks records, in write order, the provenance of every chunk
+	// written to the pipe that has not been fully read yet.
+	chunks []chunkMeta
+	// started reports whether the last Read returned the first bytes of a
+	// source. Guarded by chunksMu.
+	started bool
+
 	// boundary communicates source-change events.
 	// Buffered size is 1 to coalesce boundaries when the caller
 	// is not polling AwaitBoundary().
 	boundary chan SrcMeta
 }
 
+// chunkMeta describes a chunk written to the pipe: the source it comes from,
+// with ByteOffset set to the source offset of the next unread byte, and the
+// number of bytes of the chunk still to be read.
+type chunkMeta struct {
+	meta      SrcMeta
+	remaining int
+	// filler marks an injected source separator. Its bytes are attributed
+	// to the source they terminate but do not advance its ByteOffset.
+	filler bool
+}
+
+// MuxOption configures a multiplexer built by NewMuxReader.
+type MuxOption func(*muxOptions)
+
+// WithSourceSeparator makes the multiplexer write sep between two sources
+// when the bytes of the first do not already end with sep, so that the last
+// line of a file lacking a final newline is not glued to the first line of
+// the next one.
+//
+// The separator is reported as part of the source it terminates, and its
+// bytes do not count towards that source's SrcMeta.ByteOffset. Nothing is
+// written after the last source or around sources that produce no bytes.
+func WithSourceSeparator(sep []byte) MuxOption {
+	return func(o *muxOptions) {
+		o.separator = bytes.Clone(sep)
+	}
+}
+
+// WithHooks makes the multiplexer report to hooks the open latency and
+// bytes read of every source, as opener.Instrument does, and the time it
+// spends blocked writing to its pipe until the reader consumes the bytes.
+func WithHooks(hooks *metrics.Hooks) MuxOption {
+	return func(o *muxOptions) {
+		o.hooks = hooks
+	}
+}
+
+type muxOptions struct {
+	// separator is written between sources; see WithSourceSeparator.
+	separator []byte
+	// hooks receive the metrics of the run; see WithHooks.
+	hooks *metrics.Hooks
+}
+
 // Read proxies reads to the underlying io.PipeReader.
 // Callers read a continuous byte stream representing all multiplexed sources.
+//
+// After Read returns n > 0 bytes, Current() reports the source those bytes
+// belong to and the source offset just past them.
 func (m *muxReader) Read(p []byte) (int, error) {
-	return m.pr.Read(p)
+	n, err := m.pr.Read(p)
+	if n > 0 {
+		m.advance(n)
+	}
+	return n, err
+}
+
+// pushChunk records the provenance of a chunk before it is written to the
+// pipe, so that Read can attribute the bytes it returns.
+func (m *muxReader) pushChunk(meta SrcMeta, n int, filler bool) {
+	m.chunksMu.Lock()
+	m.chunks = append(m.chunks, chunkMeta{meta: meta, remaining: n, filler: filler})
+	m.chunksMu.Unlock()
+}
+
+// advance accounts for n bytes returned by the pipe. io.Pipe never returns
+// bytes from two writes in one Read, so the bytes belong to the oldest
+// pending chunk.
+func (m *muxReader) advance(n int) {
+	m.chunksMu.Lock()
+	defer m.chunksMu.Unlock()
+	if len(m.chunks) == 0 {
+		return
+	}
+	head := &m.chunks[0]
+	m.started = !head.filler && head.meta.ByteOffset == 0
+	if !head.filler {
+		head.meta.ByteOffset += int64(n)
+	}
+	head.remaining -= n
+	m.current.Store(head.meta)
+	if head.remaining <= 0 {
+		m.chunks[0] = chunkMeta{}
+		m.chunks = m.chunks[1:]
+	}
+}
+
+// startsSource reports whether the bytes returned by the last Read are the
+// first bytes of a source. It lets a Segmenter tell a new source apart from
+// an injected separator, which does not advance ByteOffset.
+func (m *muxReader) startsSource() bool {
+	m.chunksMu.Lock()
+	defer m.chunksMu.Unlock()
+	return m.started
 }
 
 // Close closes the read side of the multiplexer.
@@ -58,8 +163,8 @@ func (m *muxReader) Close() error {
 	return m.pr.Close()
 }
 
-// Current returns the most recent SrcMeta snapshot describing the active
-// source and the byte offset within that source.
+// Current returns the most recent SrcMeta snapshot describing the source of
+// the last bytes returned by Read and the byte offset within that source.
 //
 // This is non-blocking and safe to call concurrently with Read and
 // AwaitBoundary.
@@ -101,7 +206,14 @@ func (m *muxReader) AwaitBoundary(ctx context.Context) (SrcMeta, error) {
 //   - io.ReadCloser via Read and Close
 //   - Current() position tracking
 //   - AwaitBoundary() source-change notifications
-func NewMuxReader(ctx context.Context, ops []opener.Opener) SrcAwareStreamer {
+//
+// Options such as WithSourceSeparator adjust how sources are joined, and
+// WithHooks instruments the multiplexer.
+func NewMuxReader(ctx context.Context, ops []opener.Opener, opts ...MuxOption) SrcAwareStreamer {
+	var o muxOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	pr, pw := io.Pipe()
 	m := &muxReader{
 		pr:       pr,
@@ -116,6 +228,10 @@ func NewMuxReader(ctx context.Context, ops []opener.Opener) SrcAwareStreamer {
 		}()
 
 		buf := make([]byte, 32*1024)
+		// prev is the position at the end of the last source that produced
+		// bytes, and tail holds its last bytes, up to len(o.separator).
+		var prev SrcMeta
+		var tail []byte
 		for _, op := range ops {
 			// Fast exit if already caneled before opening next source.
 			select {
@@ -125,9 +241,10 @@ func NewMuxReader(ctx context.Context, ops []opener.Opener) SrcAwareStreamer {
 			default:
 			}
 
+			op = opener.Instrument(op, o.hooks)
 			rc, err := op.Open(ctx)
 			if err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("open %s: %w", op.Name(), err))
+				_ = pw.CloseWithError(&SourceError{Op: "open", Source: op.Name(), Err: err})
 				return
 			}
 			done := make(chan struct{})
@@ -145,8 +262,6 @@ func NewMuxReader(ctx context.Context, ops []opener.Opener) SrcAwareStreamer {
 				ByteOffset: 0,
 			}
 
-			m.current.Store(meta)
-
 			// Communicate new source if client is awaiting for Boundary
 			// If no client is awayting and channel is full, the channel
 			// is emptied and the latest boudary event is sent.
@@ -166,31 +281,63 @@ func NewMuxReader(ctx context.Context, ops []opener.Opener) SrcAwareStreamer {
 				// If n > 0 write on the Pipe before evaluating error as to
 				// provide partial bytes in case of read error.
 				if n > 0 {
+					if meta.ByteOffset == 0 && len(tail) > 0 && !bytes.HasSuffix(tail, o.separator) {
+						m.pushChunk(prev, len(o.separator), true)
+						if werr := m.write(o.separator, o.hooks); werr != nil {
+							_ = rc.Close()
+							_ = pw.CloseWithError(werr)
+							return
+						}
+					}
+					if meta.ByteOffset == 0 {
+						tail = tail[:0]
+					}
+					m.pushChunk(meta, n, false)
 					// If writing to Pipe close with error and return.
-					if _, werr := m.pw.Write(buf[:n]); werr != nil {
+					if werr := m.write(buf[:n], o.hooks); werr != nil {
 						_ = rc.Close()
 						_ = pw.CloseWithError(werr)
 						return
 					}
 					meta.ByteOffset += int64(n)
-					m.current.Store(meta)
+					if k := len(o.separator); k > 0 {
+						tail = append(tail, buf[:n]...)
+						if len(tail) > k {
+							tail = append(tail[:0], tail[len(tail)-k:]...)
+						}
+					}
 				}
 				if rerr == io.EOF {
 					break
 				}
 				if rerr != nil {
 					rc.Close()
-					_ = pw.CloseWithError(fmt.Errorf("read %s: %w", op.Name(), rerr))
+					_ = pw.CloseWithError(&SourceError{Op: "read", Source: op.Name(), Err: rerr})
 					return
 				}
 			}
 			close(done)
 			_ = rc.Close()
+			if meta.ByteOffset > 0 {
+				prev = meta
+			}
 		}
 	}()
 	return m
 }
 
+// write writes p to the pipe, reporting to hooks the time it blocks.
+func (m *muxReader) write(p []byte, hooks *metrics.Hooks) error {
+	if hooks == nil {
+		_, err := m.pw.Write(p)
+		return err
+	}
+	start := time.Now()
+	_, err := m.pw.Write(p)
+	hooks.Blocked(time.Since(start))
+	return err
+}
+
 // overwriteLatest tries to send v on a 1-buffered channel.
 // If the buffer is full, it drains one stale value and retries.
 // Never blocks indefinitely; guarantees the latest value wins.
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/carlodf/cetl/metrics"
 	"github.com/carlodf/cetl/opener"
 )
 
@@ -215,3 +217,72 @@ func TestMuxReader_BoundaryBuffer_NoDeadlock(t *testing.T) {
 		t.Fatalf("AwaitBoundary after full read err = %v, want io.EOF", berr)
 	}
 }
+
+func TestMuxReader_SourceSeparator(t *testing.T) {
+	ctx := context.Background()
+	ops := []opener.Opener{
+		fakeOpener{name: "a", data: []byte("x"), readErrN: -1},
+		fakeOpener{name: "b", data: []byte("y\n"), readErrN: -1},
+		fakeOpener{name: "empty", data: nil, readErrN: -1},
+		fakeOpener{name: "c", data: []byte("z\r"), readErrN: -1},
+		fakeOpener{name: "d", data: []byte("w"), readErrN: -1},
+	}
+	m := NewMuxReader(ctx, ops, WithSourceSeparator([]byte("\n")))
+	defer m.Close()
+
+	// Read one byte at a time and record where each byte is attributed.
+	var got []string
+	p := make([]byte, 1)
+	for {
+		n, err := m.Read(p)
+		if n > 0 {
+			cur := m.Current()
+			got = append(got, fmt.Sprintf("%q@%s:%d", p[0], cur.Name, cur.ByteOffset))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+	}
+	want := `'x'@a:1,'\n'@a:1,'y'@b:1,'\n'@b:2,'z'@c:1,'\r'@c:2,'\n'@c:2,'w'@d:1`
+	if strings.Join(got, ",") != want {
+		t.Fatalf("bytes = %s\nwant    %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestMuxReader_Hooks(t *testing.T) {
+	run := metrics.NewRun()
+	ops := []opener.Opener{
+		fakeOpener{name: "a", data: []byte("hello\n"), readErrN: -1},
+		fakeOpener{name: "b", data: []byte("world"), readErrN: -1},
+		fakeOpener{name: "c", openErr: errors.New("boom")},
+	}
+	m := NewMuxReader(context.Background(), ops, WithSourceSeparator([]byte("\n")), WithHooks(run.Hooks()))
+	defer m.Close()
+
+	got, err := io.ReadAll(m)
+	if err == nil || string(got) != "hello\nworld" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+	s := run.Snapshot()
+	// Every pipe write waits for a Read, so some time is always recorded.
+	if s.Blocked <= 0 {
+		t.Fatalf("Blocked = %v, want the time the producer waited on Read", s.Blocked)
+	}
+	if s.BytesRead != 11 || s.Opens != 3 || s.OpenErrors != 1 || len(s.Sources) != 3 {
+		t.Fatalf("snapshot = %+v", s)
+	}
+	for i, want := range []metrics.SourceStats{
+		{Name: "a", Opens: 1, BytesRead: 6},
+		{Name: "b", Opens: 1, BytesRead: 5},
+		{Name: "c", Opens: 1, OpenErrors: 1},
+	} {
+		got := s.Sources[i]
+		got.OpenLatency = 0
+		if got != want {
+			t.Fatalf("source %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
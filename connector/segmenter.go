@@ -0,0 +1,186 @@
+package connector
+
+import (
+	"io"
+)
+
+// Segmenter splits a SrcAwareStreamer into one byte segment per source.
+//
+// Decoders that must not let a record straddle two sources (multi-line
+// grouping, per-source headers or dialects, footers, ...) can consume the
+// stream one source at a time:
+//
+//	seg := connector.NewSegmenter(mux)
+//	for seg.Next() {
+//	    name := seg.Meta().Name
+//	    r := bufio.NewReader(seg) // Read returns io.EOF at the end of the source
+//	    ...
+//	}
+//	if err := seg.Err(); err != nil { ... }
+//
+// Segments are detected from Current() after each Read: a chunk whose
+// source name changes, or whose source offset starts again at zero, begins a
+// new segment. Sources that produce no bytes yield no segment. A separator
+// injected by WithSourceSeparator belongs to the segment it terminates.
+//
+// A Segmenter does not own the underlying stream and never closes it. It is
+// not safe for concurrent use.
+type Segmenter struct {
+	s SrcAwareStreamer
+
+	// seg describes the active segment; ByteOffset counts the bytes of the
+	// segment returned by Read so far.
+	seg SrcMeta
+	// active is true once Next has returned true at least once.
+	active bool
+	// segDone is true when the active segment has been fully read.
+	segDone bool
+
+	// pending holds bytes already read from s that have not been returned
+	// by Read yet. They belong to the active segment unless segDone is set,
+	// in which case they are the first bytes of the next one.
+	pending []byte
+	// pendingName is the source name of the bytes in pending.
+	pendingName string
+
+	// eof is true once s returned io.EOF.
+	eof bool
+	// err is the first non-EOF error returned by s.
+	err error
+
+	buf []byte
+}
+
+// NewSegmenter returns a Segmenter reading from s.
+func NewSegmenter(s SrcAwareStreamer) *Segmenter {
+	return &Segmenter{s: s}
+}
+
+// Next discards whatever is left of the active segment and advances to the
+// next source. It returns false when the stream is exhausted or failed; Err
+// distinguishes the two.
+func (g *Segmenter) Next() bool {
+	if g.active {
+		for !g.segDone {
+			if g.buf == nil {
+				g.buf = make([]byte, 32*1024)
+			}
+			if _, err := g.Read(g.buf); err != nil && err != io.EOF {
+				return false
+			}
+		}
+	}
+	if g.err != nil {
+		return false
+	}
+	if len(g.pending) == 0 {
+		if g.eof {
+			return false
+		}
+		if !g.fill() {
+			return false
+		}
+	}
+	g.seg = SrcMeta{Name: g.pendingName}
+	g.active = true
+	g.segDone = false
+	return true
+}
+
+// Meta returns the name of the active source and the number of bytes of it
+// returned by Read so far.
+func (g *Segmenter) Meta() SrcMeta {
+	return g.seg
+}
+
+// Read reads bytes of the active segment. It returns io.EOF once the
+// segment is exhausted, even if more sources follow; call Next to move on.
+func (g *Segmenter) Read(p []byte) (int, error) {
+	if !g.active || g.segDone {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(g.pending) == 0 {
+		if g.err != nil {
+			return 0, g.err
+		}
+		if g.eof {
+			g.segDone = true
+			return 0, io.EOF
+		}
+		if !g.fill() {
+			g.segDone = g.err == nil
+			if g.err != nil {
+				return 0, g.err
+			}
+			return 0, io.EOF
+		}
+		if g.segDone {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, g.pending)
+	g.pending = g.pending[n:]
+	g.seg.ByteOffset += int64(n)
+	return n, nil
+}
+
+// Err returns the first non-EOF error returned by the underlying stream.
+func (g *Segmenter) Err() error {
+	return g.err
+}
+
+// fill reads the next chunk of the underlying stream into pending. If the
+// chunk starts a new source, it marks the active segment as done. It
+// returns false if no bytes could be read.
+func (g *Segmenter) fill() bool {
+	if g.buf == nil {
+		g.buf = make([]byte, 32*1024)
+	}
+	for {
+		n, err := g.s.Read(g.buf)
+		if n > 0 {
+			cur := g.s.Current()
+			if g.active && (cur.Name != g.seg.Name || g.startsSource(cur, n)) {
+				g.segDone = true
+			}
+			g.pending = append(g.pending[:0], g.buf[:n]...)
+			g.pendingName = cur.Name
+			if err != nil {
+				g.setErr(err)
+			}
+			return true
+		}
+		if err != nil {
+			g.setErr(err)
+			return false
+		}
+	}
+}
+
+// sourceStarter is implemented by streams that know exactly whether the
+// last Read started a source, such as the multiplexer, whose injected
+// separators do not advance ByteOffset.
+type sourceStarter interface {
+	startsSource() bool
+}
+
+// startsSource reports whether the n bytes just read begin a new source.
+func (g *Segmenter) startsSource(cur SrcMeta, n int) bool {
+	if s, ok := g.s.(sourceStarter); ok {
+		return s.startsSource()
+	}
+	return cur.ByteOffset-int64(n) == 0
+}
+
+func (g *Segmenter) setErr(err error) {
+	if err == io.EOF {
+		g.eof = true
+		return
+	}
+	if g.err == nil {
+		g.err = err
+	}
+}
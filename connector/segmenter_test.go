@@ -0,0 +1,128 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/opener"
+)
+
+func TestSegmenter_SplitsPerSource(t *testing.T) {
+	ctx := context.Background()
+	ops := []opener.Opener{
+		fakeOpener{name: "a", data: []byte("no newline"), readErrN: -1},
+		fakeOpener{name: "empty", data: nil, readErrN: -1},
+		fakeOpener{name: "b", data: []byte("second\n"), readErrN: -1},
+		fakeOpener{name: "b", data: []byte("same name"), readErrN: -1},
+	}
+	m := NewMuxReader(ctx, ops)
+	defer m.Close()
+
+	seg := NewSegmenter(m)
+	var names, bodies []string
+	for seg.Next() {
+		b, err := io.ReadAll(seg)
+		if err != nil {
+			t.Fatalf("read segment: %v", err)
+		}
+		names = append(names, seg.Meta().Name)
+		bodies = append(bodies, string(b))
+		if seg.Meta().ByteOffset != int64(len(b)) {
+			t.Fatalf("Meta().ByteOffset = %d, want %d", seg.Meta().ByteOffset, len(b))
+		}
+	}
+	if err := seg.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if got, want := strings.Join(names, ","), "a,b,b"; got != want {
+		t.Fatalf("names = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(bodies, "|"), "no newline|second\n|same name"; got != want {
+		t.Fatalf("bodies = %q, want %q", got, want)
+	}
+}
+
+func TestSegmenter_NextSkipsUnreadBytes(t *testing.T) {
+	ctx := context.Background()
+	ops := []opener.Opener{
+		fakeOpener{name: "a", data: []byte("aaaa"), readErrN: -1},
+		fakeOpener{name: "b", data: []byte("bbbb"), readErrN: -1},
+	}
+	m := NewMuxReader(ctx, ops)
+	defer m.Close()
+
+	seg := NewSegmenter(m)
+	if !seg.Next() {
+		t.Fatalf("expected first segment")
+	}
+	p := make([]byte, 1)
+	if _, err := seg.Read(p); err != nil || p[0] != 'a' {
+		t.Fatalf("Read = %q, %v", p, err)
+	}
+	if !seg.Next() {
+		t.Fatalf("expected second segment")
+	}
+	b, _ := io.ReadAll(seg)
+	if seg.Meta().Name != "b" || string(b) != "bbbb" {
+		t.Fatalf("segment = %q %q, want b bbbb", seg.Meta().Name, b)
+	}
+	if seg.Next() {
+		t.Fatalf("expected no more segments")
+	}
+}
+
+func TestSegmenter_PropagatesReadError(t *testing.T) {
+	ops := []opener.Opener{
+		fakeOpener{name: "a", data: []byte("abcdef"), readErrN: 3},
+	}
+	m := NewMuxReader(context.Background(), ops)
+	defer m.Close()
+
+	seg := NewSegmenter(m)
+	if !seg.Next() {
+		t.Fatalf("expected a segment, err: %v", seg.Err())
+	}
+	b, err := io.ReadAll(seg)
+	if err == nil || !strings.Contains(err.Error(), "read a") {
+		t.Fatalf("ReadAll err = %v, want contains %q", err, "read a")
+	}
+	if string(b) != "abc" {
+		t.Fatalf("partial bytes = %q, want %q", b, "abc")
+	}
+	if seg.Next() {
+		t.Fatalf("expected Next == false after error")
+	}
+	if seg.Err() == nil {
+		t.Fatalf("expected Err() to report the read error")
+	}
+}
+
+func TestSegmenter_SourceSeparator(t *testing.T) {
+	ctx := context.Background()
+	ops := []opener.Opener{
+		// A one-byte source: the injected separator ends at offset 1, like
+		// the first byte of a new source would.
+		fakeOpener{name: "a", data: []byte("x"), readErrN: -1},
+		fakeOpener{name: "a", data: []byte("y"), readErrN: -1},
+	}
+	m := NewMuxReader(ctx, ops, WithSourceSeparator([]byte("\n")))
+	defer m.Close()
+
+	seg := NewSegmenter(m)
+	var bodies []string
+	for seg.Next() {
+		b, err := io.ReadAll(seg)
+		if err != nil {
+			t.Fatalf("read segment: %v", err)
+		}
+		bodies = append(bodies, string(b))
+	}
+	if err := seg.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if got, want := strings.Join(bodies, "|"), "x\n|y"; got != want {
+		t.Fatalf("bodies = %q, want %q", got, want)
+	}
+}
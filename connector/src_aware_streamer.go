@@ -14,6 +14,26 @@ type SrcMeta struct {
 	ByteOffset int64
 }
 
+// SourceError is an error tied to one source, such as a failure to open or
+// read it, so that callers can tell which source failed without parsing
+// the message. Op, if set, names the failed operation ("open", "read").
+type SourceError struct {
+	Op     string
+	Source string
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	if e.Op == "" {
+		return e.Source + ": " + e.Err.Error()
+	}
+	return e.Op + " " + e.Source + ": " + e.Err.Error()
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
 type SrcAwareStreamer interface {
 	io.ReadCloser
 
@@ -0,0 +1,105 @@
+package load
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+//
+// Public API
+//
+
+// CSVSinkOptions configures a CSV sink.
+//
+// Row converts a value into the fields of one CSV row; it is required.
+// Header, when set, is written as the first row, even if no value is
+// written. Comma is the field delimiter and defaults to ','. UseCRLF ends
+// rows with \r\n instead of \n.
+type CSVSinkOptions[T any] struct {
+	Row     func(T) ([]string, error)
+	Header  []string
+	Comma   rune
+	UseCRLF bool
+}
+
+// NewCSVSink returns a Sink writing values to w as CSV rows, with the
+// quoting rules of encoding/csv. Output is buffered until Flush or Close.
+//
+// NewCSVSink panics if opt.Row is nil.
+func NewCSVSink[T any](w io.Writer, opt CSVSinkOptions[T]) Sink[T] {
+	if opt.Row == nil {
+		panic("NewCSVSink: Row is nil")
+	}
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	if opt.Comma != 0 {
+		cw.Comma = opt.Comma
+	}
+	cw.UseCRLF = opt.UseCRLF
+	return &csvSink[T]{bw: bw, cw: cw, opt: opt}
+}
+
+//
+// Unexported helpers
+//
+
+type csvSink[T any] struct {
+	bw  *bufio.Writer
+	cw  *csv.Writer
+	opt CSVSinkOptions[T]
+
+	headerDone bool
+	closed     bool
+}
+
+func (s *csvSink[T]) Write(_ context.Context, v T) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	row, err := s.opt.Row(v)
+	if err != nil {
+		return err
+	}
+	return s.cw.Write(row)
+}
+
+func (s *csvSink[T]) Flush(context.Context) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	s.cw.Flush()
+	if err := s.cw.Error(); err != nil {
+		return err
+	}
+	return s.bw.Flush()
+}
+
+func (s *csvSink[T]) Close(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+	err := s.Flush(ctx)
+	s.closed = true
+	return err
+}
+
+// writeHeader writes the header row once, if there is one.
+func (s *csvSink[T]) writeHeader() error {
+	if s.headerDone || len(s.opt.Header) == 0 {
+		return nil
+	}
+	s.headerDone = true
+	if err := s.cw.Write(s.opt.Header); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package load
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	Name string
+	X, Y int
+}
+
+func pointRow(p point) ([]string, error) {
+	return []string{p.Name, strconv.Itoa(p.X), strconv.Itoa(p.Y)}, nil
+}
+
+func TestCSVSink(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  CSVSinkOptions[point]
+		in   []point
+		want string
+	}{
+		{
+			name: "header and quoting",
+			opt:  CSVSinkOptions[point]{Row: pointRow, Header: []string{"name", "x", "y"}},
+			in:   []point{{"a", 1, 2}, {"b,c", 3, 4}, {`say "hi"`, 5, 6}},
+			want: "name,x,y\na,1,2\n\"b,c\",3,4\n\"say \"\"hi\"\"\",5,6\n",
+		},
+		{
+			name: "comma and crlf",
+			opt:  CSVSinkOptions[point]{Row: pointRow, Comma: '|', UseCRLF: true},
+			in:   []point{{"a", 1, 2}},
+			want: "a|1|2\r\n",
+		},
+		{
+			name: "header without rows",
+			opt:  CSVSinkOptions[point]{Row: pointRow, Header: []string{"name", "x", "y"}},
+			want: "name,x,y\n",
+		},
+	}
+	for _, tc := range cases {
+		var buf strings.Builder
+		sink := NewCSVSink(&buf, tc.opt)
+		ctx := context.Background()
+		for _, p := range tc.in {
+			if err := sink.Write(ctx, p); err != nil {
+				t.Fatalf("%s: Write: %v", tc.name, err)
+			}
+		}
+		if err := sink.Close(ctx); err != nil {
+			t.Fatalf("%s: Close: %v", tc.name, err)
+		}
+		if buf.String() != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.name, buf.String(), tc.want)
+		}
+	}
+}
+
+func TestCSVSink_BuffersUntilFlush(t *testing.T) {
+	var buf strings.Builder
+	sink := NewCSVSink(&buf, CSVSinkOptions[point]{Row: pointRow})
+	ctx := context.Background()
+	if err := sink.Write(ctx, point{"a", 1, 2}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("wrote %q before Flush", buf.String())
+	}
+	if err := sink.Flush(ctx); err != nil || buf.String() != "a,1,2\n" {
+		t.Fatalf("after Flush: %q, %v", buf.String(), err)
+	}
+	if err := sink.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := sink.Write(ctx, point{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Write after Close = %v, want ErrClosed", err)
+	}
+	if err := sink.Close(ctx); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestCSVSink_RowError(t *testing.T) {
+	rowErr := errors.New("no row")
+	sink := NewCSVSink(&strings.Builder{}, CSVSinkOptions[point]{Row: func(point) ([]string, error) { return nil, rowErr }})
+	if err := sink.Write(context.Background(), point{}); !errors.Is(err, rowErr) {
+		t.Fatalf("Write = %v, want %v", err, rowErr)
+	}
+}
@@ -0,0 +1,382 @@
+package load
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//
+// Public API
+//
+
+// FileSinkOptions configures a file sink.
+//
+// Dir is the output directory and Format creates the Sink encoding the
+// values of each file, e.g.
+//
+//	Format: func(w io.Writer) load.Sink[Event] {
+//	    return load.NewCSVSink(w, load.CSVSinkOptions[Event]{Row: eventRow, Header: header})
+//	}
+//
+// Both are required. Partition returns the directory of a value relative to
+// Dir, such as "dt=2024-10-01"; it may contain slashes but must stay within
+// Dir. When nil, all files are written to Dir itself.
+//
+// Files are named Prefix-NNNN followed by Extension and, when Gzip is set,
+// ".gz", e.g. "part-0003.csv.gz"; Prefix defaults to "part" and NNNN counts
+// the files of each partition from 0, or from one past the highest number
+// already used in the partition directory, so that a later run into the
+// same Dir adds files next to those of earlier runs.
+//
+// A file is rotated once it holds MaxRows values, or once MaxBytes bytes
+// reached it; zero limits are not enforced. Bytes are counted after
+// compression as they reach the file, so files may exceed MaxBytes by the
+// size of the encoder buffers. At most MaxOpenFiles files, 64 by default,
+// are kept open; writing to another partition rotates the least recently
+// written file.
+type FileSinkOptions[T any] struct {
+	Dir       string
+	Format    func(w io.Writer) Sink[T]
+	Partition func(T) string
+
+	Prefix    string
+	Extension string
+	Gzip      bool
+
+	MaxRows      int64
+	MaxBytes     int64
+	MaxOpenFiles int
+}
+
+// NewFileSink returns a Sink writing values to files under opt.Dir,
+// partitioned and rotated according to opt.
+//
+// Files are written to a hidden staging directory inside opt.Dir, so that
+// nothing appears in the output until Close commits it by renaming every
+// file into place. A file whose final name already exists fails the commit.
+// If the commit fails, the files already renamed are removed again, though
+// the partition directories created for them remain. Abort, which Run
+// calls when a load fails, removes the staging directory, so no partial
+// file is ever left behind.
+//
+// NewFileSink panics if opt.Dir or opt.Format is not set.
+func NewFileSink[T any](opt FileSinkOptions[T]) Sink[T] {
+	if opt.Dir == "" || opt.Format == nil {
+		panic("NewFileSink: Dir and Format are required")
+	}
+	if opt.Prefix == "" {
+		opt.Prefix = "part"
+	}
+	if opt.MaxOpenFiles <= 0 {
+		opt.MaxOpenFiles = 64
+	}
+	return &fileSink[T]{opt: opt, open: map[string]*partFile[T]{}, seq: map[string]int{}}
+}
+
+//
+// Unexported helpers
+//
+
+type fileSink[T any] struct {
+	opt FileSinkOptions[T]
+
+	// staging is the directory holding the files until commit.
+	staging string
+	// open holds the file being written of each partition.
+	open map[string]*partFile[T]
+	// seq is the number of the next file of each partition.
+	seq map[string]int
+	// staged lists the finished files, in creation order.
+	staged []stagedFile
+	// clock orders the writes, to find the least recently written file.
+	clock  int64
+	closed bool
+}
+
+// stagedFile is a finished file waiting for commit.
+type stagedFile struct {
+	tmp string
+	rel string
+}
+
+// partFile is an open output file.
+type partFile[T any] struct {
+	stagedFile
+	f        *os.File
+	counter  *countingWriter
+	gz       *gzip.Writer
+	sink     Sink[T]
+	rows     int64
+	lastUsed int64
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (s *fileSink[T]) Write(ctx context.Context, v T) error {
+	if s.closed {
+		return ErrClosed
+	}
+	var part string
+	if s.opt.Partition != nil {
+		part = filepath.FromSlash(s.opt.Partition(v))
+		if part != "" && !filepath.IsLocal(part) {
+			return fmt.Errorf("file sink: partition %q is not a local path", part)
+		}
+	}
+
+	pf := s.open[part]
+	if pf != nil && s.full(pf) {
+		if err := s.finish(ctx, part); err != nil {
+			return err
+		}
+		pf = nil
+	}
+	if pf == nil {
+		if len(s.open) >= s.opt.MaxOpenFiles {
+			if err := s.finish(ctx, s.leastRecentlyUsed()); err != nil {
+				return err
+			}
+		}
+		var err error
+		if pf, err = s.create(part); err != nil {
+			return err
+		}
+	}
+	if err := pf.sink.Write(ctx, v); err != nil {
+		return err
+	}
+	pf.rows++
+	s.clock++
+	pf.lastUsed = s.clock
+	return nil
+}
+
+func (s *fileSink[T]) Flush(ctx context.Context) error {
+	if s.closed {
+		return ErrClosed
+	}
+	for _, pf := range s.open {
+		if err := pf.sink.Flush(ctx); err != nil {
+			return err
+		}
+		if pf.gz != nil {
+			if err := pf.gz.Flush(); err != nil {
+				return fmt.Errorf("file sink: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *fileSink[T]) Close(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+	for part := range s.open {
+		if err := s.finish(ctx, part); err != nil {
+			_ = s.Abort(ctx)
+			return err
+		}
+	}
+	s.closed = true
+	err := s.commit()
+	if s.staging != "" {
+		if rerr := os.RemoveAll(s.staging); err == nil && rerr != nil {
+			err = fmt.Errorf("file sink: %w", rerr)
+		}
+	}
+	return err
+}
+
+// Abort closes the open files and removes the staging directory; nothing
+// is committed.
+func (s *fileSink[T]) Abort(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for _, pf := range s.open {
+		_ = pf.sink.Close(ctx)
+		_ = pf.f.Close()
+	}
+	s.open = nil
+	s.staged = nil
+	if s.staging == "" {
+		return nil
+	}
+	if err := os.RemoveAll(s.staging); err != nil {
+		return fmt.Errorf("file sink: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink[T]) full(pf *partFile[T]) bool {
+	return (s.opt.MaxRows > 0 && pf.rows >= s.opt.MaxRows) ||
+		(s.opt.MaxBytes > 0 && pf.counter.n >= s.opt.MaxBytes)
+}
+
+func (s *fileSink[T]) leastRecentlyUsed() string {
+	var (
+		lru  string
+		best int64 = -1
+	)
+	for part, pf := range s.open {
+		if best < 0 || pf.lastUsed < best {
+			lru, best = part, pf.lastUsed
+		}
+	}
+	return lru
+}
+
+// create opens the next file of part in the staging directory.
+func (s *fileSink[T]) create(part string) (*partFile[T], error) {
+	if s.staging == "" {
+		if err := os.MkdirAll(s.opt.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("file sink: %w", err)
+		}
+		dir, err := os.MkdirTemp(s.opt.Dir, ".cetl-staging-*")
+		if err != nil {
+			return nil, fmt.Errorf("file sink: %w", err)
+		}
+		s.staging = dir
+	}
+	f, err := os.CreateTemp(s.staging, "file-*")
+	if err != nil {
+		return nil, fmt.Errorf("file sink: %w", err)
+	}
+	// CreateTemp uses 0600, which suits the temporary name only.
+	if err := f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, fmt.Errorf("file sink: %w", err)
+	}
+
+	seq, ok := s.seq[part]
+	if !ok {
+		if seq, err = s.firstSeq(part); err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			return nil, err
+		}
+	}
+	s.seq[part] = seq + 1
+	name := fmt.Sprintf("%s-%04d%s", s.opt.Prefix, seq, s.opt.Extension)
+	if s.opt.Gzip {
+		name += ".gz"
+	}
+
+	pf := &partFile[T]{
+		stagedFile: stagedFile{tmp: f.Name(), rel: filepath.Join(part, name)},
+		f:          f,
+		counter:    &countingWriter{w: f},
+	}
+	var w io.Writer = pf.counter
+	if s.opt.Gzip {
+		pf.gz = gzip.NewWriter(pf.counter)
+		w = pf.gz
+	}
+	pf.sink = s.opt.Format(w)
+	s.open[part] = pf
+	return pf, nil
+}
+
+// firstSeq returns the number of the first file of part: one past the
+// highest number of the files already named Prefix-NNNN in its directory.
+func (s *fileSink[T]) firstSeq(part string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(s.opt.Dir, part))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("file sink: %w", err)
+	}
+	ext := s.opt.Extension
+	if s.opt.Gzip {
+		ext += ".gz"
+	}
+	next := 0
+	for _, e := range entries {
+		num, ok := strings.CutPrefix(e.Name(), s.opt.Prefix+"-")
+		if !ok {
+			continue
+		}
+		if num, ok = strings.CutSuffix(num, ext); !ok || num == "" {
+			continue
+		}
+		if strings.Trim(num, "0123456789") != "" {
+			continue
+		}
+		if n, err := strconv.Atoi(num); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return next, nil
+}
+
+// finish closes the open file of part and stages it for commit.
+func (s *fileSink[T]) finish(ctx context.Context, part string) error {
+	pf := s.open[part]
+	delete(s.open, part)
+	err := pf.sink.Close(ctx)
+	if pf.gz != nil {
+		if gerr := pf.gz.Close(); err == nil && gerr != nil {
+			err = fmt.Errorf("file sink: %w", gerr)
+		}
+	}
+	if cerr := pf.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("file sink: %w", cerr)
+	}
+	if err != nil {
+		_ = os.Remove(pf.tmp)
+		return err
+	}
+	s.staged = append(s.staged, pf.stagedFile)
+	return nil
+}
+
+// commit renames the staged files into place, removing the ones already
+// renamed if one fails.
+func (s *fileSink[T]) commit() error {
+	var done []string
+	for _, sf := range s.staged {
+		dst := filepath.Join(s.opt.Dir, sf.rel)
+		err := os.MkdirAll(filepath.Dir(dst), 0o755)
+		if err == nil {
+			if _, serr := os.Lstat(dst); serr == nil {
+				err = fmt.Errorf("%s: %w", dst, fs.ErrExist)
+			} else if !errors.Is(serr, fs.ErrNotExist) {
+				err = serr
+			}
+		}
+		if err == nil {
+			err = os.Rename(sf.tmp, dst)
+		}
+		if err != nil {
+			for _, p := range done {
+				_ = os.Remove(p)
+			}
+			return fmt.Errorf("file sink: commit: %w", err)
+		}
+		done = append(done, dst)
+	}
+	s.staged = nil
+	return nil
+}
@@ -0,0 +1,250 @@
+package load
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+type reading struct {
+	Day   string
+	Value string
+}
+
+func readingFormat(w io.Writer) Sink[reading] {
+	return NewCSVSink(w, CSVSinkOptions[reading]{
+		Header: []string{"day", "value"},
+		Row:    func(r reading) ([]string, error) { return []string{r.Day, r.Value}, nil },
+	})
+}
+
+func byReadingDay(r reading) string { return "dt=" + r.Day }
+
+// tree returns the files under dir with their contents, gunzipped.
+func tree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".gz") {
+			zr, err := gzip.NewReader(strings.NewReader(string(b)))
+			if err != nil {
+				return err
+			}
+			if b, err = io.ReadAll(zr); err != nil {
+				return err
+			}
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	return files
+}
+
+func readings(vals ...reading) transform.StructIterator[reading] {
+	return transform.FromSeq(slices.Values(vals))
+}
+
+func TestFileSink_PartitionsAndRotates(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	sink := NewFileSink(FileSinkOptions[reading]{
+		Dir:       dir,
+		Format:    readingFormat,
+		Partition: byReadingDay,
+		Extension: ".csv",
+		Gzip:      true,
+		MaxRows:   2,
+	})
+	in := readings(
+		reading{"2024-10-01", "a"},
+		reading{"2024-10-02", "b"},
+		reading{"2024-10-01", "c"},
+		reading{"2024-10-01", "d"},
+	)
+	if _, err := Run(context.Background(), in, sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]string{
+		"dt=2024-10-01/part-0000.csv.gz": "day,value\n2024-10-01,a\n2024-10-01,c\n",
+		"dt=2024-10-01/part-0001.csv.gz": "day,value\n2024-10-01,d\n",
+		"dt=2024-10-02/part-0000.csv.gz": "day,value\n2024-10-02,b\n",
+	}
+	if got := tree(t, dir); !maps.Equal(got, want) {
+		t.Fatalf("files = %q\nwant %q", got, want)
+	}
+}
+
+func TestFileSink_NothingVisibleUntilClose(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	sink := NewFileSink(FileSinkOptions[reading]{Dir: dir, Format: readingFormat, Prefix: "batch", Extension: ".csv"})
+	if err := sink.Write(ctx, reading{"d", "a"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), ".") {
+		t.Fatalf("before Close: %v, want only the hidden staging directory", entries)
+	}
+	if err := sink.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := tree(t, dir); !maps.Equal(got, map[string]string{"batch-0000.csv": "day,value\nd,a\n"}) {
+		t.Fatalf("files = %q", got)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "batch-0000.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o644 {
+		t.Fatalf("mode = %v, want -rw-r--r--", fi.Mode().Perm())
+	}
+}
+
+func TestFileSink_AbortLeavesNothing(t *testing.T) {
+	dir := t.TempDir()
+	readErr := errors.New("bad row")
+	in := transform.FromSeq2(func(yield func(reading, error) bool) {
+		_ = yield(reading{"d1", "a"}, nil) && yield(reading{"d2", "b"}, nil) && yield(reading{}, readErr)
+	})
+	sink := NewFileSink(FileSinkOptions[reading]{Dir: dir, Format: readingFormat, Partition: byReadingDay, MaxRows: 1})
+	if _, err := Run(context.Background(), in, sink); !errors.Is(err, readErr) {
+		t.Fatalf("err = %v, want %v", err, readErr)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("left %v after abort", entries)
+	}
+}
+
+func TestFileSink_CommitConflictRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	sink := NewFileSink(FileSinkOptions[reading]{Dir: dir, Format: readingFormat, Partition: byReadingDay})
+	for _, r := range []reading{{"d1", "a"}, {"d2", "b"}} {
+		if err := sink.Write(ctx, r); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	// Another writer takes the name after the sink numbered its file.
+	if err := os.MkdirAll(filepath.Join(dir, "dt=d2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dt=d2", "part-0000"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(ctx); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("err = %v, want fs.ErrExist", err)
+	}
+	want := map[string]string{"dt=d2/part-0000": "old"}
+	if got := tree(t, dir); !maps.Equal(got, want) {
+		t.Fatalf("files = %q, want only the existing file", got)
+	}
+}
+
+func TestFileSink_RerunContinuesNumbering(t *testing.T) {
+	dir := t.TempDir()
+	opt := FileSinkOptions[reading]{
+		Dir:       dir,
+		Format:    readingFormat,
+		Partition: byReadingDay,
+		Extension: ".csv",
+		MaxRows:   1,
+	}
+	// Files of other formats or prefixes do not take part in the numbering.
+	if err := os.MkdirAll(filepath.Join(dir, "dt=d1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dt=d1", "part-0007.json"), []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []transform.StructIterator[reading]{
+		readings(reading{"d1", "a"}, reading{"d1", "b"}),
+		readings(reading{"d1", "c"}, reading{"d2", "d"}),
+	} {
+		if _, err := Run(context.Background(), in, NewFileSink(opt)); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	}
+	want := map[string]string{
+		"dt=d1/part-0007.json": "other",
+		"dt=d1/part-0000.csv":  "day,value\nd1,a\n",
+		"dt=d1/part-0001.csv":  "day,value\nd1,b\n",
+		"dt=d1/part-0002.csv":  "day,value\nd1,c\n",
+		"dt=d2/part-0000.csv":  "day,value\nd2,d\n",
+	}
+	if got := tree(t, dir); !maps.Equal(got, want) {
+		t.Fatalf("files = %q\nwant %q", got, want)
+	}
+}
+
+func TestFileSink_MaxOpenFilesAndBytes(t *testing.T) {
+	dir := t.TempDir()
+	sink := NewFileSink(FileSinkOptions[reading]{
+		Dir:          dir,
+		Format:       func(w io.Writer) Sink[reading] { return unbuffered{w} },
+		Partition:    byReadingDay,
+		MaxOpenFiles: 1,
+		MaxBytes:     4,
+	})
+	in := readings(reading{"a", "12"}, reading{"a", "34"}, reading{"a", "56"}, reading{"b", "78"}, reading{"a", "90"})
+	if _, err := Run(context.Background(), in, sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]string{
+		"dt=a/part-0000": "1234",
+		"dt=a/part-0001": "56",
+		"dt=b/part-0000": "78",
+		"dt=a/part-0002": "90",
+	}
+	if got := tree(t, dir); !maps.Equal(got, want) {
+		t.Fatalf("files = %q\nwant %q", got, want)
+	}
+}
+
+func TestFileSink_RejectsEscapingPartition(t *testing.T) {
+	dir := t.TempDir()
+	sink := NewFileSink(FileSinkOptions[reading]{
+		Dir:       dir,
+		Format:    readingFormat,
+		Partition: func(reading) string { return "../escape" },
+	})
+	if err := sink.Write(context.Background(), reading{}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if err := sink.(Aborter).Abort(context.Background()); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+}
+
+// unbuffered writes the Value of each reading straight to w.
+type unbuffered struct{ w io.Writer }
+
+func (u unbuffered) Write(_ context.Context, r reading) error {
+	_, err := io.WriteString(u.w, r.Value)
+	return err
+}
+func (unbuffered) Flush(context.Context) error { return nil }
+func (unbuffered) Close(context.Context) error { return nil }
@@ -0,0 +1,56 @@
+package load
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+)
+
+//
+// Public API
+//
+
+// NewJSONLSink returns a Sink writing values to w as JSON Lines: one
+// encoding/json document per line. HTML characters are not escaped.
+// Output is buffered until Flush or Close.
+func NewJSONLSink[T any](w io.Writer) Sink[T] {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	return &jsonlSink[T]{bw: bw, enc: enc}
+}
+
+//
+// Unexported helpers
+//
+
+type jsonlSink[T any] struct {
+	bw     *bufio.Writer
+	enc    *json.Encoder
+	closed bool
+}
+
+func (s *jsonlSink[T]) Write(_ context.Context, v T) error {
+	if s.closed {
+		return ErrClosed
+	}
+	// Encode writes the trailing newline.
+	return s.enc.Encode(v)
+}
+
+func (s *jsonlSink[T]) Flush(context.Context) error {
+	if s.closed {
+		return ErrClosed
+	}
+	return s.bw.Flush()
+}
+
+func (s *jsonlSink[T]) Close(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+	err := s.Flush(ctx)
+	s.closed = true
+	return err
+}
@@ -0,0 +1,43 @@
+package load
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+func TestJSONLSink(t *testing.T) {
+	type event struct {
+		ID   string `json:"id"`
+		Note string `json:"note,omitempty"`
+	}
+	var buf strings.Builder
+	it := transform.FromSeq(func(yield func(event) bool) {
+		_ = yield(event{ID: "1", Note: "<b>&</b>"}) && yield(event{ID: "2"})
+	})
+	stats, err := Run(context.Background(), it, NewJSONLSink[event](&buf))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := "{\"id\":\"1\",\"note\":\"<b>&</b>\"}\n{\"id\":\"2\"}\n"
+	if buf.String() != want || stats.Written != 2 {
+		t.Fatalf("got %q (%d written), want %q", buf.String(), stats.Written, want)
+	}
+}
+
+func TestJSONLSink_Errors(t *testing.T) {
+	ctx := context.Background()
+	sink := NewJSONLSink[any](&strings.Builder{})
+	if err := sink.Write(ctx, func() {}); err == nil {
+		t.Fatalf("expected an error for an unsupported value")
+	}
+	if err := sink.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := sink.Write(ctx, 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Write after Close = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,127 @@
+// Package load writes streams of typed values to their destination: it is
+// the "L" of ETL, consuming the StructIterators built with transform and
+// operator.
+//
+// A Sink receives values one at a time. Run drives a StructIterator into a
+// Sink and reports what was written:
+//
+//	f, _ := os.Create("events.jsonl")
+//	defer f.Close()
+//	stats, err := load.Run(ctx, it, load.NewJSONLSink[Event](f))
+//
+// Sinks buffer as they see fit; Flush pushes buffered values to the
+// destination and Close commits the output. Sinks that can discard what
+// they wrote, such as transactional or atomic file sinks, implement Aborter,
+// which Run calls instead of Close when the load fails.
+package load
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Sink is the destination of a stream of values of type T. A Sink is not
+// safe for concurrent use.
+type Sink[T any] interface {
+	// Write adds v to the output. Sinks may buffer it until Flush or
+	// Close.
+	Write(ctx context.Context, v T) error
+
+	// Flush pushes the values buffered so far to the destination.
+	Flush(ctx context.Context) error
+
+	// Close flushes the remaining values, commits the output and releases
+	// the resources of the sink. Writers passed to a sink's constructor are
+	// not closed. It is safe to call Close multiple times.
+	Close(ctx context.Context) error
+}
+
+// Aborter is implemented by sinks that can discard their output, e.g. by
+// rolling back a transaction or removing temporary files. Abort releases
+// the resources of the sink like Close, but does not commit.
+type Aborter interface {
+	Abort(ctx context.Context) error
+}
+
+// ErrClosed is returned by sinks written to after Close or Abort.
+var ErrClosed = errors.New("load: sink closed")
+
+// Stats reports the outcome of Run.
+type Stats struct {
+	// Written is the number of values accepted by the sink's Write.
+	Written int64
+	// Elapsed is the wall time of the run.
+	Elapsed time.Duration
+}
+
+// Run writes the values of it to sink, then flushes and closes the sink.
+// It closes it in all cases.
+//
+// Run stops at the first error of the iterator, of the sink or of the
+// context. On failure the sink is aborted if it implements Aborter, and
+// closed otherwise; the returned Stats count the values written before the
+// failure. Errors of the sink's Write mention the source and byte offset of
+// the value when it implements transform.MetaProvider.
+func Run[T any](ctx context.Context, it transform.StructIterator[T], sink Sink[T]) (Stats, error) {
+	var stats Stats
+	start := time.Now()
+	fail := func(err error) (Stats, error) {
+		_ = it.Close()
+		abort(ctx, sink)
+		stats.Elapsed = time.Since(start)
+		return stats, err
+	}
+
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		if err := sink.Write(ctx, it.Struct()); err != nil {
+			return fail(writeError(it, err))
+		}
+		stats.Written++
+	}
+	if err := it.Err(); err != nil {
+		return fail(err)
+	}
+	if err := it.Close(); err != nil {
+		return fail(err)
+	}
+	if err := sink.Flush(ctx); err != nil {
+		return fail(fmt.Errorf("load: flush: %w", err))
+	}
+	if err := sink.Close(ctx); err != nil {
+		stats.Elapsed = time.Since(start)
+		return stats, fmt.Errorf("load: close: %w", err)
+	}
+	stats.Elapsed = time.Since(start)
+	return stats, nil
+}
+
+//
+// Unexported helpers
+//
+
+// abort discards the output of sink if it can, and closes it otherwise.
+func abort[T any](ctx context.Context, sink Sink[T]) {
+	if a, ok := sink.(Aborter); ok {
+		_ = a.Abort(ctx)
+		return
+	}
+	_ = sink.Close(ctx)
+}
+
+func writeError(it any, err error) error {
+	if m := transform.MetaOf(it); m.Name != "" {
+		return fmt.Errorf("load: write %s@%d: %w", m.Name, m.ByteOffset, err)
+	}
+	return fmt.Errorf("load: write: %w", err)
+}
@@ -0,0 +1,131 @@
+package load
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/transform"
+)
+
+// recordingSink records the calls it receives and fails Write on failOn.
+type recordingSink struct {
+	got    []string
+	calls  []string
+	failOn string
+}
+
+func (s *recordingSink) Write(_ context.Context, v string) error {
+	if v == s.failOn {
+		return errors.New("rejected " + v)
+	}
+	s.got = append(s.got, v)
+	return nil
+}
+
+func (s *recordingSink) Flush(context.Context) error { s.calls = append(s.calls, "flush"); return nil }
+func (s *recordingSink) Close(context.Context) error { s.calls = append(s.calls, "close"); return nil }
+
+// abortingSink is a recordingSink that implements Aborter.
+type abortingSink struct{ recordingSink }
+
+func (s *abortingSink) Abort(context.Context) error { s.calls = append(s.calls, "abort"); return nil }
+
+// closeCounter counts Close calls on a StructIterator.
+type closeCounter[T any] struct {
+	transform.StructIterator[T]
+	closed int
+}
+
+func (c *closeCounter[T]) Close() error {
+	c.closed++
+	return c.StructIterator.Close()
+}
+
+func values(vs ...string) *closeCounter[string] {
+	return &closeCounter[string]{StructIterator: transform.FromSeq(slices.Values(vs))}
+}
+
+// metaValues reports the value itself as its source name.
+type metaValues struct{ *closeCounter[string] }
+
+func (m metaValues) Meta() connector.SrcMeta {
+	return connector.SrcMeta{Name: m.Struct() + ".csv", ByteOffset: 42}
+}
+
+func TestRun(t *testing.T) {
+	sink := &recordingSink{}
+	it := values("a", "b", "c")
+	stats, err := Run(context.Background(), it, sink)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if stats.Written != 3 || !slices.Equal(sink.got, []string{"a", "b", "c"}) {
+		t.Fatalf("stats %+v, wrote %v", stats, sink.got)
+	}
+	if !slices.Equal(sink.calls, []string{"flush", "close"}) || it.closed != 1 {
+		t.Fatalf("sink calls %v, iterator closed %d times", sink.calls, it.closed)
+	}
+}
+
+func TestRun_WriteErrorAborts(t *testing.T) {
+	cases := []struct {
+		name      string
+		sink      Sink[string]
+		calls     func(Sink[string]) []string
+		wantCalls []string
+	}{
+		{
+			name:      "aborter",
+			sink:      &abortingSink{recordingSink{failOn: "b"}},
+			calls:     func(s Sink[string]) []string { return s.(*abortingSink).calls },
+			wantCalls: []string{"abort"},
+		},
+		{
+			name:      "plain",
+			sink:      &recordingSink{failOn: "b"},
+			calls:     func(s Sink[string]) []string { return s.(*recordingSink).calls },
+			wantCalls: []string{"close"},
+		},
+	}
+	for _, tc := range cases {
+		it := values("a", "b", "c")
+		stats, err := Run(context.Background(), metaValues{it}, tc.sink)
+		if err == nil || err.Error() != "load: write b.csv@42: rejected b" {
+			t.Fatalf("%s: err = %v", tc.name, err)
+		}
+		if stats.Written != 1 || it.closed != 1 {
+			t.Fatalf("%s: stats %+v, iterator closed %d times", tc.name, stats, it.closed)
+		}
+		if got := tc.calls(tc.sink); !slices.Equal(got, tc.wantCalls) {
+			t.Fatalf("%s: sink calls %v, want %v", tc.name, got, tc.wantCalls)
+		}
+	}
+}
+
+func TestRun_IteratorErrorAndCancel(t *testing.T) {
+	readErr := errors.New("bad row")
+	it := transform.FromSeq2(func(yield func(string, error) bool) {
+		if yield("a", nil) {
+			yield("", readErr)
+		}
+	})
+	sink := &abortingSink{}
+	if _, err := Run(context.Background(), it, sink); !errors.Is(err, readErr) {
+		t.Fatalf("err = %v, want %v", err, readErr)
+	}
+	if strings.Join(sink.calls, ",") != "abort" {
+		t.Fatalf("sink calls %v", sink.calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink = &abortingSink{}
+	stats, err := Run(ctx, values("a"), sink)
+	if !errors.Is(err, context.Canceled) || stats.Written != 0 {
+		t.Fatalf("stats %+v, err %v", stats, err)
+	}
+}
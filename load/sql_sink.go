@@ -0,0 +1,454 @@
+package load
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Dialect selects the SQL flavor of a SQL sink: placeholders, identifier
+// quoting and upsert syntax.
+type Dialect int
+
+const (
+	// DialectPostgres uses $n placeholders, "quoted" identifiers and
+	// ON CONFLICT upserts.
+	DialectPostgres Dialect = iota
+	// DialectMySQL uses ? placeholders, `quoted` identifiers and
+	// ON DUPLICATE KEY UPDATE upserts.
+	DialectMySQL
+	// DialectSQLite uses ? placeholders, "quoted" identifiers and
+	// ON CONFLICT upserts.
+	DialectSQLite
+)
+
+// String returns the name of the dialect, as accepted by ParseDialect.
+func (d Dialect) String() string {
+	switch d {
+	case DialectPostgres:
+		return "postgres"
+	case DialectMySQL:
+		return "mysql"
+	case DialectSQLite:
+		return "sqlite"
+	default:
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+}
+
+// ParseDialect returns the Dialect named s: "postgres" (or "postgresql",
+// "pgx"), "mysql" or "sqlite" (or "sqlite3"), ignoring case.
+func ParseDialect(s string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "postgres", "postgresql", "pgx":
+		return DialectPostgres, nil
+	case "mysql":
+		return DialectMySQL, nil
+	case "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	}
+	return 0, fmt.Errorf("unknown SQL dialect %q", s)
+}
+
+// Upsert turns the INSERTs of a SQL sink into upserts.
+//
+// Conflict lists the columns of the unique key rows may collide on; it is
+// required by Postgres and SQLite unless DoNothing is set, and ignored by
+// MySQL, which uses the table's unique keys. Update lists the columns to
+// overwrite with the incoming values; it defaults to every column not in
+// Conflict. DoNothing keeps the existing rows instead.
+type Upsert struct {
+	Conflict  []string
+	Update    []string
+	DoNothing bool
+}
+
+// SQLSinkOptions configures a SQL sink.
+//
+// Table is the destination table, optionally qualified ("schema.table").
+// Columns restricts and orders the columns written; it defaults to every
+// mapped field in declaration order.
+//
+// BatchSize is the number of rows per multi-row INSERT; it defaults to 100.
+// Databases cap the number of parameters of a statement (65535 for
+// Postgres, 32766 for recent SQLite versions), so BatchSize times the
+// number of columns must stay below that limit.
+//
+// By default each batch is written in its own transaction, retried up to
+// MaxRetries times when Retryable reports true (by default for every
+// error but context errors), waiting RetryBackoff (100ms by default),
+// doubled after each attempt. With SingleTx, all rows are written in one
+// transaction, committed by Close and rolled back by Abort; failed batches
+// are then not retried, as most databases abort the whole transaction on
+// error.
+type SQLSinkOptions struct {
+	Table   string
+	Dialect Dialect
+	Columns []string
+	Upsert  *Upsert
+
+	BatchSize int
+	SingleTx  bool
+
+	MaxRetries   int
+	RetryBackoff time.Duration
+	Retryable    func(error) bool
+}
+
+// NewSQLSink returns a Sink writing values of the struct type T (or
+// pointer to struct) as rows of opt.Table through db.
+//
+// Exported fields map to columns named by their `cetl` struct tag, or by
+// the field name when untagged; fields tagged `cetl:"-"` are skipped and
+// the fields of embedded structs are mapped as if they were fields of T.
+// Field values are passed to database/sql as is, so any type the driver
+// accepts, including driver.Valuer implementations, can be used.
+//
+// The returned Sink implements Aborter. NewSQLSink panics if T is not a
+// struct, if opt.Table is empty, if a column of opt.Columns or of
+// opt.Upsert is not mapped, or if an upsert lacks its conflict columns.
+func NewSQLSink[T any](db *sql.DB, opt SQLSinkOptions) Sink[T] {
+	if opt.Table == "" {
+		panic("NewSQLSink: Table is empty")
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 100
+	}
+	if opt.RetryBackoff <= 0 {
+		opt.RetryBackoff = 100 * time.Millisecond
+	}
+	if opt.Retryable == nil {
+		opt.Retryable = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	fields := structFields(reflect.TypeFor[T]())
+	if len(opt.Columns) > 0 {
+		fields = selectFields(fields, opt.Columns)
+	}
+	s := &sqlSink[T]{db: db, opt: opt, fields: fields, stmts: map[int]string{}}
+	s.suffix = upsertClause(opt.Dialect, columnNames(fields), opt.Upsert)
+	return s
+}
+
+//
+// Unexported helpers
+//
+
+type sqlSink[T any] struct {
+	db     *sql.DB
+	opt    SQLSinkOptions
+	fields []sqlField
+	// suffix is the upsert clause appended to every INSERT.
+	suffix string
+	// stmts caches the INSERT statements by number of rows.
+	stmts map[int]string
+
+	// args holds the arguments of the buffered rows.
+	args []any
+	rows int
+	// tx is the transaction of a SingleTx sink, opened by the first batch.
+	tx     *sql.Tx
+	closed bool
+}
+
+func (s *sqlSink[T]) Write(ctx context.Context, v T) error {
+	if s.closed {
+		return ErrClosed
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return errors.New("sql sink: nil value")
+		}
+		rv = rv.Elem()
+	}
+	for _, f := range s.fields {
+		fv, err := rv.FieldByIndexErr(f.index)
+		if err != nil {
+			// A nil embedded pointer: the promoted field is NULL.
+			s.args = append(s.args, nil)
+			continue
+		}
+		s.args = append(s.args, fv.Interface())
+	}
+	s.rows++
+	if s.rows >= s.opt.BatchSize {
+		return s.Flush(ctx)
+	}
+	return nil
+}
+
+func (s *sqlSink[T]) Flush(ctx context.Context) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.rows == 0 {
+		return nil
+	}
+	query := s.insert(s.rows)
+	var err error
+	if s.opt.SingleTx {
+		err = s.execSingleTx(ctx, query)
+	} else {
+		err = s.execWithRetry(ctx, query)
+	}
+	if err != nil {
+		return err
+	}
+	clear(s.args)
+	s.args = s.args[:0]
+	s.rows = 0
+	return nil
+}
+
+func (s *sqlSink[T]) Close(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+	err := s.Flush(ctx)
+	s.closed = true
+	if s.tx == nil {
+		return err
+	}
+	if err != nil {
+		_ = s.tx.Rollback()
+		return err
+	}
+	if err := s.tx.Commit(); err != nil {
+		return fmt.Errorf("sql sink: commit: %w", err)
+	}
+	return nil
+}
+
+// Abort drops the buffered rows and, with SingleTx, rolls back the rows
+// written so far. Batches already committed without SingleTx remain.
+func (s *sqlSink[T]) Abort(context.Context) error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.args, s.rows = nil, 0
+	if s.tx == nil {
+		return nil
+	}
+	if err := s.tx.Rollback(); err != nil {
+		return fmt.Errorf("sql sink: rollback: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlSink[T]) execSingleTx(ctx context.Context, query string) error {
+	if s.tx == nil {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("sql sink: begin: %w", err)
+		}
+		s.tx = tx
+	}
+	if _, err := s.tx.ExecContext(ctx, query, s.args...); err != nil {
+		return fmt.Errorf("sql sink: insert %d rows: %w", s.rows, err)
+	}
+	return nil
+}
+
+func (s *sqlSink[T]) execWithRetry(ctx context.Context, query string) error {
+	backoff := s.opt.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.execTx(ctx, query)
+		if err == nil {
+			return nil
+		}
+		if attempt >= s.opt.MaxRetries || !s.opt.Retryable(err) {
+			return fmt.Errorf("sql sink: insert %d rows (attempt %d): %w", s.rows, attempt+1, err)
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// execTx runs query in its own transaction.
+func (s *sqlSink[T]) execTx(ctx context.Context, query string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, query, s.args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert returns the INSERT statement for n rows.
+func (s *sqlSink[T]) insert(n int) string {
+	if q, ok := s.stmts[n]; ok {
+		return q
+	}
+	d := s.opt.Dialect
+	cols := make([]string, len(s.fields))
+	for i, f := range s.fields {
+		cols[i] = quoteIdent(d, f.column)
+	}
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(quoteIdent(d, s.opt.Table))
+	b.WriteString(" (")
+	b.WriteString(strings.Join(cols, ", "))
+	b.WriteString(") VALUES ")
+	p := 0
+	for r := range n {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := range s.fields {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			p++
+			if d == DialectPostgres {
+				b.WriteString("$" + strconv.Itoa(p))
+			} else {
+				b.WriteByte('?')
+			}
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(s.suffix)
+	q := b.String()
+	s.stmts[n] = q
+	return q
+}
+
+// sqlField is a mapped struct field.
+type sqlField struct {
+	column string
+	index  []int
+}
+
+// structFields maps the exported fields of the struct type t, or of the
+// struct t points to.
+func structFields(t reflect.Type) []sqlField {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("NewSQLSink: %v is not a struct", t))
+	}
+	var fields []sqlField
+	for _, f := range transform.TaggedFields(t, nil) {
+		fields = append(fields, sqlField{column: f.Column, index: f.Index})
+	}
+	if len(fields) == 0 {
+		panic(fmt.Sprintf("NewSQLSink: %v has no exported fields", t))
+	}
+	return fields
+}
+
+func selectFields(fields []sqlField, columns []string) []sqlField {
+	out := make([]sqlField, 0, len(columns))
+	for _, c := range columns {
+		i := slices.IndexFunc(fields, func(f sqlField) bool { return f.column == c })
+		if i < 0 {
+			panic(fmt.Sprintf("NewSQLSink: column %q is not mapped", c))
+		}
+		out = append(out, fields[i])
+	}
+	return out
+}
+
+func columnNames(fields []sqlField) []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.column
+	}
+	return names
+}
+
+// upsertClause returns the clause appended to INSERTs for u, or "".
+func upsertClause(d Dialect, columns []string, u *Upsert) string {
+	if u == nil {
+		return ""
+	}
+	for _, c := range slices.Concat(u.Conflict, u.Update) {
+		if !slices.Contains(columns, c) {
+			panic(fmt.Sprintf("NewSQLSink: upsert column %q is not mapped", c))
+		}
+	}
+	update := u.Update
+	if len(update) == 0 {
+		for _, c := range columns {
+			if !slices.Contains(u.Conflict, c) {
+				update = append(update, c)
+			}
+		}
+	}
+
+	if d == DialectMySQL {
+		if u.DoNothing || len(update) == 0 {
+			// Assigning a column to itself leaves the existing row as is
+			// without hiding other errors, unlike INSERT IGNORE.
+			c := quoteIdent(d, columns[0])
+			return " ON DUPLICATE KEY UPDATE " + c + " = " + c
+		}
+		sets := make([]string, len(update))
+		for i, c := range update {
+			q := quoteIdent(d, c)
+			sets[i] = q + " = VALUES(" + q + ")"
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+
+	var target string
+	if len(u.Conflict) > 0 {
+		quoted := make([]string, len(u.Conflict))
+		for i, c := range u.Conflict {
+			quoted[i] = quoteIdent(d, c)
+		}
+		target = " (" + strings.Join(quoted, ", ") + ")"
+	}
+	if u.DoNothing || len(update) == 0 {
+		return " ON CONFLICT" + target + " DO NOTHING"
+	}
+	if target == "" {
+		panic("NewSQLSink: upsert requires Conflict columns")
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		q := quoteIdent(d, c)
+		sets[i] = q + " = EXCLUDED." + q
+	}
+	return " ON CONFLICT" + target + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// quoteIdent quotes each dot-separated part of an identifier.
+func quoteIdent(d Dialect, ident string) string {
+	q := `"`
+	if d == DialectMySQL {
+		q = "`"
+	}
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		parts[i] = q + strings.ReplaceAll(p, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
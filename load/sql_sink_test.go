@@ -0,0 +1,249 @@
+package load
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+// fakeDB is the state of an in-process database/sql driver that logs the
+// statements and transaction calls it receives.
+type fakeDB struct {
+	mu  sync.Mutex
+	log []string
+	// failExecs is the number of upcoming Exec calls that fail.
+	failExecs int
+}
+
+func (db *fakeDB) record(s string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.log = append(db.log, s)
+}
+
+func (db *fakeDB) open() *sql.DB {
+	return sql.OpenDB(fakeConnector{db})
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("use the connector") }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("begin")
+	return fakeTx{c.db}, nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (t fakeTx) Commit() error   { t.db.record("commit"); return nil }
+func (t fakeTx) Rollback() error { t.db.record("rollback"); return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	fail := s.db.failExecs > 0
+	if fail {
+		s.db.failExecs--
+	}
+	s.db.mu.Unlock()
+	if fail {
+		s.db.record("exec failed")
+		return nil, errors.New("deadlock detected")
+	}
+	s.db.record(fmt.Sprintf("%s %v", s.query, args))
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+type Audit struct {
+	Source string `cetl:"source"`
+}
+
+type row struct {
+	ID    int    `cetl:"id"`
+	Name  string `cetl:"name"`
+	Notes string `cetl:"-"`
+	Audit
+	hidden int
+}
+
+func rows(n int) transform.StructIterator[row] {
+	return transform.FromSeq(func(yield func(row) bool) {
+		for i := 1; i <= n; i++ {
+			if !yield(row{ID: i, Name: fmt.Sprint("n", i), Notes: "x", Audit: Audit{Source: "s"}}) {
+				return
+			}
+		}
+	})
+}
+
+func TestSQLSink_BatchedInserts(t *testing.T) {
+	db := &fakeDB{}
+	sink := NewSQLSink[row](db.open(), SQLSinkOptions{Table: "public.items", BatchSize: 2})
+	stats, err := Run(context.Background(), rows(3), sink)
+	if err != nil || stats.Written != 3 {
+		t.Fatalf("Run: %+v, %v", stats, err)
+	}
+	want := []string{
+		"begin",
+		`INSERT INTO "public"."items" ("id", "name", "source") VALUES ($1, $2, $3), ($4, $5, $6) [1 n1 s 2 n2 s]`,
+		"commit",
+		"begin",
+		`INSERT INTO "public"."items" ("id", "name", "source") VALUES ($1, $2, $3) [3 n3 s]`,
+		"commit",
+	}
+	if !slices.Equal(db.log, want) {
+		t.Fatalf("log:\n%s\nwant:\n%s", strings.Join(db.log, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSQLSink_Statements(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  SQLSinkOptions
+		want string
+	}{
+		{
+			name: "mysql insert with columns",
+			opt:  SQLSinkOptions{Table: "items", Dialect: DialectMySQL, Columns: []string{"name", "id"}},
+			want: "INSERT INTO `items` (`name`, `id`) VALUES (?, ?)",
+		},
+		{
+			name: "postgres upsert",
+			opt:  SQLSinkOptions{Table: "items", Upsert: &Upsert{Conflict: []string{"id"}}},
+			want: `INSERT INTO "items" ("id", "name", "source") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "source" = EXCLUDED."source"`,
+		},
+		{
+			name: "sqlite upsert of some columns",
+			opt:  SQLSinkOptions{Table: "items", Dialect: DialectSQLite, Upsert: &Upsert{Conflict: []string{"id"}, Update: []string{"name"}}},
+			want: `INSERT INTO "items" ("id", "name", "source") VALUES (?, ?, ?) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+		},
+		{
+			name: "postgres do nothing",
+			opt:  SQLSinkOptions{Table: "items", Upsert: &Upsert{DoNothing: true}},
+			want: `INSERT INTO "items" ("id", "name", "source") VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		},
+		{
+			name: "mysql upsert",
+			opt:  SQLSinkOptions{Table: "items", Dialect: DialectMySQL, Upsert: &Upsert{Conflict: []string{"id"}}},
+			want: "INSERT INTO `items` (`id`, `name`, `source`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `source` = VALUES(`source`)",
+		},
+		{
+			name: "mysql do nothing",
+			opt:  SQLSinkOptions{Table: "items", Dialect: DialectMySQL, Upsert: &Upsert{DoNothing: true}},
+			want: "INSERT INTO `items` (`id`, `name`, `source`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `id` = `id`",
+		},
+	}
+	for _, tc := range cases {
+		sink := NewSQLSink[*row](nil, tc.opt).(*sqlSink[*row])
+		if got := sink.insert(1); got != tc.want {
+			t.Fatalf("%s:\n got %s\nwant %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSQLSink_Retry(t *testing.T) {
+	db := &fakeDB{failExecs: 1}
+	sink := NewSQLSink[row](db.open(), SQLSinkOptions{Table: "t", MaxRetries: 1, RetryBackoff: time.Millisecond})
+	if _, err := Run(context.Background(), rows(1), sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{"begin", "exec failed", "rollback", "begin", `INSERT INTO "t" ("id", "name", "source") VALUES ($1, $2, $3) [1 n1 s]`, "commit"}
+	if !slices.Equal(db.log, want) {
+		t.Fatalf("log:\n%s", strings.Join(db.log, "\n"))
+	}
+
+	db = &fakeDB{failExecs: 2}
+	sink = NewSQLSink[row](db.open(), SQLSinkOptions{Table: "t", MaxRetries: 1, RetryBackoff: time.Millisecond})
+	_, err := Run(context.Background(), rows(1), sink)
+	if err == nil || !strings.Contains(err.Error(), "attempt 2") || !strings.Contains(err.Error(), "deadlock detected") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSQLSink_SingleTx(t *testing.T) {
+	db := &fakeDB{}
+	sink := NewSQLSink[row](db.open(), SQLSinkOptions{Table: "t", BatchSize: 1, SingleTx: true})
+	if _, err := Run(context.Background(), rows(2), sink); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := strings.Join(db.log, "|"); strings.Count(got, "begin") != 1 || !strings.HasSuffix(got, "commit") || strings.Count(got, "INSERT") != 2 {
+		t.Fatalf("log: %s", got)
+	}
+
+	// A failing input rolls back the rows already inserted.
+	db = &fakeDB{}
+	readErr := errors.New("bad row")
+	it := transform.FromSeq2(func(yield func(row, error) bool) {
+		_ = yield(row{ID: 1}, nil) && yield(row{ID: 2}, nil) && yield(row{}, readErr)
+	})
+	sink = NewSQLSink[row](db.open(), SQLSinkOptions{Table: "t", BatchSize: 1, SingleTx: true})
+	if _, err := Run(context.Background(), it, sink); !errors.Is(err, readErr) {
+		t.Fatalf("err = %v, want %v", err, readErr)
+	}
+	if got := strings.Join(db.log, "|"); strings.Count(got, "INSERT") != 2 || !strings.HasSuffix(got, "rollback") || strings.Contains(got, "commit") {
+		t.Fatalf("log: %s", got)
+	}
+}
+
+func TestSQLSink_Panics(t *testing.T) {
+	cases := map[string]func(){
+		"not a struct":   func() { NewSQLSink[int](nil, SQLSinkOptions{Table: "t"}) },
+		"no table":       func() { NewSQLSink[row](nil, SQLSinkOptions{}) },
+		"unknown column": func() { NewSQLSink[row](nil, SQLSinkOptions{Table: "t", Columns: []string{"Notes"}}) },
+		"upsert target":  func() { NewSQLSink[row](nil, SQLSinkOptions{Table: "t", Upsert: &Upsert{}}) },
+		"upsert unmapped": func() {
+			NewSQLSink[row](nil, SQLSinkOptions{Table: "t", Upsert: &Upsert{Conflict: []string{"hidden"}}})
+		},
+	}
+	for name, fn := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s: expected panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	for _, d := range []Dialect{DialectPostgres, DialectMySQL, DialectSQLite} {
+		if got, err := ParseDialect(strings.ToUpper(d.String())); err != nil || got != d {
+			t.Fatalf("ParseDialect(%q) = %v, %v", d, got, err)
+		}
+	}
+	if _, err := ParseDialect("oracle"); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
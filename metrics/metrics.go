@@ -0,0 +1,198 @@
+// Package metrics instruments runs of cetl pipelines: how long sources
+// take to open, how many bytes each yields, how many records are decoded,
+// how many fail to map, and how long the multiplexer waits for its reader.
+//
+// Hooks are the callbacks invoked by the instrumented stages:
+//
+//	run := metrics.NewRun()
+//	run.Publish("cetl") // optional: expose as JSON under /debug/vars
+//	hooks := run.Hooks()
+//
+//	mux := connector.NewMuxReader(ctx, ops, connector.WithHooks(hooks))
+//	tr := transform.NewDecodeMapTransform[Event](transform.ObserveDecoder(dec, hooks))
+//	it, err := tr.Transform(ctx, mux, transform.ObserveMapper(mapFn, hooks))
+//	...
+//	fmt.Printf("%+v\n", run.Snapshot())
+//
+// Custom Hooks can feed any other metrics system. The package depends on
+// the standard library only.
+package metrics
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+//
+// Public API
+//
+
+// Hooks are the callbacks of instrumented stages. Nil fields are skipped,
+// and so are all calls on a nil *Hooks. Callbacks may be invoked from
+// several goroutines at once, e.g. by the multiplexer's producer and by the
+// workers of a parallel transform, and must be safe for concurrent use.
+type Hooks struct {
+	// OnOpen is called after a source was opened, with the time Open took
+	// and its error.
+	OnOpen func(source string, latency time.Duration, err error)
+	// OnRead is called with the number of bytes of each read from a
+	// source.
+	OnRead func(source string, n int)
+	// OnBlocked is called with the time the multiplexer spent writing a
+	// chunk to its pipe, that is waiting for the reader to consume it.
+	OnBlocked func(d time.Duration)
+	// OnRecord is called for each record decoded.
+	OnRecord func(source string)
+	// OnMapperError is called with each error returned by a mapper and the
+	// location of its record.
+	OnMapperError func(source string, offset int64, err error)
+}
+
+// Open calls h.OnOpen, if set.
+func (h *Hooks) Open(source string, latency time.Duration, err error) {
+	if h != nil && h.OnOpen != nil {
+		h.OnOpen(source, latency, err)
+	}
+}
+
+// Read calls h.OnRead, if set.
+func (h *Hooks) Read(source string, n int) {
+	if h != nil && h.OnRead != nil {
+		h.OnRead(source, n)
+	}
+}
+
+// Blocked calls h.OnBlocked, if set.
+func (h *Hooks) Blocked(d time.Duration) {
+	if h != nil && h.OnBlocked != nil {
+		h.OnBlocked(d)
+	}
+}
+
+// Record calls h.OnRecord, if set.
+func (h *Hooks) Record(source string) {
+	if h != nil && h.OnRecord != nil {
+		h.OnRecord(source)
+	}
+}
+
+// MapperError calls h.OnMapperError, if set.
+func (h *Hooks) MapperError(source string, offset int64, err error) {
+	if h != nil && h.OnMapperError != nil {
+		h.OnMapperError(source, offset, err)
+	}
+}
+
+// Run collects the metrics of one run through its Hooks. It is safe for
+// concurrent use.
+type Run struct {
+	start time.Time
+
+	mu      sync.Mutex
+	total   SourceStats
+	blocked time.Duration
+	sources []*SourceStats
+	index   map[string]*SourceStats
+}
+
+// SourceStats are the metrics of one source, or the totals of a run.
+// OpenLatency is the time Open took; OpenErrors counts failed opens.
+type SourceStats struct {
+	Name         string        `json:"name,omitempty"`
+	Opens        int64         `json:"opens"`
+	OpenErrors   int64         `json:"open_errors"`
+	OpenLatency  time.Duration `json:"open_latency_ns"`
+	BytesRead    int64         `json:"bytes_read"`
+	Records      int64         `json:"records"`
+	MapperErrors int64         `json:"mapper_errors"`
+}
+
+// Snapshot is the state of a Run at a point in time, ready for
+// json.Marshal. The rates are averages over Elapsed.
+type Snapshot struct {
+	Elapsed          time.Duration `json:"elapsed_ns"`
+	Blocked          time.Duration `json:"blocked_ns"`
+	BytesPerSecond   float64       `json:"bytes_per_second"`
+	RecordsPerSecond float64       `json:"records_per_second"`
+	SourceStats
+	Sources []SourceStats `json:"sources"`
+}
+
+// NewRun returns a Run whose elapsed time starts now.
+func NewRun() *Run {
+	return &Run{start: time.Now(), index: map[string]*SourceStats{}}
+}
+
+// Hooks returns the Hooks feeding r.
+func (r *Run) Hooks() *Hooks {
+	return &Hooks{
+		OnOpen: func(source string, latency time.Duration, err error) {
+			r.update(source, func(s *SourceStats) {
+				s.Opens++
+				s.OpenLatency += latency
+				if err != nil {
+					s.OpenErrors++
+				}
+			})
+		},
+		OnRead: func(source string, n int) {
+			r.update(source, func(s *SourceStats) { s.BytesRead += int64(n) })
+		},
+		OnBlocked: func(d time.Duration) {
+			r.mu.Lock()
+			r.blocked += d
+			r.mu.Unlock()
+		},
+		OnRecord: func(source string) {
+			r.update(source, func(s *SourceStats) { s.Records++ })
+		},
+		OnMapperError: func(source string, _ int64, _ error) {
+			r.update(source, func(s *SourceStats) { s.MapperErrors++ })
+		},
+	}
+}
+
+// Snapshot returns the current metrics of r, with the sources in order of
+// first appearance.
+func (r *Run) Snapshot() Snapshot {
+	elapsed := time.Since(r.start)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := Snapshot{Elapsed: elapsed, Blocked: r.blocked, SourceStats: r.total}
+	if secs := elapsed.Seconds(); secs > 0 {
+		s.BytesPerSecond = float64(s.BytesRead) / secs
+		s.RecordsPerSecond = float64(s.Records) / secs
+	}
+	s.Sources = make([]SourceStats, len(r.sources))
+	for i, src := range r.sources {
+		s.Sources[i] = *src
+	}
+	return s
+}
+
+// Publish exposes r in the expvar registry under name, as its Snapshot
+// encoded in JSON, served at /debug/vars by http.DefaultServeMux or by
+// expvar.Handler. Like expvar.Publish, it panics if name is already
+// registered.
+func (r *Run) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return r.Snapshot() }))
+}
+
+//
+// Unexported helpers
+//
+
+// update applies fn to the metrics of source and to the totals.
+func (r *Run) update(source string, fn func(*SourceStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.index[source]
+	if s == nil {
+		s = &SourceStats{Name: source}
+		r.index[source] = s
+		r.sources = append(r.sources, s)
+	}
+	fn(s)
+	fn(&r.total)
+}
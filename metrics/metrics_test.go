@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	run := NewRun()
+	h := run.Hooks()
+	h.Open("a.csv", 2*time.Millisecond, nil)
+	h.Open("b.csv", time.Millisecond, errors.New("denied"))
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				h.Read("a.csv", 10)
+				h.Record("a.csv")
+			}
+		}()
+	}
+	wg.Wait()
+	h.MapperError("a.csv", 42, errors.New("bad"))
+	h.Blocked(3 * time.Millisecond)
+	h.Blocked(time.Millisecond)
+
+	s := run.Snapshot()
+	want := SourceStats{Opens: 2, OpenErrors: 1, OpenLatency: 3 * time.Millisecond, BytesRead: 4000, Records: 400, MapperErrors: 1}
+	if s.SourceStats != want || s.Blocked != 4*time.Millisecond {
+		t.Fatalf("totals = %+v, blocked %v", s.SourceStats, s.Blocked)
+	}
+	if len(s.Sources) != 2 || s.Sources[0].Name != "a.csv" || s.Sources[0].Records != 400 || s.Sources[1].OpenErrors != 1 {
+		t.Fatalf("sources = %+v", s.Sources)
+	}
+	if s.Elapsed <= 0 || s.RecordsPerSecond <= 0 || math.Abs(s.BytesPerSecond/s.RecordsPerSecond-10) > 1e-9 {
+		t.Fatalf("rates = %+v", s)
+	}
+}
+
+func TestHooks_Nil(t *testing.T) {
+	var h *Hooks
+	h.Open("a", 0, nil)
+	h.Read("a", 1)
+	h.Blocked(0)
+	h.Record("a")
+	h.MapperError("a", 0, nil)
+	(&Hooks{}).Record("a")
+}
+
+func TestRun_Publish(t *testing.T) {
+	run := NewRun()
+	run.Hooks().Record("a.csv")
+	run.Publish("cetl_test")
+	v := expvar.Get("cetl_test")
+	if v == nil {
+		t.Fatal("not published")
+	}
+	var got struct {
+		Records int64 `json:"records"`
+		Sources []struct {
+			Name    string `json:"name"`
+			Records int64  `json:"records"`
+		} `json:"sources"`
+	}
+	if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+		t.Fatalf("%s: %v", v, err)
+	}
+	if got.Records != 1 || len(got.Sources) != 1 || got.Sources[0].Name != "a.csv" {
+		t.Fatalf("published %s", v)
+	}
+}
@@ -0,0 +1,346 @@
+package opener
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//
+// Public API
+//
+
+// Encoding identifies the character encoding of a source.
+type Encoding int
+
+const (
+	// EncodingAuto detects the encoding of each source: a byte order mark
+	// selects UTF-8, UTF-16LE or UTF-16BE; without one, a sample of the
+	// first bytes is checked for the NUL pattern of UTF-16 text, then for
+	// valid UTF-8, and Windows-1252 is assumed otherwise.
+	EncodingAuto Encoding = iota
+	// EncodingUTF8 is UTF-8; the bytes are passed through unchanged.
+	EncodingUTF8
+	// EncodingUTF16LE is little-endian UTF-16.
+	EncodingUTF16LE
+	// EncodingUTF16BE is big-endian UTF-16.
+	EncodingUTF16BE
+	// EncodingWindows1252 is the Windows Western European code page.
+	EncodingWindows1252
+	// EncodingISO88591 is ISO-8859-1 (Latin-1).
+	EncodingISO88591
+)
+
+// String returns the canonical name of e, as accepted by ParseEncoding.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingAuto:
+		return "auto"
+	case EncodingUTF8:
+		return "utf-8"
+	case EncodingUTF16LE:
+		return "utf-16le"
+	case EncodingUTF16BE:
+		return "utf-16be"
+	case EncodingWindows1252:
+		return "windows-1252"
+	case EncodingISO88591:
+		return "iso-8859-1"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+}
+
+// ParseEncoding returns the Encoding with the given name. Names are
+// case-insensitive and common aliases ("utf8", "cp1252", "latin1", ...)
+// are accepted. The empty string is EncodingAuto.
+func ParseEncoding(name string) (Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "auto":
+		return EncodingAuto, nil
+	case "utf-8", "utf8":
+		return EncodingUTF8, nil
+	case "utf-16le", "utf16le":
+		return EncodingUTF16LE, nil
+	case "utf-16be", "utf16be":
+		return EncodingUTF16BE, nil
+	case "windows-1252", "cp1252":
+		return EncodingWindows1252, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		return EncodingISO88591, nil
+	default:
+		return 0, fmt.Errorf("unknown encoding %q", name)
+	}
+}
+
+// Transcode wraps op so that the stream it opens is converted from enc to
+// UTF-8, with any leading byte order mark removed.
+//
+// Because each source is transcoded on its own before concatenation, a BOM
+// at the start of the second file of a connector multiplexer no longer
+// ends up in the middle of the stream. Byte offsets reported downstream
+// count UTF-8 bytes, not bytes of the original file.
+//
+// Invalid input (an unpaired UTF-16 surrogate, a truncated UTF-16 code
+// unit) is replaced with U+FFFD.
+func Transcode(op Opener, enc Encoding) Opener {
+	return transcodedOpener{op: op, enc: enc}
+}
+
+// TranscodeAll applies Transcode to every opener in ops.
+func TranscodeAll(ops []Opener, enc Encoding) []Opener {
+	out := make([]Opener, len(ops))
+	for i, op := range ops {
+		out[i] = Transcode(op, enc)
+	}
+	return out
+}
+
+// NewUTF8Reader returns a reader that converts r from enc to UTF-8 and
+// drops a leading byte order mark.
+func NewUTF8Reader(r io.Reader, enc Encoding) io.Reader {
+	br := bufio.NewReader(r)
+	if enc == EncodingAuto {
+		enc = detectEncoding(br)
+	}
+	skipBOM(br, enc)
+	if enc == EncodingUTF8 {
+		return br
+	}
+	t := &transcodingReader{r: br}
+	switch enc {
+	case EncodingUTF16LE:
+		t.next = func(r *bufio.Reader) (rune, error) { return readUTF16(r, littleEndian) }
+	case EncodingUTF16BE:
+		t.next = func(r *bufio.Reader) (rune, error) { return readUTF16(r, bigEndian) }
+	case EncodingWindows1252:
+		t.next = readWindows1252
+	default:
+		t.next = readLatin1
+	}
+	return t
+}
+
+// Open opens the wrapped source and returns its content as UTF-8.
+func (t transcodedOpener) Open(ctx context.Context) (io.ReadCloser, error) {
+	rc, err := t.op.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{Reader: NewUTF8Reader(rc, t.enc), Closer: rc}, nil
+}
+
+// Name returns the name of the wrapped source.
+func (t transcodedOpener) Name() string {
+	return t.op.Name()
+}
+
+//
+// Unexported helpers
+//
+
+type transcodedOpener struct {
+	op  Opener
+	enc Encoding
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sniffSize is the number of bytes EncodingAuto inspects when there is no
+// byte order mark.
+const sniffSize = 4096
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// detectEncoding implements EncodingAuto without consuming input.
+func detectEncoding(br *bufio.Reader) Encoding {
+	sample, _ := br.Peek(sniffSize)
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+	// Mostly-ASCII UTF-16 text has a NUL in every other byte.
+	var evenNUL, oddNUL int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenNUL++
+		} else {
+			oddNUL++
+		}
+	}
+	if half := len(sample) / 2; half > 0 {
+		switch {
+		case oddNUL*10 >= half*3 && evenNUL*10 < half:
+			return EncodingUTF16LE
+		case evenNUL*10 >= half*3 && oddNUL*10 < half:
+			return EncodingUTF16BE
+		}
+	}
+	if validUTF8Prefix(sample, len(sample) == sniffSize) {
+		return EncodingUTF8
+	}
+	return EncodingWindows1252
+}
+
+// validUTF8Prefix reports whether sample is valid UTF-8. When truncated is
+// set, an incomplete rune at the end of the sample is tolerated.
+func validUTF8Prefix(sample []byte, truncated bool) bool {
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r == utf8.RuneError && size <= 1 {
+			return truncated && len(sample) < utf8.UTFMax && !utf8.FullRune(sample)
+		}
+		sample = sample[size:]
+	}
+	return true
+}
+
+// skipBOM discards the byte order mark of enc, if present.
+func skipBOM(br *bufio.Reader, enc Encoding) {
+	var bom []byte
+	switch enc {
+	case EncodingUTF8:
+		bom = bomUTF8
+	case EncodingUTF16LE:
+		bom = bomUTF16LE
+	case EncodingUTF16BE:
+		bom = bomUTF16BE
+	default:
+		return
+	}
+	if b, _ := br.Peek(len(bom)); bytes.Equal(b, bom) {
+		_, _ = br.Discard(len(bom))
+	}
+}
+
+// transcodingReader decodes runes from r and returns them as UTF-8.
+type transcodingReader struct {
+	r *bufio.Reader
+	// next decodes the next rune of the source encoding.
+	next func(r *bufio.Reader) (rune, error)
+	// out holds encoded bytes not yet returned.
+	out []byte
+	// err is the error to return once out is drained.
+	err error
+}
+
+func (t *transcodingReader) Read(p []byte) (int, error) {
+	// Decode at least one rune, and more only while input is buffered, so
+	// that Read does not block on a slow source with output ready.
+	for t.err == nil && len(t.out) < len(p) && (len(t.out) == 0 || t.r.Buffered() > 0) {
+		c, err := t.next(t.r)
+		if err != nil {
+			t.err = err
+			break
+		}
+		t.out = utf8.AppendRune(t.out, c)
+	}
+	if len(t.out) == 0 {
+		return 0, t.err
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+type byteOrder bool
+
+const (
+	littleEndian byteOrder = false
+	bigEndian    byteOrder = true
+)
+
+// readUTF16 decodes one rune, combining surrogate pairs.
+func readUTF16(r *bufio.Reader, order byteOrder) (rune, error) {
+	u, err := readUnit(r, order)
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(rune(u)) {
+		return rune(u), nil
+	}
+	if u >= 0xdc00 {
+		// A low surrogate cannot start a pair.
+		return utf8.RuneError, nil
+	}
+	// An error here resurfaces on the next read.
+	b, err := r.Peek(2)
+	if err != nil {
+		return utf8.RuneError, nil
+	}
+	low := unit(b, order)
+	if low < 0xdc00 || low > 0xdfff {
+		return utf8.RuneError, nil
+	}
+	_, _ = r.Discard(2)
+	return utf16.DecodeRune(rune(u), rune(low)), nil
+}
+
+// readUnit reads one UTF-16 code unit. A truncated unit at the end of the
+// input decodes as U+FFFD.
+func readUnit(r *bufio.Reader, order byteOrder) (uint16, error) {
+	b0, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	b1, err := r.ReadByte()
+	if err == io.EOF {
+		return utf8.RuneError, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return unit([]byte{b0, b1}, order), nil
+}
+
+func unit(b []byte, order byteOrder) uint16 {
+	if order == bigEndian {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return uint16(b[1])<<8 | uint16(b[0])
+}
+
+func readLatin1(r *bufio.Reader) (rune, error) {
+	b, err := r.ReadByte()
+	return rune(b), err
+}
+
+func readWindows1252(r *bufio.Reader) (rune, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b >= 0x80 && b <= 0x9f {
+		return windows1252[b-0x80], nil
+	}
+	return rune(b), nil
+}
+
+// windows1252 maps bytes 0x80-0x9F. The five bytes the code page leaves
+// undefined map to the C1 control with the same value, as in the WHATWG
+// Encoding Standard.
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
@@ -0,0 +1,134 @@
+package opener
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return b
+}
+
+func TestNewUTF8Reader(t *testing.T) {
+	text := "id,name\n1,Zoë 😀\n"
+	le := utf16Bytes(text, false)
+	be := utf16Bytes(text, true)
+	cases := []struct {
+		name string
+		enc  Encoding
+		in   []byte
+		want string
+	}{
+		{name: "utf-8 passthrough", enc: EncodingUTF8, in: []byte(text), want: text},
+		{name: "utf-8 bom", enc: EncodingUTF8, in: append([]byte{0xef, 0xbb, 0xbf}, text...), want: text},
+		{name: "utf-16le bom", enc: EncodingUTF16LE, in: append([]byte{0xff, 0xfe}, le...), want: text},
+		{name: "utf-16be no bom", enc: EncodingUTF16BE, in: be, want: text},
+		{name: "utf-16 lone surrogate", enc: EncodingUTF16LE, in: []byte{'a', 0, 0x00, 0xd8, 'b', 0}, want: "a�b"},
+		{name: "utf-16 truncated unit", enc: EncodingUTF16LE, in: []byte{'a', 0, 'b'}, want: "a�"},
+		{name: "windows-1252", enc: EncodingWindows1252, in: []byte("caf\xe9 \x80\x96\x81"), want: "café €–\u0081"},
+		{name: "iso-8859-1", enc: EncodingISO88591, in: []byte("caf\xe9 \x80"), want: "café \u0080"},
+		{name: "auto utf-8 bom", enc: EncodingAuto, in: append([]byte{0xef, 0xbb, 0xbf}, text...), want: text},
+		{name: "auto utf-16le bom", enc: EncodingAuto, in: append([]byte{0xff, 0xfe}, le...), want: text},
+		{name: "auto utf-16be bom", enc: EncodingAuto, in: append([]byte{0xfe, 0xff}, be...), want: text},
+		{name: "auto utf-16le no bom", enc: EncodingAuto, in: le, want: text},
+		{name: "auto utf-16be no bom", enc: EncodingAuto, in: be, want: text},
+		{name: "auto utf-8", enc: EncodingAuto, in: []byte(text), want: text},
+		{name: "auto windows-1252", enc: EncodingAuto, in: []byte("Jos\xe9,\x80 5\n"), want: "José,€ 5\n"},
+		{name: "auto empty", enc: EncodingAuto, in: nil, want: ""},
+	}
+	for _, tc := range cases {
+		// One byte at a time exercises runes split across reads.
+		r := NewUTF8Reader(iotest.OneByteReader(bytes.NewReader(tc.in)), tc.enc)
+		got, err := io.ReadAll(iotest.OneByteReader(r))
+		if err != nil {
+			t.Fatalf("%s: ReadAll: %v", tc.name, err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNewUTF8Reader_AutoTruncatedSample(t *testing.T) {
+	// The sniffing window ends in the middle of a multi-byte rune.
+	text := strings.Repeat("a", sniffSize-1) + "é"
+	got, err := io.ReadAll(NewUTF8Reader(strings.NewReader(text), EncodingAuto))
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != text {
+		t.Fatalf("text was not detected as UTF-8")
+	}
+}
+
+func TestNewUTF8Reader_ReadError(t *testing.T) {
+	boom := io.ErrClosedPipe
+	r := NewUTF8Reader(io.MultiReader(strings.NewReader("ab"), iotest.ErrReader(boom)), EncodingISO88591)
+	got, err := io.ReadAll(r)
+	if err != boom {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	if string(got) != "ab" {
+		t.Fatalf("got %q before the error, want %q", got, "ab")
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	ops := TranscodeAll([]Opener{
+		InMemorySource{SourceName: "a.csv", Data: append([]byte{0xef, 0xbb, 0xbf}, "a,b\n"...)},
+		InMemorySource{SourceName: "b.csv", Data: append([]byte{0xff, 0xfe}, utf16Bytes("a,b\n", false)...)},
+	}, EncodingAuto)
+	for _, op := range ops {
+		rc, err := op.Open(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Open: %v", op.Name(), err)
+		}
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%s: ReadAll: %v", op.Name(), err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", op.Name(), err)
+		}
+		if string(got) != "a,b\n" {
+			t.Fatalf("%s: got %q", op.Name(), got)
+		}
+	}
+	if ops[1].Name() != "b.csv" {
+		t.Fatalf("Name() = %q, want b.csv", ops[1].Name())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Transcode(NewFile("missing.csv"), EncodingUTF8).Open(ctx); err == nil {
+		t.Fatalf("Open with canceled context: got nil error")
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for _, enc := range []Encoding{EncodingAuto, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingWindows1252, EncodingISO88591} {
+		got, err := ParseEncoding(strings.ToUpper(enc.String()))
+		if err != nil || got != enc {
+			t.Fatalf("ParseEncoding(%q) = %v, %v", enc, got, err)
+		}
+	}
+	if got, err := ParseEncoding("cp1252"); err != nil || got != EncodingWindows1252 {
+		t.Fatalf("ParseEncoding(cp1252) = %v, %v", got, err)
+	}
+	if _, err := ParseEncoding("ebcdic"); err == nil {
+		t.Fatalf("ParseEncoding(ebcdic): expected error")
+	}
+}
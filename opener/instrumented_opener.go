@@ -0,0 +1,49 @@
+package opener
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/carlodf/cetl/metrics"
+)
+
+// Instrument returns an Opener reporting to hooks the latency of each Open
+// of op and the bytes read from the streams it opens. The returned Opener
+// has the Name of op; with nil hooks, Instrument returns op itself.
+func Instrument(op Opener, hooks *metrics.Hooks) Opener {
+	if hooks == nil {
+		return op
+	}
+	return instrumentedOpener{Opener: op, hooks: hooks}
+}
+
+type instrumentedOpener struct {
+	Opener
+	hooks *metrics.Hooks
+}
+
+func (o instrumentedOpener) Open(ctx context.Context) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := o.Opener.Open(ctx)
+	o.hooks.Open(o.Name(), time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadCloser: rc, name: o.Name(), hooks: o.hooks}, nil
+}
+
+// countingReader reports the bytes of each Read.
+type countingReader struct {
+	io.ReadCloser
+	name  string
+	hooks *metrics.Hooks
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.hooks.Read(r.name, n)
+	}
+	return n, err
+}
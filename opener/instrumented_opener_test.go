@@ -0,0 +1,55 @@
+package opener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/carlodf/cetl/metrics"
+)
+
+// failingOpener fails to open after a delay.
+type failingOpener struct{ err error }
+
+func (f failingOpener) Open(context.Context) (io.ReadCloser, error) {
+	time.Sleep(5 * time.Millisecond)
+	return nil, f.err
+}
+func (f failingOpener) Name() string { return "broken" }
+
+func TestInstrument(t *testing.T) {
+	src := InMemorySource{SourceName: "mem", Data: []byte("0123456789")}
+	if _, ok := Instrument(src, nil).(InMemorySource); !ok {
+		t.Fatal("Instrument with nil hooks wraps the opener")
+	}
+	run := metrics.NewRun()
+	op := Instrument(src, run.Hooks())
+	if op.Name() != "mem" {
+		t.Fatalf("Name() = %q", op.Name())
+	}
+	rc, err := op.Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(rc); err != nil || string(data) != "0123456789" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	rc.Close()
+
+	openErr := errors.New("denied")
+	if _, err := Instrument(failingOpener{openErr}, run.Hooks()).Open(context.Background()); !errors.Is(err, openErr) {
+		t.Fatalf("Open = %v", err)
+	}
+	s := run.Snapshot()
+	if len(s.Sources) != 2 {
+		t.Fatalf("sources = %+v", s.Sources)
+	}
+	if mem := s.Sources[0]; mem.Name != "mem" || mem.Opens != 1 || mem.BytesRead != 10 {
+		t.Fatalf("mem = %+v", mem)
+	}
+	if broken := s.Sources[1]; broken.OpenErrors != 1 || broken.OpenLatency < 5*time.Millisecond {
+		t.Fatalf("broken = %+v", broken)
+	}
+}
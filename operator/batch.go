@@ -0,0 +1,153 @@
+package operator
+
+import (
+	"context"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Chunk is a batch of values produced by Batch.
+type Chunk[T any] struct {
+	// Items holds the values, in input order. Each Chunk has its own
+	// slice, which the caller may keep.
+	Items []T
+	// Sources lists, in order, the sources the items were read from, with
+	// one entry per run of consecutive items from the same source. A
+	// source is taken to change when its name changes or its offsets go
+	// backwards, so two consecutive sources with the same name get one
+	// entry each.
+	Sources []SourceSpan
+}
+
+// SourceSpan describes a run of items of a Chunk read from one source.
+type SourceSpan struct {
+	// Name is the source name.
+	Name string
+	// First and Last are the byte offsets of the first and last record of
+	// the run, as reported by SrcMeta.ByteOffset.
+	First, Last int64
+	// Count is the number of items in the run.
+	Count int
+}
+
+// BatchOptions configures Batch.
+//
+// A batch is emitted as soon as adding the next value would exceed one of
+// the limits; a zero limit is not enforced:
+//
+//   - Size caps the number of values per batch.
+//   - MaxBytes caps the sum of SizeOf over the values of a batch. A single
+//     value larger than MaxBytes forms a batch on its own. MaxBytes
+//     requires SizeOf.
+//   - BySource never puts values from two different sources in the same
+//     batch, so that each batch maps to one file for auditing and retries.
+//     Sources are told apart as for Chunk.Sources.
+//
+// Sources are known when the input implements transform.MetaProvider, as
+// the iterators of transform and of this package do. Otherwise all values
+// are treated as coming from one unnamed source.
+type BatchOptions[T any] struct {
+	Size     int
+	MaxBytes int64
+	SizeOf   func(T) int64
+	BySource bool
+}
+
+// Batch groups the values of it into Chunks according to opt. The last
+// batch may be smaller than the limits; no empty batch is ever emitted.
+//
+// The limits are options rather than positional size and byte arguments:
+// a byte limit is meaningless without SizeOf, and BySource applies on top
+// of both, so Batch(ctx, it, BatchOptions[T]{Size: n}) is the plain form.
+//
+// Batch panics if opt.MaxBytes is set without opt.SizeOf.
+func Batch[T any](ctx context.Context, it transform.StructIterator[T], opt BatchOptions[T]) transform.StructIterator[Chunk[T]] {
+	if opt.MaxBytes > 0 && opt.SizeOf == nil {
+		panic("operator.Batch: MaxBytes requires SizeOf")
+	}
+	b := &batcher[T]{src: it, opt: opt}
+	return chunkIterator[T]{newStage(ctx, it, b.next)}
+}
+
+//
+// Unexported helpers
+//
+
+// continuedBy reports whether a record at meta belongs to the same source
+// as the run s. Offsets grow within a source, so an offset going backwards
+// starts another source even under the same name, as when the same file
+// or stdin is read twice.
+func (s SourceSpan) continuedBy(meta connector.SrcMeta) bool {
+	return s.Name == meta.Name && meta.ByteOffset >= s.Last
+}
+
+// chunkIterator hides the Meta of the underlying stage, which would
+// describe the value read ahead; Chunk.Sources reports provenance instead.
+type chunkIterator[T any] struct {
+	transform.StructIterator[Chunk[T]]
+}
+
+type batcher[T any] struct {
+	src transform.StructIterator[T]
+	opt BatchOptions[T]
+
+	// pending holds a value read from src that did not fit in the
+	// previous batch.
+	pending     T
+	pendingMeta connector.SrcMeta
+	hasPending  bool
+}
+
+// next builds the next batch.
+func (b *batcher[T]) next() (Chunk[T], bool, error) {
+	var (
+		chunk Chunk[T]
+		bytes int64
+	)
+	for {
+		var (
+			v    T
+			meta connector.SrcMeta
+		)
+		switch {
+		case b.hasPending:
+			v, meta = b.pending, b.pendingMeta
+			b.hasPending = false
+		case b.src.Next():
+			v, meta = b.src.Struct(), transform.MetaOf(b.src)
+		default:
+			return chunk, len(chunk.Items) > 0, nil
+		}
+
+		var size int64
+		if b.opt.SizeOf != nil {
+			size = b.opt.SizeOf(v)
+		}
+		if n := len(chunk.Items); n > 0 {
+			full := b.opt.Size > 0 && n >= b.opt.Size
+			tooBig := b.opt.MaxBytes > 0 && bytes+size > b.opt.MaxBytes
+			otherSource := b.opt.BySource && !chunk.Sources[len(chunk.Sources)-1].continuedBy(meta)
+			if full || tooBig || otherSource {
+				b.pending, b.pendingMeta, b.hasPending = v, meta, true
+				return chunk, true, nil
+			}
+		}
+
+		chunk.Items = append(chunk.Items, v)
+		bytes += size
+		if s := len(chunk.Sources) - 1; s >= 0 && chunk.Sources[s].continuedBy(meta) {
+			chunk.Sources[s].Last = meta.ByteOffset
+			chunk.Sources[s].Count++
+		} else {
+			chunk.Sources = append(chunk.Sources, SourceSpan{Name: meta.Name, First: meta.ByteOffset, Last: meta.ByteOffset, Count: 1})
+		}
+		if b.opt.Size > 0 && len(chunk.Items) >= b.opt.Size {
+			return chunk, true, nil
+		}
+	}
+}
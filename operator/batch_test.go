@@ -0,0 +1,149 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/transform"
+)
+
+// metaIterator is a sliceIterator that reports a SrcMeta per value.
+type metaIterator[T any] struct {
+	sliceIterator[T]
+	metas []connector.SrcMeta
+}
+
+func (m *metaIterator[T]) Meta() connector.SrcMeta { return m.metas[m.idx-1] }
+
+// sourced returns an iterator over vals where value i comes from srcs[i],
+// at an offset growing by 10 per value of the same source.
+func sourced[T any](vals []T, srcs ...string) *metaIterator[T] {
+	it := &metaIterator[T]{sliceIterator: sliceIterator[T]{vals: vals}}
+	offsets := map[string]int64{}
+	for _, s := range srcs {
+		it.metas = append(it.metas, connector.SrcMeta{Name: s, ByteOffset: offsets[s]})
+		offsets[s] += 10
+	}
+	return it
+}
+
+// describe renders chunks as "items@name:first-last/count ...".
+func describe[T any](chunks []Chunk[T]) string {
+	var parts []string
+	for _, c := range chunks {
+		var spans []string
+		for _, s := range c.Sources {
+			spans = append(spans, fmt.Sprintf("%s:%d-%d/%d", s.Name, s.First, s.Last, s.Count))
+		}
+		parts = append(parts, fmt.Sprintf("%v@%s", c.Items, strings.Join(spans, ",")))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	vals := []int{1, 2, 3, 4, 5}
+	srcs := []string{"a", "a", "a", "b", "b"}
+	cases := []struct {
+		name string
+		opt  BatchOptions[int]
+		want string
+	}{
+		{
+			name: "size",
+			opt:  BatchOptions[int]{Size: 2},
+			want: "[1 2]@a:0-10/2 [3 4]@a:20-20/1,b:0-0/1 [5]@b:10-10/1",
+		},
+		{
+			name: "by source",
+			opt:  BatchOptions[int]{BySource: true},
+			want: "[1 2 3]@a:0-20/3 [4 5]@b:0-10/2",
+		},
+		{
+			name: "size and source",
+			opt:  BatchOptions[int]{Size: 2, BySource: true},
+			want: "[1 2]@a:0-10/2 [3]@a:20-20/1 [4 5]@b:0-10/2",
+		},
+		{
+			name: "max bytes",
+			opt:  BatchOptions[int]{MaxBytes: 5, SizeOf: func(n int) int64 { return int64(n) }},
+			want: "[1 2]@a:0-10/2 [3]@a:20-20/1 [4]@b:0-0/1 [5]@b:10-10/1",
+		},
+		{
+			name: "oversized value alone",
+			opt:  BatchOptions[int]{MaxBytes: 2, SizeOf: func(n int) int64 { return int64(n) }},
+			want: "[1]@a:0-0/1 [2]@a:10-10/1 [3]@a:20-20/1 [4]@b:0-0/1 [5]@b:10-10/1",
+		},
+		{
+			name: "unbounded",
+			opt:  BatchOptions[int]{},
+			want: "[1 2 3 4 5]@a:0-20/3,b:0-10/2",
+		},
+	}
+	for _, tc := range cases {
+		got := collect(t, Batch(ctx, sourced(vals, srcs...), tc.opt))
+		if d := describe(got); d != tc.want {
+			t.Fatalf("%s:\n got %s\nwant %s", tc.name, d, tc.want)
+		}
+	}
+}
+
+func TestBatch_RepeatedSourceName(t *testing.T) {
+	// The same file given twice: offsets restart under the same name.
+	it := &metaIterator[int]{sliceIterator: sliceIterator[int]{vals: []int{1, 2, 3, 4}}}
+	for _, off := range []int64{0, 10, 0, 10} {
+		it.metas = append(it.metas, connector.SrcMeta{Name: "-", ByteOffset: off})
+	}
+	got := collect(t, Batch(context.Background(), it, BatchOptions[int]{BySource: true}))
+	if d, want := describe(got), "[1 2]@-:0-10/2 [3 4]@-:0-10/2"; d != want {
+		t.Fatalf("batches = %s, want %s", d, want)
+	}
+}
+
+func TestBatch_NoMetaAndEmpty(t *testing.T) {
+	ctx := context.Background()
+	got := collect(t, Batch(ctx, from(1, 2, 3), BatchOptions[int]{Size: 2, BySource: true}))
+	if d := describe(got); d != "[1 2]@:0-0/2 [3]@:0-0/1" {
+		t.Fatalf("batches = %s", d)
+	}
+	if got := collect(t, Batch(ctx, from[int](), BatchOptions[int]{Size: 2})); len(got) != 0 {
+		t.Fatalf("expected no batch, got %d", len(got))
+	}
+}
+
+func TestBatch_ItemsNotShared(t *testing.T) {
+	got := collect(t, Batch(context.Background(), from(1, 2, 3, 4), BatchOptions[int]{Size: 2}))
+	got[0].Items = append(got[0].Items, 99)
+	if !slices.Equal(got[1].Items, []int{3, 4}) {
+		t.Fatalf("second batch changed: %v", got[1].Items)
+	}
+}
+
+func TestBatch_PanicsWithoutSizeOf(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	Batch(context.Background(), from(1), BatchOptions[int]{MaxBytes: 10})
+}
+
+func TestOperators_PropagateMeta(t *testing.T) {
+	ctx := context.Background()
+	src := sourced([]int{1, 2, 3}, "a", "b", "c")
+	it := Map(ctx, Filter(ctx, src, func(n int) bool { return n != 2 }), func(n int) (string, error) {
+		return fmt.Sprint(n), nil
+	})
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		got = append(got, it.Struct()+"@"+it.(transform.MetaProvider).Meta().Name)
+	}
+	if strings.Join(got, ",") != "1@a,3@c" {
+		t.Fatalf("values = %q", got)
+	}
+}
@@ -0,0 +1,434 @@
+package operator
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"os"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Accumulator folds the values of one group into a result. A new
+// Accumulator is created for each group and aggregate.
+type Accumulator[T any] interface {
+	// Add folds v into the accumulator. An error ends the aggregation.
+	Add(v T) error
+	// Result returns the aggregate of the values added so far.
+	Result() any
+}
+
+// Aggregate describes one aggregation computed by GroupBy. Name labels the
+// result, e.g. as a column name, and prefixes the errors of the
+// accumulators; New creates the Accumulator of each group.
+//
+// Count, Sum, Min, Max, Avg, First, Last and CountDistinct build the usual
+// aggregates; custom ones only need to provide New.
+type Aggregate[T any] struct {
+	Name string
+	New  func() Accumulator[T]
+}
+
+// Group is a result of GroupBy: the key of a group and, in the order of the
+// aggregates, the Result of each Accumulator.
+type Group[K comparable] struct {
+	Key    K
+	Values []any
+}
+
+// Number is the set of types Sum and Avg accept.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Count counts the values of a group, as an int64.
+func Count[T any](name string) Aggregate[T] {
+	return Aggregate[T]{Name: name, New: func() Accumulator[T] {
+		var n int64
+		return accumulator[T]{
+			add:    func(T) error { n++; return nil },
+			result: func() any { return n },
+		}
+	}}
+}
+
+// Sum adds up field over the values of a group. The result has type N.
+func Sum[T any, N Number](name string, field func(T) N) Aggregate[T] {
+	return Aggregate[T]{Name: name, New: func() Accumulator[T] {
+		var sum N
+		return accumulator[T]{
+			add:    func(v T) error { sum += field(v); return nil },
+			result: func() any { return sum },
+		}
+	}}
+}
+
+// Min returns the smallest field over the values of a group.
+func Min[T any, V cmp.Ordered](name string, field func(T) V) Aggregate[T] {
+	return extremum(name, field, -1)
+}
+
+// Max returns the largest field over the values of a group.
+func Max[T any, V cmp.Ordered](name string, field func(T) V) Aggregate[T] {
+	return extremum(name, field, 1)
+}
+
+// Avg returns the mean of field over the values of a group, as a float64.
+func Avg[T any, N Number](name string, field func(T) N) Aggregate[T] {
+	return Aggregate[T]{Name: name, New: func() Accumulator[T] {
+		var (
+			sum float64
+			n   int64
+		)
+		return accumulator[T]{
+			add:    func(v T) error { sum += float64(field(v)); n++; return nil },
+			result: func() any { return sum / float64(n) },
+		}
+	}}
+}
+
+// First returns field of the first value of a group, in input order.
+func First[T, V any](name string, field func(T) V) Aggregate[T] {
+	return Aggregate[T]{Name: name, New: func() Accumulator[T] {
+		var (
+			first V
+			seen  bool
+		)
+		return accumulator[T]{
+			add: func(v T) error {
+				if !seen {
+					first, seen = field(v), true
+				}
+				return nil
+			},
+			result: func() any { return first },
+		}
+	}}
+}
+
+// Last returns field of the last value of a group, in input order.
+func Last[T, V any](name string, field func(T) V) Aggregate[T] {
+	return Aggregate[T]{Name: name, New: func() Accumulator[T] {
+		var last V
+		return accumulator[T]{
+			add:    func(v T) error { last = field(v); return nil },
+			result: func() any { return last },
+		}
+	}}
+}
+
+// CountDistinct counts the distinct values of field in a group, as an
+// int64. The distinct values of each group are kept in memory.
+func CountDistinct[T any, V comparable](name string, field func(T) V) Aggregate[T] {
+	return Aggregate[T]{Name: name, New: func() Accumulator[T] {
+		seen := map[V]struct{}{}
+		return accumulator[T]{
+			add:    func(v T) error { seen[field(v)] = struct{}{}; return nil },
+			result: func() any { return int64(len(seen)) },
+		}
+	}}
+}
+
+// GroupByOptions configures GroupBy.
+//
+// MaxGroups is the number of groups GroupBy keeps in memory; zero means no
+// limit. Once it is reached, the values of the groups not in memory are
+// spilled with Codec to temporary files in TempDir, hash-partitioned by key
+// into Partitions files (16 by default), and each file is aggregated in a
+// later pass, partitioning it again if needed. Codec is only required when
+// MaxGroups is set.
+type GroupByOptions[T any] struct {
+	MaxGroups  int
+	Codec      Codec[T]
+	TempDir    string
+	Partitions int
+}
+
+// GroupBy groups the values of it by key and yields one Group per distinct
+// key, with the results of aggs in order, like SQL's GROUP BY. An empty
+// input yields no group.
+//
+// GroupBy consumes the whole input on the first call to Next, closing it
+// once drained. Groups held in memory are yielded in the order their keys
+// first appear; groups aggregated from spilled values follow, in no
+// particular order. Each group is aggregated in a single pass over its
+// values in input order, so First and Last are exact even when spilling.
+//
+// Temporary files are removed as they are consumed, when Next fails or
+// observes a canceled context, and by Close; callers must call Close. The
+// returned iterator does not implement transform.MetaProvider.
+//
+// GroupBy panics if key or an Aggregate's New is nil, or if
+// opt.MaxGroups is set without both codec functions.
+func GroupBy[T any, K comparable](ctx context.Context, it transform.StructIterator[T], key func(T) K, aggs []Aggregate[T], opt GroupByOptions[T]) transform.StructIterator[Group[K]] {
+	if key == nil {
+		panic("operator.GroupBy: key is required")
+	}
+	for _, a := range aggs {
+		if a.New == nil {
+			panic(fmt.Sprintf("operator.GroupBy: aggregate %q has no New", a.Name))
+		}
+	}
+	if opt.MaxGroups > 0 && (opt.Codec.Encode == nil || opt.Codec.Decode == nil) {
+		panic("operator.GroupBy: MaxGroups requires Codec")
+	}
+	if opt.Partitions < 2 {
+		opt.Partitions = 16
+	}
+	return &groupIterator[T, K]{ctx: ctx, src: it, key: key, aggs: aggs, opt: opt}
+}
+
+// Next returns the next group. The first call aggregates the input.
+func (g *groupIterator[T, K]) Next() bool {
+	if g.done {
+		return false
+	}
+	if err := g.ctx.Err(); err != nil {
+		g.fail(err)
+		return false
+	}
+	for len(g.out) == 0 {
+		var err error
+		switch {
+		case !g.loaded:
+			g.loaded = true
+			err = g.pass(g.readSource)
+			if err == nil {
+				g.srcClosed = true
+				err = g.src.Close()
+			}
+		case len(g.parts) > 0:
+			err = g.passPartition()
+		default:
+			g.done = true
+			g.cur = Group[K]{}
+			return false
+		}
+		if err != nil {
+			g.fail(err)
+			return false
+		}
+	}
+	g.cur = g.out[0]
+	g.out[0] = Group[K]{}
+	g.out = g.out[1:]
+	return true
+}
+
+// Struct returns the current group.
+func (g *groupIterator[T, K]) Struct() Group[K] {
+	return g.cur
+}
+
+// Err reports the first error of the input, an accumulator, the codec, the
+// temporary files or the context.
+func (g *groupIterator[T, K]) Err() error {
+	return g.err
+}
+
+// Close removes the temporary files and closes the input. It is safe to
+// call Close multiple times.
+func (g *groupIterator[T, K]) Close() error {
+	g.done = true
+	g.cleanup()
+	if g.srcClosed {
+		return nil
+	}
+	g.srcClosed = true
+	return g.src.Close()
+}
+
+//
+// Unexported helpers
+//
+
+// accumulator adapts a pair of closures to Accumulator.
+type accumulator[T any] struct {
+	add    func(T) error
+	result func() any
+}
+
+func (a accumulator[T]) Add(v T) error { return a.add(v) }
+
+func (a accumulator[T]) Result() any { return a.result() }
+
+// extremum builds Min (sign -1) and Max (sign 1).
+func extremum[T any, V cmp.Ordered](name string, field func(T) V, sign int) Aggregate[T] {
+	return Aggregate[T]{Name: name, New: func() Accumulator[T] {
+		var (
+			best V
+			seen bool
+		)
+		return accumulator[T]{
+			add: func(v T) error {
+				if x := field(v); !seen || cmp.Compare(x, best)*sign > 0 {
+					best, seen = x, true
+				}
+				return nil
+			},
+			result: func() any { return best },
+		}
+	}}
+}
+
+type groupIterator[T any, K comparable] struct {
+	ctx  context.Context
+	src  transform.StructIterator[T]
+	key  func(T) K
+	aggs []Aggregate[T]
+	opt  GroupByOptions[T]
+
+	// loaded reports whether the pass over src has run.
+	loaded bool
+	// parts holds the paths of the partition files still to aggregate.
+	parts []string
+	// out holds the groups of the last pass not yielded yet.
+	out []Group[K]
+
+	cur       Group[K]
+	err       error
+	done      bool
+	srcClosed bool
+}
+
+func (g *groupIterator[T, K]) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+	g.done = true
+	g.cleanup()
+}
+
+func (g *groupIterator[T, K]) readSource() (T, bool, error) {
+	if g.src.Next() {
+		return g.src.Struct(), true, nil
+	}
+	var zero T
+	return zero, false, g.src.Err()
+}
+
+// passPartition aggregates the oldest pending partition file and removes
+// it.
+func (g *groupIterator[T, K]) passPartition() error {
+	path := g.parts[0]
+	g.parts = g.parts[1:]
+	defer os.Remove(path)
+	r, err := openRun(path, "group by", g.opt.Codec.Decode)
+	if err != nil {
+		return err
+	}
+	err = g.pass(r.next)
+	if cerr := r.close(); err == nil && cerr != nil {
+		err = fmt.Errorf("group by: %w", cerr)
+	}
+	return err
+}
+
+// pass aggregates the values returned by next into out. Values of keys
+// that do not fit in MaxGroups are written to new partition files, added
+// to parts.
+func (g *groupIterator[T, K]) pass(next func() (T, bool, error)) (err error) {
+	var (
+		index  = map[K]int{}
+		groups []Group[K]
+		accs   [][]Accumulator[T]
+		parts  []*runWriter[T]
+		// A new seed per pass spreads the keys of a partition that
+		// overflows again over new partitions.
+		seed = maphash.MakeSeed()
+	)
+	defer func() {
+		if err != nil {
+			for _, w := range parts {
+				if w != nil {
+					w.abort()
+				}
+			}
+		}
+	}()
+
+	for {
+		if err := g.ctx.Err(); err != nil {
+			return err
+		}
+		v, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		k := g.key(v)
+		i, found := index[k]
+		if !found {
+			if g.opt.MaxGroups > 0 && len(groups) >= g.opt.MaxGroups {
+				if parts == nil {
+					parts = make([]*runWriter[T], g.opt.Partitions)
+				}
+				p := maphash.Comparable(seed, k) % uint64(len(parts))
+				if parts[p] == nil {
+					if parts[p], err = createRun(g.opt.TempDir, "group by", g.opt.Codec.Encode); err != nil {
+						return err
+					}
+				}
+				if err := parts[p].write(v); err != nil {
+					return err
+				}
+				continue
+			}
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, Group[K]{Key: k})
+			accs = append(accs, g.newAccumulators())
+		}
+		for j, acc := range accs[i] {
+			if err := acc.Add(v); err != nil {
+				return fmt.Errorf("group by: %s: %w", g.aggs[j].Name, err)
+			}
+		}
+	}
+
+	for p, w := range parts {
+		if w == nil {
+			continue
+		}
+		if err := w.finish(); err != nil {
+			parts[p] = nil
+			return err
+		}
+		parts[p] = nil
+		g.parts = append(g.parts, w.path())
+	}
+	for i := range groups {
+		groups[i].Values = make([]any, len(accs[i]))
+		for j, acc := range accs[i] {
+			groups[i].Values[j] = acc.Result()
+		}
+	}
+	g.out = groups
+	return nil
+}
+
+func (g *groupIterator[T, K]) newAccumulators() []Accumulator[T] {
+	accs := make([]Accumulator[T], len(g.aggs))
+	for i, a := range g.aggs {
+		accs[i] = a.New()
+	}
+	return accs
+}
+
+// cleanup removes the pending partition files.
+func (g *groupIterator[T, K]) cleanup() {
+	for _, p := range g.parts {
+		_ = os.Remove(p)
+	}
+	g.parts = nil
+	g.out = nil
+}
@@ -0,0 +1,194 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+)
+
+type sale struct {
+	Day      string
+	Customer string
+	Amount   int
+}
+
+var saleCodec = Codec[sale]{
+	Encode: func(s sale) ([]byte, error) { return json.Marshal(s) },
+	Decode: func(b []byte) (sale, error) {
+		var s sale
+		err := json.Unmarshal(b, &s)
+		return s, err
+	},
+}
+
+var saleAggs = []Aggregate[sale]{
+	Count[sale]("count"),
+	Sum("total", func(s sale) int { return s.Amount }),
+	Min("min", func(s sale) int { return s.Amount }),
+	Max("max", func(s sale) int { return s.Amount }),
+	Avg("avg", func(s sale) int { return s.Amount }),
+	First("first", func(s sale) string { return s.Customer }),
+	Last("last", func(s sale) string { return s.Customer }),
+	CountDistinct("customers", func(s sale) string { return s.Customer }),
+}
+
+func byDay(s sale) string { return s.Day }
+
+// summarize renders the values of each group, keyed by group key.
+func summarize[K comparable](groups []Group[K]) map[K]string {
+	out := map[K]string{}
+	for _, g := range groups {
+		out[g.Key] = fmt.Sprint(g.Values...)
+	}
+	return out
+}
+
+func TestGroupBy_Aggregates(t *testing.T) {
+	src := from(
+		sale{"mon", "ann", 10},
+		sale{"tue", "bob", 5},
+		sale{"mon", "bob", 30},
+		sale{"mon", "ann", 20},
+		sale{"wed", "cat", 7},
+	)
+	got := collect(t, GroupBy(context.Background(), src, byDay, saleAggs, GroupByOptions[sale]{}))
+
+	var keys []string
+	for _, g := range got {
+		keys = append(keys, g.Key)
+	}
+	if !slices.Equal(keys, []string{"mon", "tue", "wed"}) {
+		t.Fatalf("keys = %v, want mon, tue, wed in first-seen order", keys)
+	}
+	want := []any{int64(3), 60, 10, 30, 20.0, "ann", "ann", int64(2)}
+	if !slices.Equal(got[0].Values, want) {
+		t.Fatalf("mon = %#v, want %#v", got[0].Values, want)
+	}
+	if src.closed != 1 {
+		t.Fatalf("input closed %d times, want 1", src.closed)
+	}
+}
+
+func TestGroupBy_Spill(t *testing.T) {
+	var in []sale
+	for i := range 200 {
+		in = append(in, sale{
+			Day:      fmt.Sprintf("d%02d", i%37),
+			Customer: fmt.Sprintf("c%d", i%5),
+			Amount:   i,
+		})
+	}
+	want := summarize(collect(t, GroupBy(context.Background(), from(in...), byDay, saleAggs, GroupByOptions[sale]{})))
+
+	for _, parts := range []int{2, 16} {
+		dir := t.TempDir()
+		it := GroupBy(context.Background(), from(in...), byDay, saleAggs, GroupByOptions[sale]{
+			MaxGroups:  4,
+			Codec:      saleCodec,
+			TempDir:    dir,
+			Partitions: parts,
+		})
+		groups := collect(t, it)
+		if len(groups) != len(want) {
+			t.Fatalf("Partitions %d: %d groups, want %d", parts, len(groups), len(want))
+		}
+		// JSON round trips preserve every field, so the results must match
+		// the in-memory aggregation.
+		if got := summarize(groups); !maps.Equal(got, want) {
+			t.Fatalf("Partitions %d: got %v\nwant %v", parts, got, want)
+		}
+		if n := tempEntries(t, dir); n != 0 {
+			t.Fatalf("Partitions %d: %d temporary files left", parts, n)
+		}
+	}
+}
+
+func TestGroupBy_CloseAndCancelRemoveFiles(t *testing.T) {
+	var in []sale
+	for i := range 50 {
+		in = append(in, sale{Day: fmt.Sprint(i), Amount: i})
+	}
+	opt := func(dir string) GroupByOptions[sale] {
+		return GroupByOptions[sale]{MaxGroups: 5, Codec: saleCodec, TempDir: dir, Partitions: 4}
+	}
+	aggs := []Aggregate[sale]{Count[sale]("count")}
+
+	dir := t.TempDir()
+	it := GroupBy(context.Background(), from(in...), byDay, aggs, opt(dir))
+	if !it.Next() {
+		t.Fatalf("expected a group, err: %v", it.Err())
+	}
+	if tempEntries(t, dir) == 0 {
+		t.Fatalf("expected spilled partitions")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := tempEntries(t, dir); n != 0 {
+		t.Fatalf("%d temporary files left after Close", n)
+	}
+
+	dir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	it = GroupBy(ctx, from(in...), byDay, aggs, opt(dir))
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("expected a group, err: %v", it.Err())
+	}
+	cancel()
+	if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("Err after cancel = %v", it.Err())
+	}
+	if n := tempEntries(t, dir); n != 0 {
+		t.Fatalf("%d temporary files left after cancel", n)
+	}
+}
+
+// cappedSum is a custom accumulator failing once the sum exceeds a cap.
+type cappedSum struct{ sum, cap int }
+
+func (c *cappedSum) Add(s sale) error {
+	if c.sum += s.Amount; c.sum > c.cap {
+		return fmt.Errorf("sum %d over %d", c.sum, c.cap)
+	}
+	return nil
+}
+
+func (c *cappedSum) Result() any { return c.sum }
+
+func TestGroupBy_CustomAndErrors(t *testing.T) {
+	ctx := context.Background()
+	capped := Aggregate[sale]{Name: "capped", New: func() Accumulator[sale] { return &cappedSum{cap: 25} }}
+
+	got := collect(t, GroupBy(ctx, from(sale{"mon", "ann", 10}, sale{"tue", "bob", 20}), byDay, []Aggregate[sale]{capped}, GroupByOptions[sale]{}))
+	if len(got) != 2 || got[1].Values[0] != 20 {
+		t.Fatalf("groups = %v", got)
+	}
+
+	it := GroupBy(ctx, from(sale{"mon", "ann", 10}, sale{"mon", "bob", 20}), byDay, []Aggregate[sale]{capped}, GroupByOptions[sale]{})
+	defer it.Close()
+	if it.Next() || it.Err() == nil || it.Err().Error() != "group by: capped: sum 30 over 25" {
+		t.Fatalf("Err = %v", it.Err())
+	}
+
+	inputErr := errors.New("decode failed")
+	src := &sliceIterator[sale]{vals: []sale{{Day: "mon"}}, err: inputErr}
+	it = GroupBy(ctx, src, byDay, saleAggs, GroupByOptions[sale]{})
+	defer it.Close()
+	if it.Next() || it.Err() != inputErr {
+		t.Fatalf("Err = %v, want %v", it.Err(), inputErr)
+	}
+}
+
+func TestGroupBy_PanicsWithoutCodec(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	GroupBy(context.Background(), from[sale](), byDay, saleAggs, GroupByOptions[sale]{MaxGroups: 1})
+}
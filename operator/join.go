@@ -0,0 +1,312 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// JoinKind selects which left values a join yields.
+type JoinKind int
+
+const (
+	// InnerJoin yields one Joined per pair of left and right values with
+	// equal keys.
+	InnerJoin JoinKind = iota
+	// LeftJoin yields the pairs of InnerJoin, plus one Joined with Matched
+	// false for each left value without a match.
+	LeftJoin
+	// AntiJoin yields one Joined, with Matched false, for each left value
+	// without a match.
+	AntiJoin
+)
+
+// String returns the name of the join kind.
+func (k JoinKind) String() string {
+	switch k {
+	case InnerJoin:
+		return "inner"
+	case LeftJoin:
+		return "left"
+	case AntiJoin:
+		return "anti"
+	default:
+		return fmt.Sprintf("JoinKind(%d)", int(k))
+	}
+}
+
+// Joined is a value produced by a join. Right is the zero value when
+// Matched is false.
+type Joined[L, R any] struct {
+	Left    L
+	Right   R
+	Matched bool
+}
+
+// HashJoin joins left, streamed, with right, loaded into an in-memory hash
+// table on the first call to Next, typically to enrich a feed with a
+// reference table:
+//
+//	enriched := operator.HashJoin(ctx, txs, customers,
+//	    func(t Tx) string { return t.CustomerID },
+//	    func(c Customer) string { return c.ID },
+//	    operator.LeftJoin)
+//
+// Values are yielded in the order of left; a left value matching several
+// right values yields one Joined per match, in the order of right. right is
+// closed once loaded, and left by Close. The returned iterator reports the
+// SrcMeta of the current left value.
+//
+// HashJoin panics if a key function is nil or kind is unknown.
+func HashJoin[L, R any, K comparable](ctx context.Context, left transform.StructIterator[L], right transform.StructIterator[R], leftKey func(L) K, rightKey func(R) K, kind JoinKind) transform.StructIterator[Joined[L, R]] {
+	checkJoin("HashJoin", leftKey == nil || rightKey == nil, kind)
+	h := &hashJoiner[L, R, K]{ctx: ctx, left: left, leftKey: leftKey, rightKey: rightKey, kind: kind}
+	j := &joinIterator[L, R]{right: right}
+	h.join = j
+	j.stage = newStage(ctx, left, h.next)
+	return j
+}
+
+// MergeJoin joins left and right, both sorted by key in ascending order
+// according to cmp, which follows the convention of slices.SortFunc.
+// Only the right values sharing the current key are held in memory, so
+// inputs of any size can be joined, e.g. after Sort.
+//
+// MergeJoin yields the same values as HashJoin, in the same order. It
+// fails with an error if either input turns out not to be sorted. Close
+// closes both inputs. The returned iterator reports the SrcMeta of the
+// current left value.
+//
+// MergeJoin panics if a key function or cmp is nil, or kind is unknown.
+func MergeJoin[L, R, K any](ctx context.Context, left transform.StructIterator[L], right transform.StructIterator[R], leftKey func(L) K, rightKey func(R) K, cmp func(a, b K) int, kind JoinKind) transform.StructIterator[Joined[L, R]] {
+	checkJoin("MergeJoin", leftKey == nil || rightKey == nil || cmp == nil, kind)
+	m := &mergeJoiner[L, R, K]{left: left, right: right, leftKey: leftKey, rightKey: rightKey, cmp: cmp, kind: kind}
+	j := &joinIterator[L, R]{right: right}
+	j.stage = newStage(ctx, left, m.next)
+	return j
+}
+
+//
+// Unexported helpers
+//
+
+func checkJoin(op string, missing bool, kind JoinKind) {
+	if missing {
+		panic("operator." + op + ": key functions are required")
+	}
+	if kind < InnerJoin || kind > AntiJoin {
+		panic(fmt.Sprintf("operator.%s: unknown %v", op, kind))
+	}
+}
+
+// joinIterator is a stage over the left input that also owns the right
+// input.
+type joinIterator[L, R any] struct {
+	*stage[L, Joined[L, R]]
+	right       transform.StructIterator[R]
+	rightClosed bool
+}
+
+func (j *joinIterator[L, R]) closeRight() error {
+	if j.rightClosed {
+		return nil
+	}
+	j.rightClosed = true
+	return j.right.Close()
+}
+
+// Close closes both inputs.
+func (j *joinIterator[L, R]) Close() error {
+	err := j.stage.Close()
+	if cerr := j.closeRight(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type hashJoiner[L, R any, K comparable] struct {
+	ctx      context.Context
+	left     transform.StructIterator[L]
+	leftKey  func(L) K
+	rightKey func(R) K
+	kind     JoinKind
+	join     *joinIterator[L, R]
+
+	table map[K][]R
+	// cur and matches hold the current left value and its matches not
+	// yielded yet.
+	cur     L
+	matches []R
+}
+
+func (h *hashJoiner[L, R, K]) next() (Joined[L, R], bool, error) {
+	var zero Joined[L, R]
+	if h.table == nil {
+		if err := h.build(); err != nil {
+			return zero, false, err
+		}
+	}
+	for {
+		if len(h.matches) > 0 {
+			r := h.matches[0]
+			h.matches = h.matches[1:]
+			return Joined[L, R]{Left: h.cur, Right: r, Matched: true}, true, nil
+		}
+		if !h.left.Next() {
+			return zero, false, nil
+		}
+		l := h.left.Struct()
+		ms := h.table[h.leftKey(l)]
+		if len(ms) == 0 {
+			if h.kind != InnerJoin {
+				return Joined[L, R]{Left: l}, true, nil
+			}
+			continue
+		}
+		if h.kind != AntiJoin {
+			h.cur, h.matches = l, ms
+		}
+	}
+}
+
+// build loads the right input into the table and closes it.
+func (h *hashJoiner[L, R, K]) build() error {
+	right := h.join.right
+	table := map[K][]R{}
+	for right.Next() {
+		if err := h.ctx.Err(); err != nil {
+			return err
+		}
+		r := right.Struct()
+		k := h.rightKey(r)
+		table[k] = append(table[k], r)
+	}
+	if err := right.Err(); err != nil {
+		return err
+	}
+	if err := h.join.closeRight(); err != nil {
+		return err
+	}
+	h.table = table
+	return nil
+}
+
+type mergeJoiner[L, R, K any] struct {
+	left     transform.StructIterator[L]
+	right    transform.StructIterator[R]
+	leftKey  func(L) K
+	rightKey func(R) K
+	cmp      func(a, b K) int
+	kind     JoinKind
+
+	// head is the next right value, read ahead of group.
+	head    R
+	hasHead bool
+	// rightDone reports that right is exhausted.
+	rightDone bool
+	// group holds the right values sharing groupKey.
+	group    []R
+	groupKey K
+	hasGroup bool
+
+	prevKey K
+	hasPrev bool
+	cur     L
+	matches []R
+}
+
+var errUnsorted = errors.New("merge join: input not sorted by key")
+
+func (m *mergeJoiner[L, R, K]) next() (Joined[L, R], bool, error) {
+	var zero Joined[L, R]
+	for {
+		if len(m.matches) > 0 {
+			r := m.matches[0]
+			m.matches = m.matches[1:]
+			return Joined[L, R]{Left: m.cur, Right: r, Matched: true}, true, nil
+		}
+		if m.kind == InnerJoin && m.rightDone && !m.hasGroup {
+			return zero, false, nil
+		}
+		if !m.left.Next() {
+			return zero, false, nil
+		}
+		l := m.left.Struct()
+		k := m.leftKey(l)
+		if m.hasPrev && m.cmp(k, m.prevKey) < 0 {
+			return zero, false, fmt.Errorf("%w (left)", errUnsorted)
+		}
+		m.prevKey, m.hasPrev = k, true
+
+		for !m.hasGroup || m.cmp(m.groupKey, k) < 0 {
+			ok, err := m.loadGroup()
+			if err != nil {
+				return zero, false, err
+			}
+			if !ok {
+				break
+			}
+		}
+		if !m.hasGroup || m.cmp(m.groupKey, k) != 0 {
+			if m.kind != InnerJoin {
+				return Joined[L, R]{Left: l}, true, nil
+			}
+			continue
+		}
+		if m.kind != AntiJoin {
+			m.cur, m.matches = l, m.group
+		}
+	}
+}
+
+// loadGroup replaces group with the next run of right values sharing a
+// key. It reports false once right is exhausted.
+func (m *mergeJoiner[L, R, K]) loadGroup() (bool, error) {
+	m.hasGroup = false
+	m.group = m.group[:0]
+	if !m.hasHead {
+		if ok, err := m.fetch(); !ok {
+			return false, err
+		}
+	}
+	m.groupKey = m.rightKey(m.head)
+	m.group = append(m.group, m.head)
+	m.hasGroup = true
+	for {
+		ok, err := m.fetch()
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return true, nil
+		}
+		switch c := m.cmp(m.rightKey(m.head), m.groupKey); {
+		case c == 0:
+			m.group = append(m.group, m.head)
+		case c < 0:
+			return false, fmt.Errorf("%w (right)", errUnsorted)
+		default:
+			return true, nil
+		}
+	}
+}
+
+// fetch reads the next right value into head.
+func (m *mergeJoiner[L, R, K]) fetch() (bool, error) {
+	m.hasHead = false
+	if m.rightDone {
+		return false, nil
+	}
+	if !m.right.Next() {
+		m.rightDone = true
+		return false, m.right.Err()
+	}
+	m.head, m.hasHead = m.right.Struct(), true
+	return true, nil
+}
@@ -0,0 +1,135 @@
+package operator
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+type tx struct {
+	ID       int
+	Customer string
+}
+
+type customer struct {
+	ID   string
+	Name string
+}
+
+func txCustomer(t tx) string       { return t.Customer }
+func customerID(c customer) string { return c.ID }
+
+// render renders joined values as "txID:name" or "txID:-" when unmatched.
+func render(js []Joined[tx, customer]) string {
+	var parts []string
+	for _, j := range js {
+		name := "-"
+		if j.Matched {
+			name = j.Right.Name
+		}
+		parts = append(parts, fmt.Sprintf("%d:%s", j.Left.ID, name))
+	}
+	return strings.Join(parts, " ")
+}
+
+type joinFunc func(ctx context.Context, l transform.StructIterator[tx], r transform.StructIterator[customer], kind JoinKind) transform.StructIterator[Joined[tx, customer]]
+
+var joins = map[string]joinFunc{
+	"hash": func(ctx context.Context, l transform.StructIterator[tx], r transform.StructIterator[customer], kind JoinKind) transform.StructIterator[Joined[tx, customer]] {
+		return HashJoin(ctx, l, r, txCustomer, customerID, kind)
+	},
+	"merge": func(ctx context.Context, l transform.StructIterator[tx], r transform.StructIterator[customer], kind JoinKind) transform.StructIterator[Joined[tx, customer]] {
+		return MergeJoin(ctx, l, r, txCustomer, customerID, cmp.Compare[string], kind)
+	},
+}
+
+func TestJoins(t *testing.T) {
+	// Both inputs are sorted by key so that the merge join accepts them;
+	// c2 has two matches and c4 has none.
+	txs := []tx{{1, "c1"}, {2, "c2"}, {3, "c2"}, {4, "c4"}, {5, "c5"}}
+	customers := []customer{{"c0", "zed"}, {"c1", "ann"}, {"c2", "bob"}, {"c2", "bea"}, {"c5", "eve"}}
+	want := map[JoinKind]string{
+		InnerJoin: "1:ann 2:bob 2:bea 3:bob 3:bea 5:eve",
+		LeftJoin:  "1:ann 2:bob 2:bea 3:bob 3:bea 4:- 5:eve",
+		AntiJoin:  "4:-",
+	}
+	for name, join := range joins {
+		for kind, w := range want {
+			l, r := from(txs...), from(customers...)
+			got := collect(t, join(context.Background(), l, r, kind))
+			if d := render(got); d != w {
+				t.Fatalf("%s %v:\n got %s\nwant %s", name, kind, d, w)
+			}
+			if l.closed != 1 || r.closed != 1 {
+				t.Fatalf("%s %v: inputs closed %d and %d times, want 1", name, kind, l.closed, r.closed)
+			}
+		}
+	}
+}
+
+func TestJoins_EmptyRight(t *testing.T) {
+	for name, join := range joins {
+		got := collect(t, join(context.Background(), from(tx{1, "c1"}, tx{2, "c2"}), from[customer](), LeftJoin))
+		if d := render(got); d != "1:- 2:-" {
+			t.Fatalf("%s: got %s", name, d)
+		}
+	}
+}
+
+func TestJoins_MetaFromLeft(t *testing.T) {
+	for name, join := range joins {
+		l := sourced([]tx{{1, "c1"}, {2, "c1"}}, "a.csv", "b.csv")
+		it := join(context.Background(), l, from(customer{"c1", "ann"}), InnerJoin)
+		var srcs []string
+		for it.Next() {
+			srcs = append(srcs, it.(transform.MetaProvider).Meta().Name)
+		}
+		it.Close()
+		if strings.Join(srcs, ",") != "a.csv,b.csv" {
+			t.Fatalf("%s: sources = %v", name, srcs)
+		}
+	}
+}
+
+func TestJoins_Errors(t *testing.T) {
+	rightErr := errors.New("reference unreadable")
+	for name, join := range joins {
+		r := &sliceIterator[customer]{vals: []customer{{"c1", "ann"}}, err: rightErr}
+		it := join(context.Background(), from(tx{1, "c1"}, tx{2, "c2"}), r, LeftJoin)
+		for it.Next() {
+		}
+		if !errors.Is(it.Err(), rightErr) {
+			t.Fatalf("%s: Err = %v, want %v", name, it.Err(), rightErr)
+		}
+		it.Close()
+	}
+
+	ctx := context.Background()
+	unsortedLeft := MergeJoin(ctx, from(tx{1, "c2"}, tx{2, "c1"}), from(customer{"c1", "ann"}), txCustomer, customerID, cmp.Compare[string], LeftJoin)
+	unsortedRight := MergeJoin(ctx, from(tx{1, "c1"}), from(customer{"c2", "bob"}, customer{"c1", "ann"}), txCustomer, customerID, cmp.Compare[string], LeftJoin)
+	for _, it := range []transform.StructIterator[Joined[tx, customer]]{unsortedLeft, unsortedRight} {
+		for it.Next() {
+		}
+		if !errors.Is(it.Err(), errUnsorted) {
+			t.Fatalf("Err = %v, want %v", it.Err(), errUnsorted)
+		}
+		it.Close()
+	}
+}
+
+func TestJoins_CloseBeforeNext(t *testing.T) {
+	for name, join := range joins {
+		l, r := from(tx{1, "c1"}), from(customer{"c1", "ann"})
+		if err := join(context.Background(), l, r, InnerJoin).Close(); err != nil {
+			t.Fatalf("%s: Close: %v", name, err)
+		}
+		if l.closed != 1 || r.closed != 1 {
+			t.Fatalf("%s: inputs closed %d and %d times, want 1", name, l.closed, r.closed)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+// Package operator provides generic stream operators over
+// transform.StructIterator values, so that pipelines can be assembled
+// without hand-rolled loops:
+//
+//	it, _ := tr.Transform(ctx, mux, mapFn)          // StructIterator[Event]
+//	it = operator.Filter(ctx, it, isValid)
+//	ids := operator.Map(ctx, it, func(e Event) (string, error) {
+//	    return e.ID, nil
+//	})
+//	ids = operator.Distinct(ctx, ids, func(id string) string { return id })
+//	defer ids.Close()
+//
+// Every operator takes ownership of its input iterators:
+//
+//   - Close closes the inputs; it is safe to call several times.
+//   - Err reports the first error, whether it comes from an input, from a
+//     user function, or from the context.
+//   - Next checks the context before pulling from the inputs, and between
+//     the values it discards, and stops with ctx.Err() once the context is
+//     canceled.
+//
+// The iterators returned by the operators implement transform.MetaProvider,
+// reporting the SrcMeta of the input value the current value derives from,
+// so that provenance survives a chain of operators.
+//
+// Operators are lazy and pull one value at a time. Like their inputs, the
+// returned iterators are not safe for concurrent use.
+package operator
+
+import (
+	"context"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Filter yields the values of it for which keep returns true.
+func Filter[T any](ctx context.Context, it transform.StructIterator[T], keep func(T) bool) transform.StructIterator[T] {
+	return newStage(ctx, it, func() (T, bool, error) {
+		var zero T
+		for it.Next() {
+			if v := it.Struct(); keep(v) {
+				return v, true, nil
+			}
+			if err := ctx.Err(); err != nil {
+				return zero, false, err
+			}
+		}
+		return zero, false, nil
+	})
+}
+
+// Map yields fn applied to each value of it. An error returned by fn ends
+// the iteration and is reported by Err.
+func Map[T, U any](ctx context.Context, it transform.StructIterator[T], fn func(T) (U, error)) transform.StructIterator[U] {
+	return newStage(ctx, it, func() (U, bool, error) {
+		if !it.Next() {
+			var zero U
+			return zero, false, nil
+		}
+		v, err := fn(it.Struct())
+		return v, err == nil, err
+	})
+}
+
+// FlatMap yields, in order, the values of the slices fn returns for each
+// value of it. Empty slices yield nothing. An error returned by fn ends the
+// iteration and is reported by Err.
+func FlatMap[T, U any](ctx context.Context, it transform.StructIterator[T], fn func(T) ([]U, error)) transform.StructIterator[U] {
+	var pending []U
+	return newStage(ctx, it, func() (U, bool, error) {
+		var zero U
+		for len(pending) == 0 {
+			if !it.Next() {
+				return zero, false, nil
+			}
+			vs, err := fn(it.Struct())
+			if err != nil {
+				return zero, false, err
+			}
+			if err := ctx.Err(); err != nil {
+				return zero, false, err
+			}
+			pending = vs
+		}
+		v := pending[0]
+		pending[0] = zero
+		pending = pending[1:]
+		return v, true, nil
+	})
+}
+
+// Take yields at most the first n values of it. It does not pull from it
+// once n values have been yielded.
+func Take[T any](ctx context.Context, it transform.StructIterator[T], n int) transform.StructIterator[T] {
+	taken := 0
+	return newStage(ctx, it, func() (T, bool, error) {
+		if taken >= n || !it.Next() {
+			var zero T
+			return zero, false, nil
+		}
+		taken++
+		return it.Struct(), true, nil
+	})
+}
+
+// Skip discards the first n values of it and yields the rest.
+func Skip[T any](ctx context.Context, it transform.StructIterator[T], n int) transform.StructIterator[T] {
+	skipped := 0
+	return newStage(ctx, it, func() (T, bool, error) {
+		var zero T
+		for ; skipped < n; skipped++ {
+			if err := ctx.Err(); err != nil {
+				return zero, false, err
+			}
+			if !it.Next() {
+				return zero, false, nil
+			}
+		}
+		if !it.Next() {
+			return zero, false, nil
+		}
+		return it.Struct(), true, nil
+	})
+}
+
+// Distinct yields the values of it whose key, as returned by key, has not
+// been seen before. Keys are kept in memory for the whole iteration.
+func Distinct[T any, K comparable](ctx context.Context, it transform.StructIterator[T], key func(T) K) transform.StructIterator[T] {
+	seen := map[K]struct{}{}
+	return newStage(ctx, it, func() (T, bool, error) {
+		var zero T
+		for it.Next() {
+			v := it.Struct()
+			k := key(v)
+			if _, dup := seen[k]; !dup {
+				seen[k] = struct{}{}
+				return v, true, nil
+			}
+			if err := ctx.Err(); err != nil {
+				return zero, false, err
+			}
+		}
+		return zero, false, nil
+	})
+}
+
+// Peek calls fn with each value of it as it is yielded, for logging,
+// metrics or other side effects, and yields the values unchanged.
+func Peek[T any](ctx context.Context, it transform.StructIterator[T], fn func(T)) transform.StructIterator[T] {
+	return newStage(ctx, it, func() (T, bool, error) {
+		if !it.Next() {
+			var zero T
+			return zero, false, nil
+		}
+		v := it.Struct()
+		fn(v)
+		return v, true, nil
+	})
+}
+
+// Concat yields the values of each iterator in turn. Each input is closed
+// as soon as it is exhausted; iteration stops at the first input that
+// fails.
+func Concat[T any](ctx context.Context, its ...transform.StructIterator[T]) transform.StructIterator[T] {
+	return &concatIterator[T]{ctx: ctx, its: its}
+}
+
+// FromRecords adapts a RecordIterator, such as a decoder's output, to a
+// StructIterator so that it can be used with the operators, e.g. as the
+// reference side of HashJoin. Each record is copied with
+// transform.CopyRecord, so values remain valid after Next. The returned
+// iterator reports the SrcMeta of the current record.
+func FromRecords(ctx context.Context, it transform.RecordIterator) transform.StructIterator[transform.Extractor] {
+	return &recordsIterator{ctx: ctx, src: it}
+}
+
+//
+// Unexported helpers
+//
+
+// stage is the StructIterator returned by single-input operators. advance
+// produces the next value from src and reports false at the end.
+type stage[T, U any] struct {
+	ctx     context.Context
+	src     transform.StructIterator[T]
+	advance func() (U, bool, error)
+
+	cur  U
+	err  error
+	done bool
+}
+
+func newStage[T, U any](ctx context.Context, src transform.StructIterator[T], advance func() (U, bool, error)) *stage[T, U] {
+	return &stage[T, U]{ctx: ctx, src: src, advance: advance}
+}
+
+func (s *stage[T, U]) Next() bool {
+	if s.done {
+		return false
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		s.done = true
+		return false
+	}
+	v, ok, err := s.advance()
+	if err != nil {
+		s.err = err
+	}
+	if !ok {
+		var zero U
+		s.cur = zero
+		s.done = true
+		return false
+	}
+	s.cur = v
+	return true
+}
+
+func (s *stage[T, U]) Struct() U {
+	return s.cur
+}
+
+func (s *stage[T, U]) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.src.Err()
+}
+
+// Meta returns the SrcMeta of the input value the current value derives
+// from, or the zero SrcMeta if the input does not implement
+// transform.MetaProvider.
+func (s *stage[T, U]) Meta() connector.SrcMeta {
+	return transform.MetaOf(s.src)
+}
+
+func (s *stage[T, U]) Close() error {
+	s.done = true
+	return s.src.Close()
+}
+
+type concatIterator[T any] struct {
+	ctx context.Context
+	// its holds the inputs not exhausted yet; its[0] is the active one.
+	its []transform.StructIterator[T]
+
+	cur T
+	err error
+}
+
+func (c *concatIterator[T]) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if err := c.ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+	for len(c.its) > 0 {
+		it := c.its[0]
+		if it.Next() {
+			c.cur = it.Struct()
+			return true
+		}
+		err := it.Err()
+		if cerr := it.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			c.err = err
+			return false
+		}
+		c.its = c.its[1:]
+	}
+	var zero T
+	c.cur = zero
+	return false
+}
+
+func (c *concatIterator[T]) Struct() T {
+	return c.cur
+}
+
+func (c *concatIterator[T]) Err() error {
+	return c.err
+}
+
+// Meta returns the SrcMeta of the current value, or the zero SrcMeta if
+// the active input does not implement transform.MetaProvider.
+func (c *concatIterator[T]) Meta() connector.SrcMeta {
+	if len(c.its) == 0 {
+		return connector.SrcMeta{}
+	}
+	return transform.MetaOf(c.its[0])
+}
+
+func (c *concatIterator[T]) Close() error {
+	var first error
+	for _, it := range c.its {
+		if err := it.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.its = nil
+	return first
+}
+
+type recordsIterator struct {
+	ctx context.Context
+	src transform.RecordIterator
+
+	cur  transform.Extractor
+	err  error
+	done bool
+}
+
+func (r *recordsIterator) Next() bool {
+	if r.done {
+		return false
+	}
+	if err := r.ctx.Err(); err != nil {
+		r.err = err
+		r.done = true
+		return false
+	}
+	if !r.src.Next() {
+		r.cur = nil
+		r.done = true
+		return false
+	}
+	r.cur = transform.CopyRecord(r.src.Record())
+	return true
+}
+
+func (r *recordsIterator) Struct() transform.Extractor {
+	return r.cur
+}
+
+func (r *recordsIterator) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.src.Err()
+}
+
+// Meta returns the SrcMeta of the current record.
+func (r *recordsIterator) Meta() connector.SrcMeta {
+	if r.cur == nil {
+		return connector.SrcMeta{}
+	}
+	return r.cur.Meta()
+}
+
+func (r *recordsIterator) Close() error {
+	r.done = true
+	return r.src.Close()
+}
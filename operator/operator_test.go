@@ -0,0 +1,352 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/transform"
+)
+
+// sliceIterator is a StructIterator over a slice that records how many
+// values were pulled and whether it was closed.
+type sliceIterator[T any] struct {
+	vals   []T
+	idx    int
+	err    error
+	closed int
+}
+
+func (s *sliceIterator[T]) Next() bool {
+	if s.closed > 0 || s.idx >= len(s.vals) {
+		return false
+	}
+	s.idx++
+	return true
+}
+
+func (s *sliceIterator[T]) Struct() T    { return s.vals[s.idx-1] }
+func (s *sliceIterator[T]) Err() error   { return s.err }
+func (s *sliceIterator[T]) Close() error { s.closed++; return nil }
+
+func from[T any](vals ...T) *sliceIterator[T] {
+	return &sliceIterator[T]{vals: vals}
+}
+
+func collect[T any](t *testing.T, it transform.StructIterator[T]) []T {
+	t.Helper()
+	defer it.Close()
+	var out []T
+	for it.Next() {
+		out = append(out, it.Struct())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	return out
+}
+
+func TestOperators(t *testing.T) {
+	ctx := context.Background()
+	even := func(n int) bool { return n%2 == 0 }
+	cases := []struct {
+		name string
+		it   transform.StructIterator[int]
+		want []int
+	}{
+		{name: "filter", it: Filter(ctx, from(1, 2, 3, 4), even), want: []int{2, 4}},
+		{name: "filter none", it: Filter(ctx, from(1, 3), even), want: nil},
+		{name: "take", it: Take(ctx, from(1, 2, 3), 2), want: []int{1, 2}},
+		{name: "take more", it: Take(ctx, from(1, 2), 5), want: []int{1, 2}},
+		{name: "take zero", it: Take(ctx, from(1, 2), 0), want: nil},
+		{name: "skip", it: Skip(ctx, from(1, 2, 3), 2), want: []int{3}},
+		{name: "skip all", it: Skip(ctx, from(1, 2), 5), want: nil},
+		{name: "distinct", it: Distinct(ctx, from(1, 2, 1, 3, 2), func(n int) int { return n }), want: []int{1, 2, 3}},
+		{name: "distinct by key", it: Distinct(ctx, from(1, 2, 3, 4, 5), func(n int) bool { return even(n) }), want: []int{1, 2}},
+		{name: "concat", it: Concat(ctx, from(1), from[int](), from(2, 3)), want: []int{1, 2, 3}},
+		{name: "concat none", it: Concat[int](ctx), want: nil},
+		{
+			name: "flat map",
+			it: FlatMap(ctx, from(0, 1, 2, 3), func(n int) ([]int, error) {
+				return slices.Repeat([]int{n}, n), nil
+			}),
+			want: []int{1, 2, 2, 3, 3, 3},
+		},
+		{name: "chained", it: Take(ctx, Skip(ctx, Filter(ctx, from(1, 2, 3, 4, 5, 6, 7, 8), even), 1), 2), want: []int{4, 6}},
+	}
+	for _, tc := range cases {
+		if got := collect(t, tc.it); !slices.Equal(got, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	ctx := context.Background()
+	got := collect(t, Map(ctx, from(1, 2), func(n int) (string, error) {
+		return strconv.Itoa(n * 10), nil
+	}))
+	if !slices.Equal(got, []string{"10", "20"}) {
+		t.Fatalf("got %q", got)
+	}
+
+	wantErr := errors.New("bad value")
+	src := from(1, 2, 3)
+	it := Map(ctx, src, func(n int) (int, error) {
+		if n == 2 {
+			return 0, wantErr
+		}
+		return n, nil
+	})
+	var vals []int
+	for it.Next() {
+		vals = append(vals, it.Struct())
+	}
+	if !slices.Equal(vals, []int{1}) || it.Err() != wantErr {
+		t.Fatalf("values = %v, Err = %v", vals, it.Err())
+	}
+	if it.Next() {
+		t.Fatalf("Next after error = true")
+	}
+	if err := it.Close(); err != nil || src.closed == 0 {
+		t.Fatalf("Close = %v, source closed %d times", err, src.closed)
+	}
+}
+
+func TestFlatMap_Error(t *testing.T) {
+	wantErr := errors.New("split failed")
+	it := FlatMap(context.Background(), from("a b", "c"), func(s string) ([]string, error) {
+		if s == "c" {
+			return nil, wantErr
+		}
+		return strings.Fields(s), nil
+	})
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		got = append(got, it.Struct())
+	}
+	if !slices.Equal(got, []string{"a", "b"}) || it.Err() != wantErr {
+		t.Fatalf("values = %q, Err = %v", got, it.Err())
+	}
+}
+
+func TestPeek(t *testing.T) {
+	var seen []int
+	got := collect(t, Peek(context.Background(), from(1, 2), func(n int) { seen = append(seen, n) }))
+	if !slices.Equal(got, []int{1, 2}) || !slices.Equal(seen, got) {
+		t.Fatalf("values = %v, peeked = %v", got, seen)
+	}
+}
+
+func TestTake_DoesNotOverPull(t *testing.T) {
+	src := from(1, 2, 3, 4)
+	it := Take(context.Background(), src, 2)
+	collect(t, it)
+	if src.idx != 2 {
+		t.Fatalf("source advanced %d times, want 2", src.idx)
+	}
+	if src.closed != 1 {
+		t.Fatalf("source closed %d times, want 1", src.closed)
+	}
+}
+
+func TestInputErrorPropagates(t *testing.T) {
+	wantErr := errors.New("decode failed")
+	src := &sliceIterator[int]{vals: []int{1}, err: wantErr}
+	it := Filter(context.Background(), src, func(int) bool { return true })
+	defer it.Close()
+	for it.Next() {
+	}
+	if it.Err() != wantErr {
+		t.Fatalf("Err = %v, want %v", it.Err(), wantErr)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	src := from(1, 2, 3)
+	it := Peek(ctx, src, func(int) {})
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("expected a first value")
+	}
+	cancel()
+	if it.Next() {
+		t.Fatalf("Next after cancel = true")
+	}
+	if !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("Err = %v, want context.Canceled", it.Err())
+	}
+	if src.idx != 1 {
+		t.Fatalf("source advanced after cancel")
+	}
+
+	c := Concat(ctx, from(1))
+	defer c.Close()
+	if c.Next() || !errors.Is(c.Err(), context.Canceled) {
+		t.Fatalf("Concat after cancel: Err = %v", c.Err())
+	}
+}
+
+func TestCancellation_WhileDiscarding(t *testing.T) {
+	// Each stage discards the values from the second on, and cancels the
+	// context at the second; it must stop there rather than drain its
+	// input.
+	stages := map[string]func(context.Context, *sliceIterator[int], func()) transform.StructIterator[int]{
+		"filter": func(ctx context.Context, src *sliceIterator[int], cancel func()) transform.StructIterator[int] {
+			return Filter(ctx, src, func(n int) bool {
+				if n == 2 {
+					cancel()
+				}
+				return false
+			})
+		},
+		"distinct": func(ctx context.Context, src *sliceIterator[int], cancel func()) transform.StructIterator[int] {
+			return Distinct(ctx, src, func(n int) int {
+				if n == 2 {
+					cancel()
+				}
+				return 0
+			})
+		},
+		"skip": func(ctx context.Context, src *sliceIterator[int], cancel func()) transform.StructIterator[int] {
+			return Skip(ctx, Peek(context.Background(), src, func(n int) {
+				if n == 2 {
+					cancel()
+				}
+			}), 10)
+		},
+		"flat map": func(ctx context.Context, src *sliceIterator[int], cancel func()) transform.StructIterator[int] {
+			return FlatMap(ctx, src, func(n int) ([]int, error) {
+				if n == 2 {
+					cancel()
+				}
+				return nil, nil
+			})
+		},
+	}
+	for name, stage := range stages {
+		ctx, cancel := context.WithCancel(context.Background())
+		src := from(1, 2, 3, 4, 5)
+		it := stage(ctx, src, cancel)
+		if name == "distinct" {
+			// The first value has a new key and is yielded.
+			if !it.Next() {
+				t.Fatalf("%s: expected a first value", name)
+			}
+		}
+		if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+			t.Fatalf("%s: Err = %v, want context.Canceled", name, it.Err())
+		}
+		if src.idx != 2 {
+			t.Fatalf("%s: source advanced to %d after cancel", name, src.idx)
+		}
+		it.Close()
+		cancel()
+	}
+}
+
+func TestConcat_ClosesInputs(t *testing.T) {
+	a, b, c := from(1), from(2), from(3)
+	it := Concat(context.Background(), a, b, c)
+	if !it.Next() || !it.Next() || it.Struct() != 2 {
+		t.Fatalf("expected to reach the second input")
+	}
+	if a.closed != 1 {
+		t.Fatalf("exhausted input closed %d times, want 1", a.closed)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if b.closed != 1 || c.closed != 1 {
+		t.Fatalf("remaining inputs closed %d and %d times, want 1", b.closed, c.closed)
+	}
+
+	wantErr := errors.New("second failed")
+	it = Concat(context.Background(), from(1), &sliceIterator[int]{err: wantErr}, from(3))
+	defer it.Close()
+	var got []int
+	for it.Next() {
+		got = append(got, it.Struct())
+	}
+	if !slices.Equal(got, []int{1}) || it.Err() != wantErr {
+		t.Fatalf("values = %v, Err = %v", got, it.Err())
+	}
+}
+
+// reusedRecords is a RecordIterator that reuses one buffer for all rows,
+// like a decoder does.
+type reusedRecords struct {
+	rows   [][]string
+	buf    []string
+	idx    int
+	closed bool
+}
+
+func (r *reusedRecords) Next() bool {
+	if r.idx >= len(r.rows) {
+		return false
+	}
+	r.buf = append(r.buf[:0], r.rows[r.idx]...)
+	r.idx++
+	return true
+}
+
+func (r *reusedRecords) Record() transform.Extractor { return bufRecord{r.buf, r.idx} }
+func (r *reusedRecords) Err() error                  { return nil }
+func (r *reusedRecords) Close() error                { r.closed = true; return nil }
+
+type bufRecord struct {
+	fields []string
+	row    int
+}
+
+func (b bufRecord) ByIndex(i int) (string, bool) {
+	if i < 0 || i >= len(b.fields) {
+		return "", false
+	}
+	return b.fields[i], true
+}
+
+func (b bufRecord) ByName(name string) (string, bool) {
+	switch name {
+	case "id":
+		return b.ByIndex(0)
+	case "name":
+		return b.ByIndex(1)
+	}
+	return "", false
+}
+
+func (b bufRecord) Len() int        { return len(b.fields) }
+func (b bufRecord) Names() []string { return []string{"id", "name"} }
+func (b bufRecord) Meta() connector.SrcMeta {
+	return connector.SrcMeta{Name: "ref.csv", ByteOffset: int64(b.row) * 10}
+}
+
+func TestFromRecords(t *testing.T) {
+	src := &reusedRecords{rows: [][]string{{"1", "ann"}, {"2", "bob"}}}
+	it := FromRecords(context.Background(), src)
+	var metas []int64
+	var recs []transform.Extractor
+	for it.Next() {
+		recs = append(recs, it.Struct())
+		metas = append(metas, it.(transform.MetaProvider).Meta().ByteOffset)
+	}
+	if err := it.Close(); err != nil || !src.closed {
+		t.Fatalf("Close = %v, closed %v", err, src.closed)
+	}
+	var got []string
+	for _, rec := range recs {
+		name, _ := rec.ByName("name")
+		got = append(got, name)
+	}
+	if !slices.Equal(got, []string{"ann", "bob"}) || !slices.Equal(metas, []int64{10, 20}) {
+		t.Fatalf("names = %v, offsets = %v", got, metas)
+	}
+}
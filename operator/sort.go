@@ -0,0 +1,552 @@
+package operator
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Codec converts values to and from bytes, so that operators can spill
+// them to disk. Each call to Decode gets a slice of its own, which the
+// decoded value may keep, e.g. as a []byte payload.
+type Codec[T any] struct {
+	Encode func(T) ([]byte, error)
+	Decode func([]byte) (T, error)
+}
+
+// SortOptions configures Sort.
+//
+// MemoryBudget is the approximate number of bytes of values Sort keeps in
+// memory before spilling a sorted run to a temporary file; it defaults to
+// 64 MiB. SizeOf reports the size of a value; when nil, the length of its
+// encoding is used, at the cost of encoding every value once more.
+//
+// TempDir is where Sort creates the directory of its run files; it
+// defaults to os.TempDir().
+// MaxOpenRuns caps the number of run files merged at once, and therefore
+// the number of open files; larger inputs are merged in several passes.
+// It defaults to 64.
+type SortOptions[T any] struct {
+	MemoryBudget int64
+	SizeOf       func(T) int64
+	TempDir      string
+	MaxOpenRuns  int
+}
+
+// Sort returns the values of it ordered by cmp, which follows the
+// convention of slices.SortFunc. The sort is stable.
+//
+// Sort consumes the whole input on the first call to Next, closing it once
+// drained. Inputs that fit in opt.MemoryBudget are sorted in memory;
+// larger inputs are split into sorted runs written to temporary files with
+// codec, which are then merged back with a k-way merge.
+//
+// Temporary files are removed when the output is exhausted, when Next
+// fails, by Close, and as soon as ctx is canceled, even if the iterator is
+// abandoned; callers must still call Close to release the input. The
+// returned iterator does not implement transform.MetaProvider.
+//
+// Sort panics if cmp or a codec function is nil.
+func Sort[T any](ctx context.Context, it transform.StructIterator[T], cmp func(a, b T) int, codec Codec[T], opt SortOptions[T]) transform.StructIterator[T] {
+	if cmp == nil || codec.Encode == nil || codec.Decode == nil {
+		panic("operator.Sort: cmp, codec.Encode and codec.Decode are required")
+	}
+	if opt.MemoryBudget <= 0 {
+		opt.MemoryBudget = 64 << 20
+	}
+	if opt.MaxOpenRuns < 2 {
+		opt.MaxOpenRuns = 64
+	}
+	return &sortIterator[T]{ctx: ctx, src: it, cmp: cmp, codec: codec, opt: opt}
+}
+
+// Next returns the next value in sorted order. The first call sorts the
+// input.
+func (s *sortIterator[T]) Next() bool {
+	if s.done {
+		return false
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.fail(err)
+		return false
+	}
+	if s.out == nil {
+		if err := s.load(); err != nil {
+			s.fail(err)
+			return false
+		}
+	}
+	v, ok, err := s.out.next()
+	if err != nil {
+		s.fail(err)
+		return false
+	}
+	if !ok {
+		s.done = true
+		s.cleanup()
+		return false
+	}
+	s.cur = v
+	return true
+}
+
+// Struct returns the current value.
+func (s *sortIterator[T]) Struct() T {
+	return s.cur
+}
+
+// Err reports the first error of the input, the codec, the temporary
+// files or the context.
+func (s *sortIterator[T]) Err() error {
+	return s.err
+}
+
+// Close removes the temporary files and closes the input. It is safe to
+// call Close multiple times.
+func (s *sortIterator[T]) Close() error {
+	s.done = true
+	s.cleanup()
+	if s.srcClosed {
+		return nil
+	}
+	s.srcClosed = true
+	return s.src.Close()
+}
+
+//
+// Unexported helpers
+//
+
+type sortIterator[T any] struct {
+	ctx   context.Context
+	src   transform.StructIterator[T]
+	cmp   func(a, b T) int
+	codec Codec[T]
+	opt   SortOptions[T]
+
+	// mem buffers the values of the run being built.
+	mem []T
+	// runs holds the paths of the spilled runs, in input order.
+	runs []string
+	// runDir holds the run files; it is created by the first spill.
+	runDir string
+	// stopWatch stops the removal of runDir on context cancellation.
+	stopWatch func() bool
+	// out produces the sorted values once the input is loaded.
+	out mergeSource[T]
+
+	cur       T
+	err       error
+	done      bool
+	srcClosed bool
+}
+
+func (s *sortIterator[T]) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	s.done = true
+	s.cleanup()
+}
+
+// load drains the input into memory and run files, then prepares out.
+func (s *sortIterator[T]) load() error {
+	var size int64
+	for s.src.Next() {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		v := s.src.Struct()
+		n, err := s.sizeOf(v)
+		if err != nil {
+			return err
+		}
+		if len(s.mem) > 0 && size+n > s.opt.MemoryBudget {
+			if err := s.spill(); err != nil {
+				return err
+			}
+			size = 0
+		}
+		s.mem = append(s.mem, v)
+		size += n
+	}
+	if err := s.src.Err(); err != nil {
+		return err
+	}
+	s.srcClosed = true
+	if err := s.src.Close(); err != nil {
+		return err
+	}
+
+	slices.SortStableFunc(s.mem, s.cmp)
+	if len(s.runs) == 0 {
+		s.out = &memRun[T]{items: s.mem}
+		return nil
+	}
+	// Merge the oldest runs first, keeping them ahead of the newer ones so
+	// that ties still resolve in input order.
+	for len(s.runs)+1 > s.opt.MaxOpenRuns {
+		k := s.opt.MaxOpenRuns
+		path, err := s.mergeRuns(s.runs[:k])
+		if err != nil {
+			return err
+		}
+		s.runs = append([]string{path}, s.runs[k:]...)
+	}
+	srcs, err := s.openRuns(s.runs)
+	if err != nil {
+		return err
+	}
+	m := newMerger(append(srcs, &memRun[T]{items: s.mem}), s.cmp)
+	s.out = m
+	return m.init()
+}
+
+func (s *sortIterator[T]) sizeOf(v T) (int64, error) {
+	if s.opt.SizeOf != nil {
+		return s.opt.SizeOf(v), nil
+	}
+	b, err := s.codec.Encode(v)
+	if err != nil {
+		return 0, fmt.Errorf("sort: encode: %w", err)
+	}
+	return int64(len(b)), nil
+}
+
+// spill sorts the buffered values and writes them as a new run.
+func (s *sortIterator[T]) spill() error {
+	slices.SortStableFunc(s.mem, s.cmp)
+	path, err := s.writeRun(&memRun[T]{items: s.mem})
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, path)
+	clear(s.mem)
+	s.mem = s.mem[:0]
+	return nil
+}
+
+// mergeRuns merges the given runs into a new one and removes them.
+func (s *sortIterator[T]) mergeRuns(paths []string) (string, error) {
+	srcs, err := s.openRuns(paths)
+	if err != nil {
+		return "", err
+	}
+	m := newMerger(srcs, s.cmp)
+	var path string
+	if err = m.init(); err == nil {
+		path, err = s.writeRun(m)
+	}
+	if cerr := m.close(); err == nil && cerr != nil {
+		err = fmt.Errorf("sort: %w", cerr)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, p := range paths {
+		_ = os.Remove(p)
+	}
+	return path, nil
+}
+
+// writeRun writes the values of src to a new temporary run file.
+func (s *sortIterator[T]) writeRun(src mergeSource[T]) (string, error) {
+	if s.runDir == "" {
+		dir, err := os.MkdirTemp(s.opt.TempDir, "cetl-sort-*")
+		if err != nil {
+			return "", fmt.Errorf("sort: %w", err)
+		}
+		s.runDir = dir
+		// Best-effort: remove the runs if the context is cancelled, as
+		// the iterator may never be used again.
+		s.stopWatch = context.AfterFunc(s.ctx, func() { _ = os.RemoveAll(dir) })
+	}
+	w, err := createRun(s.runDir, "sort", s.codec.Encode)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if err := s.ctx.Err(); err != nil {
+			w.abort()
+			return "", err
+		}
+		v, ok, err := src.next()
+		if err != nil {
+			w.abort()
+			return "", err
+		}
+		if !ok {
+			break
+		}
+		if err := w.write(v); err != nil {
+			w.abort()
+			return "", err
+		}
+	}
+	if err := w.finish(); err != nil {
+		return "", err
+	}
+	return w.path(), nil
+}
+
+func (s *sortIterator[T]) openRuns(paths []string) ([]mergeSource[T], error) {
+	srcs := make([]mergeSource[T], 0, len(paths)+1)
+	for _, p := range paths {
+		r, err := openRun(p, "sort", s.codec.Decode)
+		if err != nil {
+			for _, src := range srcs {
+				_ = src.close()
+			}
+			return nil, err
+		}
+		srcs = append(srcs, r)
+	}
+	return srcs, nil
+}
+
+// cleanup closes the open runs and removes the run directory.
+func (s *sortIterator[T]) cleanup() {
+	if s.out != nil {
+		_ = s.out.close()
+	}
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	if s.runDir != "" {
+		_ = os.RemoveAll(s.runDir)
+	}
+	s.runs = nil
+	s.mem = nil
+}
+
+// mergeSource is a sorted sequence of values: an in-memory run, a run
+// file, or a merge of those.
+type mergeSource[T any] interface {
+	next() (T, bool, error)
+	close() error
+}
+
+// memRun is an in-memory sorted run.
+type memRun[T any] struct {
+	items []T
+	i     int
+}
+
+func (m *memRun[T]) next() (T, bool, error) {
+	if m.i >= len(m.items) {
+		var zero T
+		return zero, false, nil
+	}
+	m.i++
+	return m.items[m.i-1], true, nil
+}
+
+func (m *memRun[T]) close() error {
+	m.items = nil
+	return nil
+}
+
+// runWriter writes values to a temporary run file, each as a uvarint
+// length followed by its encoding. op prefixes the errors it returns.
+type runWriter[T any] struct {
+	f      *os.File
+	w      *bufio.Writer
+	op     string
+	encode func(T) ([]byte, error)
+	lenBuf [binary.MaxVarintLen64]byte
+}
+
+func createRun[T any](dir, op string, encode func(T) ([]byte, error)) (*runWriter[T], error) {
+	f, err := os.CreateTemp(dir, "cetl-"+strings.ReplaceAll(op, " ", "")+"-*.run")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &runWriter[T]{f: f, w: bufio.NewWriter(f), op: op, encode: encode}, nil
+}
+
+func (w *runWriter[T]) path() string {
+	return w.f.Name()
+}
+
+func (w *runWriter[T]) write(v T) error {
+	b, err := w.encode(v)
+	if err != nil {
+		return fmt.Errorf("%s: encode: %w", w.op, err)
+	}
+	n := binary.PutUvarint(w.lenBuf[:], uint64(len(b)))
+	if _, err := w.w.Write(w.lenBuf[:n]); err != nil {
+		return fmt.Errorf("%s: %w", w.op, err)
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return fmt.Errorf("%s: %w", w.op, err)
+	}
+	return nil
+}
+
+// finish flushes and closes the file, removing it on failure.
+func (w *runWriter[T]) finish() error {
+	err := w.w.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(w.f.Name())
+		return fmt.Errorf("%s: %w", w.op, err)
+	}
+	return nil
+}
+
+// abort closes and removes the file.
+func (w *runWriter[T]) abort() {
+	_ = w.f.Close()
+	_ = os.Remove(w.f.Name())
+}
+
+// fileRun reads a run written by a runWriter.
+type fileRun[T any] struct {
+	f      *os.File
+	r      *bufio.Reader
+	op     string
+	decode func([]byte) (T, error)
+}
+
+func openRun[T any](path, op string, decode func([]byte) (T, error)) (*fileRun[T], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &fileRun[T]{f: f, r: bufio.NewReader(f), op: op, decode: decode}, nil
+}
+
+func (f *fileRun[T]) next() (T, bool, error) {
+	var zero T
+	n, err := binary.ReadUvarint(f.r)
+	if err == io.EOF {
+		return zero, false, nil
+	}
+	if err != nil {
+		return zero, false, fmt.Errorf("%s: reading run: %w", f.op, err)
+	}
+	// A fresh slice per value: Decode may keep it.
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(f.r, buf); err != nil {
+		return zero, false, fmt.Errorf("%s: reading run: %w", f.op, unexpectedEOF(err))
+	}
+	v, err := f.decode(buf)
+	if err != nil {
+		return zero, false, fmt.Errorf("%s: decode: %w", f.op, err)
+	}
+	return v, true, nil
+}
+
+func (f *fileRun[T]) close() error {
+	return f.f.Close()
+}
+
+// merger is a k-way merge of sorted sources. Ties are resolved in favor of
+// the source with the lower index.
+type merger[T any] struct {
+	srcs  []mergeSource[T]
+	heads mergeHeap[T]
+}
+
+func newMerger[T any](srcs []mergeSource[T], cmp func(a, b T) int) *merger[T] {
+	return &merger[T]{srcs: srcs, heads: mergeHeap[T]{cmp: cmp}}
+}
+
+// init reads the first value of every source.
+func (m *merger[T]) init() error {
+	for i, src := range m.srcs {
+		v, ok, err := src.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.heads.items = append(m.heads.items, mergeHead[T]{v: v, src: i})
+		}
+	}
+	heap.Init(&m.heads)
+	return nil
+}
+
+func (m *merger[T]) next() (T, bool, error) {
+	if len(m.heads.items) == 0 {
+		var zero T
+		return zero, false, nil
+	}
+	top := &m.heads.items[0]
+	v := top.v
+	nv, ok, err := m.srcs[top.src].next()
+	if err != nil {
+		return v, false, err
+	}
+	if ok {
+		top.v = nv
+		heap.Fix(&m.heads, 0)
+	} else {
+		heap.Pop(&m.heads)
+	}
+	return v, true, nil
+}
+
+func (m *merger[T]) close() error {
+	var errs []error
+	for _, src := range m.srcs {
+		errs = append(errs, src.close())
+	}
+	m.srcs = nil
+	m.heads.items = nil
+	return errors.Join(errs...)
+}
+
+type mergeHead[T any] struct {
+	v   T
+	src int
+}
+
+// mergeHeap implements heap.Interface over the current value of each
+// source.
+type mergeHeap[T any] struct {
+	items []mergeHead[T]
+	cmp   func(a, b T) int
+}
+
+func (h *mergeHeap[T]) Len() int { return len(h.items) }
+
+func (h *mergeHeap[T]) Less(i, j int) bool {
+	if c := h.cmp(h.items[i].v, h.items[j].v); c != 0 {
+		return c < 0
+	}
+	return h.items[i].src < h.items[j].src
+}
+
+func (h *mergeHeap[T]) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *mergeHeap[T]) Push(x any) { h.items = append(h.items, x.(mergeHead[T])) }
+
+func (h *mergeHeap[T]) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// unexpectedEOF reports a truncated record as io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,194 @@
+package operator
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+type keyed struct {
+	Key string
+	Seq int
+}
+
+var keyedCodec = Codec[keyed]{
+	Encode: func(v keyed) ([]byte, error) {
+		return append(binary.AppendUvarint(nil, uint64(v.Seq)), v.Key...), nil
+	},
+	Decode: func(b []byte) (keyed, error) {
+		seq, n := binary.Uvarint(b)
+		if n <= 0 {
+			return keyed{}, errors.New("missing sequence number")
+		}
+		return keyed{Key: string(b[n:]), Seq: int(seq)}, nil
+	},
+}
+
+func byKey(a, b keyed) int { return cmp.Compare(a.Key, b.Key) }
+
+func tempEntries(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	return len(entries)
+}
+
+func TestSort_SpillsAndMergesStably(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var in []keyed
+	for i := range 60 {
+		in = append(in, keyed{Key: string(rune('A' + rng.IntN(6))), Seq: i})
+	}
+	want := slices.Clone(in)
+	slices.SortStableFunc(want, byKey)
+
+	for _, maxOpen := range []int{2, 3, 64} {
+		dir := t.TempDir()
+		it := Sort(context.Background(), from(in...), byKey, keyedCodec, SortOptions[keyed]{
+			MemoryBudget: 7,
+			SizeOf:       func(keyed) int64 { return 1 },
+			TempDir:      dir,
+			MaxOpenRuns:  maxOpen,
+		})
+		got := collect(t, it)
+		if !slices.Equal(got, want) {
+			t.Fatalf("MaxOpenRuns %d: got %v\nwant %v", maxOpen, got, want)
+		}
+		if n := tempEntries(t, dir); n != 0 {
+			t.Fatalf("MaxOpenRuns %d: %d temporary files left", maxOpen, n)
+		}
+	}
+}
+
+func TestSort_InMemory(t *testing.T) {
+	dir := t.TempDir()
+	src := from(keyed{"b", 0}, keyed{"a", 1}, keyed{"b", 2}, keyed{"a", 3})
+	it := Sort(context.Background(), src, byKey, keyedCodec, SortOptions[keyed]{TempDir: dir})
+	if !it.Next() {
+		t.Fatalf("expected a value, err: %v", it.Err())
+	}
+	if n := tempEntries(t, dir); n != 0 {
+		t.Fatalf("%d temporary files for an input that fits in memory", n)
+	}
+	got := append([]keyed{it.Struct()}, collect(t, it)...)
+	want := []keyed{{"a", 1}, {"a", 3}, {"b", 0}, {"b", 2}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if src.closed != 1 {
+		t.Fatalf("input closed %d times, want 1", src.closed)
+	}
+}
+
+func TestSort_DecodedValuesKeepTheirBytes(t *testing.T) {
+	// The codec returns the slice it is given, as a []byte payload would.
+	codec := Codec[[]byte]{
+		Encode: func(v []byte) ([]byte, error) { return v, nil },
+		Decode: func(b []byte) ([]byte, error) { return b, nil },
+	}
+	var in [][]byte
+	for _, k := range []string{"dd", "b", "ccc", "a", "eeee", "bb"} {
+		in = append(in, []byte(k))
+	}
+	it := Sort(context.Background(), from(in...), bytes.Compare, codec, SortOptions[[]byte]{
+		MemoryBudget: 2,
+		SizeOf:       func([]byte) int64 { return 1 },
+		TempDir:      t.TempDir(),
+	})
+	var got []string
+	for _, v := range collect(t, it) {
+		got = append(got, string(v))
+	}
+	if want := []string{"a", "b", "bb", "ccc", "dd", "eeee"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSort_CloseAndCancelRemoveFiles(t *testing.T) {
+	var in []keyed
+	for i := range 20 {
+		in = append(in, keyed{Key: string(rune('Z' - i)), Seq: i})
+	}
+	opt := func(dir string) SortOptions[keyed] {
+		return SortOptions[keyed]{MemoryBudget: 5, SizeOf: func(keyed) int64 { return 1 }, TempDir: dir}
+	}
+
+	dir := t.TempDir()
+	it := Sort(context.Background(), from(in...), byKey, keyedCodec, opt(dir))
+	if !it.Next() || it.Struct().Key != "G" {
+		t.Fatalf("first value = %v, err %v", it.Struct(), it.Err())
+	}
+	if tempEntries(t, dir) == 0 {
+		t.Fatalf("expected spilled runs")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := tempEntries(t, dir); n != 0 {
+		t.Fatalf("%d temporary files left after Close", n)
+	}
+
+	dir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	it = Sort(ctx, from(in...), byKey, keyedCodec, opt(dir))
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("expected a value, err: %v", it.Err())
+	}
+	cancel()
+	if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("Err after cancel = %v", it.Err())
+	}
+	if n := tempEntries(t, dir); n != 0 {
+		t.Fatalf("%d temporary files left after cancel", n)
+	}
+
+	// An abandoned iterator still loses its runs once ctx is canceled.
+	dir = t.TempDir()
+	ctx, cancel = context.WithCancel(context.Background())
+	it = Sort(ctx, from(in...), byKey, keyedCodec, opt(dir))
+	defer it.Close()
+	if !it.Next() || tempEntries(t, dir) == 0 {
+		t.Fatalf("expected spilled runs, err: %v", it.Err())
+	}
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for tempEntries(t, dir) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("temporary files left after cancel without Next or Close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSort_Errors(t *testing.T) {
+	wantErr := errors.New("cannot encode")
+	codec := keyedCodec
+	codec.Encode = func(keyed) ([]byte, error) { return nil, wantErr }
+	dir := t.TempDir()
+	it := Sort(context.Background(), from(keyed{"a", 0}, keyed{"b", 1}), byKey, codec, SortOptions[keyed]{TempDir: dir})
+	defer it.Close()
+	if it.Next() || !errors.Is(it.Err(), wantErr) {
+		t.Fatalf("Err = %v, want %v", it.Err(), wantErr)
+	}
+
+	inputErr := errors.New("decode failed")
+	src := &sliceIterator[keyed]{vals: []keyed{{"a", 0}}, err: inputErr}
+	it = Sort(context.Background(), src, byKey, keyedCodec, SortOptions[keyed]{})
+	defer it.Close()
+	if it.Next() || it.Err() != inputErr {
+		t.Fatalf("Err = %v, want %v", it.Err(), inputErr)
+	}
+	if n := tempEntries(t, dir); n != 0 {
+		t.Fatalf("%d temporary files left after error", n)
+	}
+}
@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Unexported helpers
+//
+
+// csvOptions are the options of the csv decoder, after
+// transform.CSVDecoderOptions. Comma and Comment are one-character
+// strings; Comma also accepts "tab". HeaderPolicy is strict (the default),
+// union, intersection or mapped.
+type csvOptions struct {
+	Comma             string            `json:"comma"`
+	Header            []string          `json:"header"`
+	NoHeader          bool              `json:"no_header"`
+	HeaderFile        string            `json:"header_file"`
+	Aliases           map[string]string `json:"aliases"`
+	Sniff             bool              `json:"sniff"`
+	LazyQuotes        bool              `json:"lazy_quotes"`
+	Comment           string            `json:"comment"`
+	KeepLeadingSpace  bool              `json:"keep_leading_space"`
+	TrailingDelimiter bool              `json:"trailing_delimiter"`
+	SkipLines         int               `json:"skip_lines"`
+	SkipFooterLines   int               `json:"skip_footer_lines"`
+	VariableFields    bool              `json:"variable_fields"`
+	HeaderPolicy      string            `json:"header_policy"`
+	HeaderMapping     map[string]string `json:"header_mapping"`
+	Normalize         struct {
+		StripBOM         bool `json:"strip_bom"`
+		NormalizeUnicode bool `json:"normalize_unicode"`
+		TrimSpace        bool `json:"trim_space"`
+		SnakeCase        bool `json:"snake_case"`
+		CaseFold         bool `json:"case_fold"`
+		Compact          bool `json:"compact"`
+	} `json:"normalize"`
+}
+
+func newCSVDecoder(options json.RawMessage) (transform.Decoder, error) {
+	var o csvOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	comma, err := parseDelimiter("comma", o.Comma)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := parseDelimiter("comment", o.Comment)
+	if err != nil {
+		return nil, err
+	}
+	if o.SkipLines < 0 || o.SkipFooterLines < 0 {
+		return nil, fmt.Errorf("skip_lines and skip_footer_lines must not be negative")
+	}
+	if len(o.Aliases) > 0 && len(o.HeaderMapping) > 0 {
+		return nil, fmt.Errorf("aliases and header_mapping cannot both be set")
+	}
+	opt := transform.CSVDecoderOptions{
+		Comma:             comma,
+		Header:            o.Header,
+		NoHeader:          o.NoHeader,
+		HeaderFile:        o.HeaderFile,
+		Aliases:           o.Aliases,
+		Sniff:             o.Sniff,
+		LazyQuotes:        o.LazyQuotes,
+		Comment:           comment,
+		KeepLeadingSpace:  o.KeepLeadingSpace,
+		TrailingDelimiter: o.TrailingDelimiter,
+		SkipLines:         o.SkipLines,
+		SkipFooterLines:   o.SkipFooterLines,
+		VariableFields:    o.VariableFields,
+		HeaderMapping:     o.HeaderMapping,
+		Normalize:         transform.HeaderNormalization(o.Normalize),
+	}
+	switch o.HeaderPolicy {
+	case "", "strict":
+		opt.HeaderPolicy = transform.HeaderStrict
+	case "union":
+		opt.HeaderPolicy = transform.HeaderUnion
+	case "intersection":
+		opt.HeaderPolicy = transform.HeaderIntersection
+	case "mapped":
+		opt.HeaderPolicy = transform.HeaderMapped
+	default:
+		return nil, fmt.Errorf("unknown header_policy %q", o.HeaderPolicy)
+	}
+	return transform.NewCSVDecoder(opt), nil
+}
+
+// parseDelimiter parses a one-character option; empty is 0.
+func parseDelimiter(name, s string) (rune, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "tab":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid %s %q", name, s)
+	}
+	return r, nil
+}
+
+// lineOptions are the options of the lines decoder, after
+// transform.LineDecoderOptions; Start and Continuation are regular
+// expressions.
+type lineOptions struct {
+	Field        string `json:"field"`
+	Start        string `json:"start"`
+	Continuation string `json:"continuation"`
+	MaxLines     int    `json:"max_lines"`
+}
+
+func newLineDecoder(options json.RawMessage) (transform.Decoder, error) {
+	var o lineOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	opt := transform.LineDecoderOptions{Field: o.Field}
+	opt.Group.MaxLines = o.MaxLines
+	var err error
+	if o.Start != "" {
+		if opt.Group.Start, err = regexp.Compile(o.Start); err != nil {
+			return nil, fmt.Errorf("start: %w", err)
+		}
+	}
+	if o.Continuation != "" {
+		if opt.Group.Continuation, err = regexp.Compile(o.Continuation); err != nil {
+			return nil, fmt.Errorf("continuation: %w", err)
+		}
+	}
+	return transform.NewLineDecoder(opt), nil
+}
+
+func newAvroDecoder(options json.RawMessage) (transform.Decoder, error) {
+	if err := decodeOptions(options, &struct{}{}); err != nil {
+		return nil, err
+	}
+	return transform.NewAvroDecoder(), nil
+}
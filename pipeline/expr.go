@@ -0,0 +1,449 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//
+// Public API
+//
+
+// Expr is a compiled filter expression.
+//
+// The language compares the fields of a record with literals or with each
+// other:
+//
+//		amount >= 100 && (country == "IT" || country == 'FR')
+//		!(status == null) && email =~ "@example\\.com$"
+//		`first name` != ""
+//
+//	  - Operands are field names, which may be quoted with backquotes,
+//	    string literals in double or single quotes with Go escapes, numbers,
+//	    true, false and null. A field the record does not have, or a null
+//	    field, is null.
+//	  - Comparisons are ==, !=, <, <=, >, >=, and =~ and !~, whose right
+//	    operand must be a string literal holding a regular expression.
+//	  - Conditions combine with !, && and || and parentheses; && binds more
+//	    tightly than ||.
+//
+// Values compare as numbers if either operand is a number literal or both
+// parse as numbers, as booleans if either operand is a boolean literal,
+// and as strings otherwise. Operands that cannot be compared that way,
+// such as "abc" < 3, make every comparison false except !=. Null equals
+// only null and is neither less nor greater than anything. Evaluation
+// therefore never fails: a malformed expression is rejected when it is
+// compiled.
+type Expr struct {
+	src  string
+	root node
+}
+
+// CompileExpr parses src into an Expr.
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	p.next()
+	root, err := p.parseOr()
+	if err == nil {
+		err = p.err
+	}
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", src, err)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of e.
+func (e *Expr) String() string { return e.src }
+
+// Match reports whether r satisfies e.
+func (e *Expr) Match(r Record) bool {
+	return e.root.eval(r)
+}
+
+//
+// Unexported helpers
+//
+
+// node is a condition.
+type node interface {
+	eval(r Record) bool
+}
+
+type (
+	orNode   struct{ l, r node }
+	andNode  struct{ l, r node }
+	notNode  struct{ n node }
+	constant bool
+	cmpNode  struct {
+		op   string
+		l, r operand
+	}
+	matchNode struct {
+		l      operand
+		re     *regexp.Regexp
+		negate bool
+	}
+)
+
+func (n orNode) eval(r Record) bool  { return n.l.eval(r) || n.r.eval(r) }
+func (n andNode) eval(r Record) bool { return n.l.eval(r) && n.r.eval(r) }
+func (n notNode) eval(r Record) bool { return !n.n.eval(r) }
+func (c constant) eval(Record) bool  { return bool(c) }
+func (n matchNode) eval(r Record) bool {
+	v, ok := n.l.value(r)
+	return ok && n.re.MatchString(v) != n.negate
+}
+
+func (n cmpNode) eval(r Record) bool {
+	lv, lok := n.l.value(r)
+	rv, rok := n.r.value(r)
+	if !lok || !rok {
+		// At least one side is null.
+		eq := lok == rok
+		switch n.op {
+		case "==":
+			return eq
+		case "!=":
+			return !eq
+		}
+		return false
+	}
+	c, ok := compareValues(lv, n.l.kind, rv, n.r.kind)
+	if !ok {
+		return n.op == "!="
+	}
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0 // ">="
+}
+
+// compareValues compares two non-null values by the rules of Expr.
+func compareValues(a string, ak tokenKind, b string, bk tokenKind) (int, bool) {
+	switch {
+	case ak == tokNumber || bk == tokNumber:
+		return compareNumbers(a, b)
+	case ak == tokBool || bk == tokBool:
+		x, err1 := strconv.ParseBool(a)
+		y, err2 := strconv.ParseBool(b)
+		if err1 != nil || err2 != nil {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case y:
+			return -1, true
+		}
+		return 1, true
+	}
+	if c, ok := compareNumbers(a, b); ok {
+		return c, true
+	}
+	return strings.Compare(a, b), true
+}
+
+func compareNumbers(a, b string) (int, bool) {
+	x, err1 := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	y, err2 := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
+
+// operand is a field reference or a literal.
+type operand struct {
+	kind tokenKind // tokIdent, tokString, tokNumber, tokBool or tokNull
+	text string
+}
+
+func (o operand) value(r Record) (string, bool) {
+	switch o.kind {
+	case tokIdent:
+		return r.ByName(o.text)
+	case tokNull:
+		return "", false
+	}
+	return o.text, true
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokBool
+	tokNull
+	tokOp // an operator or a parenthesis
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// exprParser is a recursive descent parser over a one-token lookahead.
+type exprParser struct {
+	src string
+	pos int
+	tok token
+	err error
+}
+
+// errorf reports an error at the current token, or the scan error that
+// ended the input early.
+func (p *exprParser) errorf(format string, args ...any) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("offset %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	for err == nil && p.isOp("||") {
+		p.next()
+		var r node
+		if r, err = p.parseAnd(); err == nil {
+			l = orNode{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	for err == nil && p.isOp("&&") {
+		p.next()
+		var r node
+		if r, err = p.parseNot(); err == nil {
+			l = andNode{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *exprParser) parseNot() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		n, err := p.parseNot()
+		return notNode{n}, err
+	}
+	if p.isOp("(") {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, p.errorf("expected \")\", found %s", p.tok)
+		}
+		p.next()
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (node, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		if l.kind == tokBool {
+			return constant(l.text == "true"), nil
+		}
+		return nil, p.errorf("expected comparison after %q, found %s", l.text, p.tok)
+	}
+	op := p.tok.text
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return cmpNode{op: op, l: l, r: r}, nil
+	case "=~", "!~":
+		p.next()
+		if p.tok.kind != tokString {
+			return nil, p.errorf("expected regular expression string after %s, found %s", op, p.tok)
+		}
+		re, err := regexp.Compile(p.tok.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.next()
+		return matchNode{l: l, re: re, negate: op == "!~"}, nil
+	}
+	if l.kind == tokBool {
+		return constant(l.text == "true"), nil
+	}
+	return nil, p.errorf("expected comparison after %q, found %s", l.text, p.tok)
+}
+
+func (p *exprParser) parseOperand() (operand, error) {
+	if p.err != nil {
+		return operand{}, p.err
+	}
+	switch t := p.tok; t.kind {
+	case tokIdent, tokString, tokNumber, tokBool, tokNull:
+		p.next()
+		return operand{kind: t.kind, text: t.text}, nil
+	}
+	return operand{}, p.errorf("expected field or value, found %s", p.tok)
+}
+
+func (p *exprParser) isOp(op string) bool {
+	return p.err == nil && p.tok.kind == tokOp && p.tok.text == op
+}
+
+// next scans the next token into p.tok. A scan error is kept in p.err and
+// reported by the parse functions.
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n' || p.src[p.pos] == '\r') {
+		p.pos++
+	}
+	start := p.pos
+	p.tok = token{kind: tokEOF, pos: start}
+	if p.pos >= len(p.src) {
+		return
+	}
+	rest := p.src[p.pos:]
+	for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"} {
+		if strings.HasPrefix(rest, op) {
+			p.pos += len(op)
+			p.tok = token{kind: tokOp, text: op, pos: start}
+			return
+		}
+	}
+	switch c := rest[0]; {
+	case c == '"' || c == '\'' || c == '`':
+		end := closingQuote(rest)
+		if end < 0 {
+			p.fail(start, "unterminated quote")
+			return
+		}
+		p.pos += end + 1
+		lit := rest[:end+1]
+		if c == '`' {
+			p.tok = token{kind: tokIdent, text: lit[1:end], pos: start}
+			return
+		}
+		if c == '\'' {
+			// Requote so strconv.Unquote accepts a multi-character
+			// single-quoted literal.
+			lit = `"` + strings.ReplaceAll(strings.ReplaceAll(lit[1:end], `\'`, `'`), `"`, `\"`) + `"`
+		}
+		s, err := strconv.Unquote(lit)
+		if err != nil {
+			p.fail(start, "invalid string literal "+rest[:end+1])
+			return
+		}
+		p.tok = token{kind: tokString, text: s, pos: start}
+	case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9':
+		end := 1
+		for end < len(rest) && isNumberByte(rest[end]) {
+			end++
+		}
+		if _, err := strconv.ParseFloat(rest[:end], 64); err != nil {
+			p.fail(start, "invalid number "+rest[:end])
+			return
+		}
+		p.pos += end
+		p.tok = token{kind: tokNumber, text: rest[:end], pos: start}
+	default:
+		end := 0
+		for end < len(rest) {
+			r, size := utf8.DecodeRuneInString(rest[end:])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+				break
+			}
+			end += size
+		}
+		if end == 0 {
+			r, _ := utf8.DecodeRuneInString(rest)
+			p.fail(start, fmt.Sprintf("unexpected character %q", r))
+			return
+		}
+		p.pos += end
+		word := rest[:end]
+		switch word {
+		case "true", "false":
+			p.tok = token{kind: tokBool, text: word, pos: start}
+		case "null":
+			p.tok = token{kind: tokNull, text: word, pos: start}
+		default:
+			p.tok = token{kind: tokIdent, text: word, pos: start}
+		}
+	}
+}
+
+func (p *exprParser) fail(pos int, msg string) {
+	if p.err == nil {
+		p.err = fmt.Errorf("offset %d: %s", pos, msg)
+	}
+	p.pos = len(p.src)
+	p.tok = token{kind: tokEOF, pos: pos}
+}
+
+// closingQuote returns the index in s of the quote closing s[0], skipping
+// backslash escapes in string literals, or -1.
+func closingQuote(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if q != '`' {
+				i++
+			}
+		case q:
+			return i
+		}
+	}
+	return -1
+}
+
+// isNumberByte reports whether c may continue a number literal; the
+// literal is then checked with strconv.ParseFloat.
+func isNumberByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c == '.' || c == '_' || c == '+' || c == '-'
+}
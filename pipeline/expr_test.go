@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+// rec builds a Record from name, value pairs; a value of "<null>" is null.
+func rec(pairs ...string) Record {
+	var r Record
+	for i := 0; i+1 < len(pairs); i += 2 {
+		f := Field{Name: pairs[i], Value: pairs[i+1]}
+		if f.Value == "<null>" {
+			f = Field{Name: pairs[i], Null: true}
+		}
+		r.Fields = append(r.Fields, f)
+	}
+	return r
+}
+
+func TestExpr(t *testing.T) {
+	r := rec("amount", "150.5", "qty", "9", "country", "IT", "status", "<null>",
+		"email", "ann@example.com", "active", "TRUE", "first name", "Ann", "code", "abc")
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`amount > 100`, true},
+		{`amount >= 150.5 && amount <= 150.5`, true},
+		{`qty < 10`, true},        // numeric, although "9" > "10" as strings
+		{`qty < amount`, true},    // both parse as numbers
+		{`country == "IT"`, true}, // string
+		{`country == 'IT' && qty != 9`, false},
+		{`country < "JP"`, true},
+		{`code > 3`, false}, // not comparable
+		{`code != 3`, true},
+		{`status == null`, true},
+		{`missing == null`, true},
+		{`status != null`, false},
+		{`status == ""`, false},
+		{`status < 1 || status >= 1`, false},
+		{`!(status == null)`, false},
+		{`active == true`, true},
+		{`email =~ "@example\\.com$"`, true},
+		{`email !~ "^bob"`, true},
+		{`status =~ ".*"`, false},
+		{"`first name` == \"Ann\"", true},
+		{`country == "FR" || country == "IT" && qty > 5`, true},
+		{`(country == "FR" || country == "IT") && qty > 50`, false},
+		{`true`, true},
+		{`!false && !!true`, true},
+		{`amount > -1e3`, true},
+	}
+	for _, tc := range cases {
+		e, err := CompileExpr(tc.expr)
+		if err != nil {
+			t.Fatalf("CompileExpr(%s): %v", tc.expr, err)
+		}
+		if got := e.Match(r); got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestCompileExpr_Errors(t *testing.T) {
+	cases := []struct {
+		expr, want string
+	}{
+		{``, "offset 0: expected field or value, found end of expression"},
+		{`amount`, `offset 6: expected comparison after "amount"`},
+		{`amount >`, "offset 8: expected field or value"},
+		{`a == 1 b == 2`, `offset 7: unexpected "b"`},
+		{`(a == 1`, `offset 7: expected ")"`},
+		{`a == "open`, "offset 5: unterminated quote"},
+		{`a == 1 @`, "offset 7: unexpected character '@'"},
+		{`a == 12ab`, "offset 5: invalid number 12ab"},
+		{`a =~ b`, "expected regular expression string after =~"},
+		{`a =~ "("`, "error parsing regexp"},
+	}
+	for _, tc := range cases {
+		_, err := CompileExpr(tc.expr)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("CompileExpr(%s) = %v, want error containing %q", tc.expr, err, tc.want)
+		}
+	}
+}
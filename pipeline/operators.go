@@ -0,0 +1,280 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlodf/cetl/operator"
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Unexported helpers
+//
+
+// newFilter builds the filter operator: {"expr": "..."} keeps the records
+// matching an Expr.
+func newFilter(options json.RawMessage) (Operator, error) {
+	var o struct {
+		Expr string `json:"expr"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Expr == "" {
+		return nil, errors.New("expr is required")
+	}
+	e, err := CompileExpr(o.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, it transform.StructIterator[Record]) transform.StructIterator[Record] {
+		return operator.Filter(ctx, it, e.Match)
+	}, nil
+}
+
+// newSelect builds the select operator: {"columns": [...]} projects
+// records onto the columns, in that order. A column the record does not
+// have is null.
+func newSelect(options json.RawMessage) (Operator, error) {
+	var o struct {
+		Columns []string `json:"columns"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if len(o.Columns) == 0 {
+		return nil, errors.New("columns is required")
+	}
+	seen := map[string]bool{}
+	for _, c := range o.Columns {
+		if seen[c] {
+			return nil, fmt.Errorf("duplicate column %q", c)
+		}
+		seen[c] = true
+	}
+	return func(ctx context.Context, it transform.StructIterator[Record]) transform.StructIterator[Record] {
+		return operator.Map(ctx, it, func(r Record) (Record, error) {
+			out := Record{Fields: make([]Field, len(o.Columns)), Source: r.Source}
+			for i, c := range o.Columns {
+				if j := r.Index(c); j >= 0 {
+					out.Fields[i] = r.Fields[j]
+				} else {
+					out.Fields[i] = Field{Name: c, Null: true}
+				}
+			}
+			return out, nil
+		})
+	}, nil
+}
+
+// newRename builds the rename operator: {"columns": {"old": "new"}}
+// renames fields; other fields are kept. A record in which a new name is
+// taken by another column fails the Map.
+func newRename(options json.RawMessage) (Operator, error) {
+	var o struct {
+		Columns map[string]string `json:"columns"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if len(o.Columns) == 0 {
+		return nil, errors.New("columns is required")
+	}
+	targets := map[string]string{}
+	for from, to := range o.Columns {
+		if to == "" {
+			return nil, fmt.Errorf("empty new name for column %q", from)
+		}
+		if prev, ok := targets[to]; ok {
+			a, b := min(prev, from), max(prev, from)
+			return nil, fmt.Errorf("columns %q and %q are both renamed to %q", a, b, to)
+		}
+		targets[to] = from
+	}
+	return func(ctx context.Context, it transform.StructIterator[Record]) transform.StructIterator[Record] {
+		return operator.Map(ctx, it, func(r Record) (Record, error) {
+			out := Record{Fields: make([]Field, len(r.Fields)), Source: r.Source}
+			// from maps each output name to the input column it came from.
+			from := make(map[string]string, len(r.Fields))
+			for i, f := range r.Fields {
+				name := f.Name
+				if to, ok := o.Columns[f.Name]; ok {
+					f.Name = to
+				}
+				if prev, ok := from[f.Name]; ok {
+					return Record{}, fmt.Errorf("rename %s@%d: columns %q and %q are both named %q",
+						r.Source.Name, r.Source.ByteOffset, prev, name, f.Name)
+				}
+				from[f.Name] = name
+				out.Fields[i] = f
+			}
+			return out, nil
+		})
+	}, nil
+}
+
+// castColumn is one column of the cast operator.
+//
+// Layout is the time layout of the input, as a Go reference time or one of
+// the names in timeLayouts, and is required for the time type. Format is
+// the layout of the output and defaults to RFC 3339.
+type castColumn struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Layout string `json:"layout"`
+	Format string `json:"format"`
+
+	typ Type
+}
+
+// timeLayouts are the layout names accepted by the cast operator.
+var timeLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// newCast builds the cast operator:
+//
+//	{"columns": [{"name": "n", "type": "int"}, ...], "on_error": "fail"}
+//
+// Each value is parsed as its type, with surrounding spaces ignored, and
+// rewritten in canonical form: base-10 integers, floats as encoding/json
+// writes them, "true" and "false", and times in Format. Empty values
+// become null. A value that does not parse fails the run under the
+// default on_error "fail", and becomes null under "null".
+func newCast(options json.RawMessage) (Operator, error) {
+	var o struct {
+		Columns []castColumn `json:"columns"`
+		OnError string       `json:"on_error"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if len(o.Columns) == 0 {
+		return nil, errors.New("columns is required")
+	}
+	var toNull bool
+	switch o.OnError {
+	case "", "fail":
+	case "null":
+		toNull = true
+	default:
+		return nil, fmt.Errorf("unknown on_error %q", o.OnError)
+	}
+	cols := map[string]*castColumn{}
+	for i := range o.Columns {
+		c := &o.Columns[i]
+		if c.Name == "" {
+			return nil, fmt.Errorf("columns[%d]: name is required", i)
+		}
+		if _, ok := cols[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate column %q", c.Name)
+		}
+		t, err := ParseType(c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", c.Name, err)
+		}
+		c.typ = t
+		if l, ok := timeLayouts[c.Layout]; ok {
+			c.Layout = l
+		}
+		if l, ok := timeLayouts[c.Format]; ok {
+			c.Format = l
+		}
+		switch {
+		case t == TypeTime && c.Layout == "":
+			return nil, fmt.Errorf("column %q: layout is required for type time", c.Name)
+		case t != TypeTime && (c.Layout != "" || c.Format != ""):
+			return nil, fmt.Errorf("column %q: layout and format only apply to type time", c.Name)
+		case c.Format == "":
+			c.Format = time.RFC3339
+		}
+		cols[c.Name] = c
+	}
+	return func(ctx context.Context, it transform.StructIterator[Record]) transform.StructIterator[Record] {
+		return operator.Map(ctx, it, func(r Record) (Record, error) {
+			out := Record{Fields: make([]Field, len(r.Fields)), Source: r.Source}
+			for i, f := range r.Fields {
+				if c, ok := cols[f.Name]; ok {
+					v, err := c.cast(f)
+					if err != nil && !toNull {
+						return Record{}, fmt.Errorf("cast %s@%d: column %q: %w", r.Source.Name, r.Source.ByteOffset, f.Name, err)
+					}
+					f = v
+				}
+				out.Fields[i] = f
+			}
+			return out, nil
+		})
+	}, nil
+}
+
+// cast converts f to the type of c. On error it returns f as a null field
+// of that type.
+func (c *castColumn) cast(f Field) (Field, error) {
+	f.Type = c.typ
+	s := strings.TrimSpace(f.Value)
+	if f.Null || s == "" {
+		return Field{Name: f.Name, Null: true, Type: c.typ}, nil
+	}
+	var err error
+	switch c.typ {
+	case TypeString:
+		return f, nil
+	case TypeInt:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, 64); err == nil {
+			f.Value = strconv.FormatInt(n, 10)
+		}
+	case TypeFloat:
+		var x float64
+		if x, err = strconv.ParseFloat(s, 64); err == nil {
+			if math.IsInf(x, 0) || math.IsNaN(x) {
+				err = fmt.Errorf("%q is not a finite number", s)
+			} else {
+				f.Value = formatFloat(x)
+			}
+		}
+	case TypeBool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			f.Value = strconv.FormatBool(b)
+		}
+	case TypeTime:
+		var t time.Time
+		if t, err = time.Parse(c.Layout, s); err == nil {
+			f.Value = t.Format(c.Format)
+		}
+	}
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); ok {
+			err = fmt.Errorf("invalid %s %q", c.typ, ne.Num)
+		}
+		return Field{Name: f.Name, Null: true, Type: c.typ}, err
+	}
+	return f, nil
+}
+
+// formatFloat formats x as encoding/json does: without an exponent unless
+// x is very small or very large.
+func formatFloat(x float64) string {
+	if a := math.Abs(x); a != 0 && (a < 1e-6 || a >= 1e21) {
+		s := strconv.FormatFloat(x, 'e', -1, 64)
+		// Like encoding/json, write e-7 rather than e-07.
+		if n := len(s); n >= 4 && s[n-4:n-1] == "e-0" {
+			s = s[:n-2] + s[n-1:]
+		}
+		return s
+	}
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+// applyOperator builds the operator kind with options and runs records
+// through it.
+func applyOperator(t *testing.T, kind, options string, in ...Record) ([]Record, error) {
+	t.Helper()
+	f, err := operators.lookup(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, err := f(json.RawMessage(options))
+	if err != nil {
+		t.Fatalf("%s %s: %v", kind, options, err)
+	}
+	ctx := context.Background()
+	it := op(ctx, transform.FromSeq(slices.Values(in)))
+	defer it.Close()
+	var out []Record
+	for it.Next() {
+		out = append(out, it.Struct())
+	}
+	return out, it.Err()
+}
+
+func TestOperators(t *testing.T) {
+	in := []Record{
+		rec("id", "1", "amount", " 10.50 ", "paid", "T", "day", "01/10/2024"),
+		rec("id", "2", "amount", "", "paid", "false", "day", "02/10/2024"),
+		rec("id", "3", "amount", "3", "paid", "<null>", "day", "03/10/2024"),
+	}
+	cases := []struct {
+		kind, options string
+		want          []string // JSON of each output record
+	}{
+		{
+			kind:    "filter",
+			options: `{"expr": "amount > 5 || paid == false"}`,
+			want: []string{
+				`{"id":"1","amount":" 10.50 ","paid":"T","day":"01/10/2024"}`,
+				`{"id":"2","amount":"","paid":"false","day":"02/10/2024"}`,
+			},
+		},
+		{
+			kind:    "select",
+			options: `{"columns": ["paid", "id", "extra"]}`,
+			want: []string{
+				`{"paid":"T","id":"1","extra":null}`,
+				`{"paid":"false","id":"2","extra":null}`,
+				`{"paid":null,"id":"3","extra":null}`,
+			},
+		},
+		{
+			kind:    "rename",
+			options: `{"columns": {"id": "order_id", "day": "date"}}`,
+			want: []string{
+				`{"order_id":"1","amount":" 10.50 ","paid":"T","date":"01/10/2024"}`,
+				`{"order_id":"2","amount":"","paid":"false","date":"02/10/2024"}`,
+				`{"order_id":"3","amount":"3","paid":null,"date":"03/10/2024"}`,
+			},
+		},
+		{
+			kind: "cast",
+			options: `{"columns": [
+				{"name": "id", "type": "int"},
+				{"name": "amount", "type": "float"},
+				{"name": "paid", "type": "bool"},
+				{"name": "day", "type": "time", "layout": "02/01/2006", "format": "DateOnly"}
+			]}`,
+			want: []string{
+				`{"id":1,"amount":10.5,"paid":true,"day":"2024-10-01"}`,
+				`{"id":2,"amount":null,"paid":false,"day":"2024-10-02"}`,
+				`{"id":3,"amount":3,"paid":null,"day":"2024-10-03"}`,
+			},
+		},
+	}
+	for _, tc := range cases {
+		out, err := applyOperator(t, tc.kind, tc.options, in...)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.kind, err)
+		}
+		var got []string
+		for _, r := range out {
+			b, _ := r.MarshalJSON()
+			got = append(got, string(b))
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Fatalf("%s:\ngot  %q\nwant %q", tc.kind, got, tc.want)
+		}
+	}
+}
+
+func TestCast_OnError(t *testing.T) {
+	bad := rec("n", "12x")
+	bad.Source.Name, bad.Source.ByteOffset = "a.csv", 40
+	_, err := applyOperator(t, "cast", `{"columns": [{"name": "n", "type": "int"}]}`, bad)
+	if err == nil || err.Error() != `cast a.csv@40: column "n": invalid int "12x"` {
+		t.Fatalf("err = %v", err)
+	}
+	out, err := applyOperator(t, "cast", `{"columns": [{"name": "n", "type": "int"}], "on_error": "null"}`, bad)
+	if err != nil || len(out) != 1 || !out[0].Fields[0].Null {
+		t.Fatalf("on_error null: %+v, %v", out, err)
+	}
+}
+
+func TestRename_Conflict(t *testing.T) {
+	r := rec("id", "1", "order_id", "9")
+	r.Source.Name, r.Source.ByteOffset = "a.csv", 12
+	_, err := applyOperator(t, "rename", `{"columns": {"id": "order_id"}}`, r)
+	if err == nil || err.Error() != `rename a.csv@12: columns "id" and "order_id" are both named "order_id"` {
+		t.Fatalf("err = %v", err)
+	}
+	// Swapping names is not a conflict.
+	out, err := applyOperator(t, "rename", `{"columns": {"id": "order_id", "order_id": "id"}}`, r)
+	if err != nil || out[0].Fields[0].Name != "order_id" || out[0].Fields[1].Name != "id" {
+		t.Fatalf("swap: %+v, %v", out, err)
+	}
+}
+
+func TestOperators_InvalidOptions(t *testing.T) {
+	cases := []struct {
+		kind, options, want string
+	}{
+		{"filter", `{}`, "expr is required"},
+		{"filter", `{"expr": "a =="}`, "expected field or value"},
+		{"filter", `{"exp": "a == 1"}`, `unknown field "exp"`},
+		{"select", `{"columns": ["a", "a"]}`, `duplicate column "a"`},
+		{"rename", `{"columns": {"a": "c", "b": "c"}}`, `columns "a" and "b" are both renamed to "c"`},
+		{"cast", `{"columns": [{"name": "a", "type": "decimal"}]}`, `unknown type "decimal"`},
+		{"cast", `{"columns": [{"name": "a", "type": "time"}]}`, "layout is required"},
+		{"cast", `{"columns": [{"name": "a", "type": "int", "layout": "2006"}]}`, "only apply to type time"},
+		{"cast", `{"columns": [{"name": "a", "type": "int"}], "on_error": "skip"}`, `unknown on_error "skip"`},
+	}
+	for _, tc := range cases {
+		f, _ := operators.lookup(tc.kind)
+		_, err := f(json.RawMessage(tc.options))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s %s: err = %v, want %q", tc.kind, tc.options, err, tc.want)
+		}
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	for _, x := range []float64{0, 10.5, -3, 1e-7, -2.5e-9, 1.5e-300, 1e21, 1.25e300, 123456789012345680000} {
+		want, _ := json.Marshal(x)
+		if got := formatFloat(x); got != string(want) {
+			t.Errorf("formatFloat(%v) = %q, want %q", x, got, want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package pipeline builds and runs pipelines described by a JSON document
+// rather than Go code:
+//
+//	{
+//	  "inputs": ["data/orders-*.csv"],
+//	  "decoder": {"kind": "csv", "options": {"comma": ";"}},
+//	  "operators": [
+//	    {"kind": "filter", "options": {"expr": "status == 'paid' && amount > 0"}},
+//	    {"kind": "select", "options": {"columns": ["id", "amount", "paid_at"]}},
+//	    {"kind": "rename", "options": {"columns": {"paid_at": "date"}}},
+//	    {"kind": "cast", "options": {"columns": [
+//	      {"name": "amount", "type": "float"},
+//	      {"name": "date", "type": "time", "layout": "02/01/2006", "format": "2006-01-02"}
+//	    ]}}
+//	  ],
+//	  "sink": {"kind": "jsonl", "options": {"path": "out/orders.jsonl"}}
+//	}
+//
+// Inputs are resolved with opener.OpenerFromSpec and read as one stream,
+// decoded by the decoder stage, and turned into Records that flow through
+// the operator chain into the sink, with load.Run.
+//
+// Every stage names a kind and its options. Kinds are looked up in three
+// registries, which hold the built-in stages below and can be extended
+// with RegisterDecoder, RegisterOperator and RegisterSink:
+//
+//   - decoders: csv, lines, avro
+//   - operators: filter, select, rename, cast
+//   - sinks: csv, jsonl, files
+//
+// Options are decoded strictly: unknown option names are errors. Parse and
+// New validate the whole document and report every problem at once,
+// located by stage, before anything is opened.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/load"
+	"github.com/carlodf/cetl/opener"
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Config is a pipeline document.
+//
+// Inputs are source specs for opener.OpenerFromSpec; a glob must match at
+// least one file when the pipeline runs. Encoding, if set, is an
+// opener.ParseEncoding name, and every input is transcoded to UTF-8.
+// Operators are applied in order.
+type Config struct {
+	Inputs    []string `json:"inputs"`
+	Encoding  string   `json:"encoding,omitempty"`
+	Decoder   Stage    `json:"decoder"`
+	Operators []Stage  `json:"operators,omitempty"`
+	Sink      Stage    `json:"sink"`
+}
+
+// Stage selects a registered decoder, operator or sink by kind, with its
+// options.
+type Stage struct {
+	Kind    string          `json:"kind"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// Parse reads a Config from r and validates it. Unknown fields are
+// errors.
+func Parse(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("pipeline: %w", err)
+	}
+	if dec.More() {
+		return nil, errors.New("pipeline: trailing data after the document")
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ParseFile reads and validates the Config in the file at path.
+func ParseFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline: %w", err)
+	}
+	c, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate checks that c is complete and that every stage is registered
+// and accepts its options. The returned error joins all the problems.
+func (c *Config) Validate() error {
+	_, err := New(c)
+	return err
+}
+
+// Pipeline is a built pipeline, ready to run.
+type Pipeline struct {
+	inputs []string
+	// encoding applies when transcode is set.
+	encoding  opener.Encoding
+	transcode bool
+	decoder   transform.Decoder
+	ops       []Operator
+	sink      SinkOpener
+}
+
+// New builds the stages of c. It fails if c is invalid; see Validate.
+func New(c *Config) (*Pipeline, error) {
+	var (
+		p    = &Pipeline{inputs: c.Inputs}
+		errs []error
+	)
+	fail := func(where string, err error) {
+		errs = append(errs, fmt.Errorf("pipeline: %s: %w", where, err))
+	}
+	if len(c.Inputs) == 0 {
+		fail("inputs", errors.New("no input"))
+	}
+	for i, in := range c.Inputs {
+		if in == "" {
+			fail(fmt.Sprintf("inputs[%d]", i), errors.New("empty spec"))
+		}
+	}
+	if c.Encoding != "" {
+		enc, err := opener.ParseEncoding(c.Encoding)
+		if err != nil {
+			fail("encoding", err)
+		}
+		p.encoding, p.transcode = enc, true
+	}
+
+	if f, err := decoders.lookup(c.Decoder.Kind); err != nil {
+		fail("decoder", err)
+	} else if p.decoder, err = f(c.Decoder.Options); err != nil {
+		fail(fmt.Sprintf("decoder (%s)", c.Decoder.Kind), err)
+	}
+	for i, st := range c.Operators {
+		where := fmt.Sprintf("operators[%d]", i)
+		f, err := operators.lookup(st.Kind)
+		if err != nil {
+			fail(where, err)
+			continue
+		}
+		op, err := f(st.Options)
+		if err != nil {
+			fail(fmt.Sprintf("%s (%s)", where, st.Kind), err)
+			continue
+		}
+		p.ops = append(p.ops, op)
+	}
+	if f, err := sinks.lookup(c.Sink.Kind); err != nil {
+		fail("sink", err)
+	} else if p.sink, err = f(c.Sink.Options); err != nil {
+		fail(fmt.Sprintf("sink (%s)", c.Sink.Kind), err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+// Run resolves the inputs, decodes them, applies the operators and writes
+// the resulting Records to a new sink. The sink is aborted on failure, so
+// the built-in sinks leave no partial output behind.
+//
+// The file opener is registered for the "file" scheme if no opener is
+// registered for it yet.
+func (p *Pipeline) Run(ctx context.Context) (load.Stats, error) {
+	registerFileOpener()
+	var ops []opener.Opener
+	for _, spec := range p.inputs {
+		found, err := opener.OpenerFromSpec(spec)
+		if err != nil {
+			return load.Stats{}, fmt.Errorf("pipeline: input %q: %w", spec, err)
+		}
+		if len(found) == 0 {
+			return load.Stats{}, fmt.Errorf("pipeline: input %q matches no source", spec)
+		}
+		ops = append(ops, found...)
+	}
+	if p.transcode {
+		ops = opener.TranscodeAll(ops, p.encoding)
+	}
+
+	sink, err := p.sink(ctx)
+	if err != nil {
+		return load.Stats{}, fmt.Errorf("pipeline: sink: %w", err)
+	}
+	mux := connector.NewMuxReader(ctx, ops)
+	recs, err := p.decoder.Decode(ctx, mux)
+	if err != nil {
+		_ = mux.Close()
+		if a, ok := sink.(load.Aborter); ok {
+			_ = a.Abort(ctx)
+		} else {
+			_ = sink.Close(ctx)
+		}
+		return load.Stats{}, fmt.Errorf("pipeline: decode: %w", err)
+	}
+	it := records(ctx, recs)
+	for _, op := range p.ops {
+		it = op(ctx, it)
+	}
+	return load.Run(ctx, it, sink)
+}
+
+//
+// Unexported helpers
+//
+
+var fileOpenerOnce sync.Once
+
+// registerFileOpener registers the file opener unless another opener
+// already handles the "file" scheme.
+func registerFileOpener() {
+	fileOpenerOnce.Do(func() {
+		_ = opener.RegisterOpener("file", opener.RegularFileOpenerFactory)
+	})
+}
@@ -0,0 +1,217 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/operator"
+	"github.com/carlodf/cetl/transform"
+)
+
+// writeFile writes content to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// config returns a pipeline document with DIR replaced by dir.
+func config(dir, doc string) string {
+	return strings.ReplaceAll(doc, "DIR", filepath.ToSlash(dir))
+}
+
+func TestPipeline_Run(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "orders-1.csv", "id;status;amount;paid_at\n1;paid;10.50;01/10/2024\n2;open;3;\n")
+	writeFile(t, dir, "orders-2.csv", "id;status;amount;paid_at\n3;paid;0;02/10/2024\n4;paid;7;03/10/2024\n")
+	c, err := Parse(strings.NewReader(config(dir, `{
+		"inputs": ["DIR/orders-*.csv"],
+		"decoder": {"kind": "csv", "options": {"comma": ";"}},
+		"operators": [
+			{"kind": "filter", "options": {"expr": "status == 'paid' && amount > 0"}},
+			{"kind": "select", "options": {"columns": ["id", "amount", "paid_at"]}},
+			{"kind": "rename", "options": {"columns": {"paid_at": "date"}}},
+			{"kind": "cast", "options": {"columns": [
+				{"name": "id", "type": "int"},
+				{"name": "amount", "type": "float"},
+				{"name": "date", "type": "time", "layout": "02/01/2006", "format": "DateOnly"}
+			]}}
+		],
+		"sink": {"kind": "jsonl", "options": {"path": "DIR/out.jsonl"}}
+	}`)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	p, err := New(c)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	stats, err := p.Run(context.Background())
+	if err != nil || stats.Written != 2 {
+		t.Fatalf("Run: %+v, %v", stats, err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "out.jsonl"))
+	want := `{"id":1,"amount":10.5,"date":"2024-10-01"}` + "\n" + `{"id":4,"amount":7,"date":"2024-10-03"}` + "\n"
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestPipeline_RunLinesToCSV(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "app.log", "INFO start\nERROR boom\n\tat main\nINFO done\n")
+	p, err := New(mustParse(t, config(dir, `{
+		"inputs": ["DIR/app.log"],
+		"decoder": {"kind": "lines", "options": {"field": "msg", "start": "^[A-Z]+ "}},
+		"operators": [{"kind": "filter", "options": {"expr": "msg =~ \"^ERROR\""}}],
+		"sink": {"kind": "csv", "options": {"path": "DIR/errors.csv"}}
+	}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "errors.csv"))
+	if want := "msg\n\"ERROR boom\n\tat main\"\n"; string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPipeline_RunFailureLeavesNoOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "in.csv", "n\n1\nx\n")
+	p, err := New(mustParse(t, config(dir, `{
+		"inputs": ["DIR/in.csv"],
+		"decoder": {"kind": "csv"},
+		"operators": [{"kind": "cast", "options": {"columns": [{"name": "n", "type": "int"}]}}],
+		"sink": {"kind": "csv", "options": {"path": "DIR/out.csv"}}
+	}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `in.csv@`) || !strings.Contains(err.Error(), `invalid int "x"`) {
+		t.Fatalf("Run: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("output left behind: %v", entries)
+	}
+
+	p, _ = New(mustParse(t, config(dir, `{
+		"inputs": ["DIR/none-*.csv"], "decoder": {"kind": "csv"},
+		"sink": {"kind": "csv", "options": {"path": "DIR/out.csv"}}
+	}`)))
+	if _, err := p.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "no files matched") {
+		t.Fatalf("Run without sources: %v", err)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := Parse(strings.NewReader(`{
+		"inputs": [],
+		"encoding": "ebcdic",
+		"decoder": {"kind": "xml"},
+		"operators": [
+			{"kind": "filter", "options": {"expr": "a >"}},
+			{"kind": "sort"}
+		],
+		"sink": {"kind": "csv", "options": {"path": "out.csv", "quote": "'"}}
+	}`))
+	if err == nil {
+		t.Fatal("Parse: no error")
+	}
+	for _, want := range []string{
+		"pipeline: inputs: no input",
+		`pipeline: encoding: unknown encoding "ebcdic"`,
+		`pipeline: decoder: unknown decoder kind "xml" (registered: ["avro" "csv" "lines"])`,
+		"pipeline: operators[0] (filter): expression \"a >\"",
+		`pipeline: operators[1]: unknown operator kind "sort"`,
+		`pipeline: sink (csv): invalid options: json: unknown field "quote"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader(`{"inputs": ["a"], "decoder": {"kind": "csv"}, "sink": {"kind": "csv", "options": {"path": "x"}}, "name": "x"}`)); err == nil || !strings.Contains(err.Error(), `unknown field "name"`) {
+		t.Fatalf("unknown top-level field: %v", err)
+	}
+	if _, err := ParseFile(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ParseFile: %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if err := RegisterDecoder("csv", newCSVDecoder); err == nil {
+		t.Fatal("RegisterDecoder: duplicate kind accepted")
+	}
+	upper := func(options json.RawMessage) (Operator, error) {
+		return func(ctx context.Context, it transform.StructIterator[Record]) transform.StructIterator[Record] {
+			return operator.Map(ctx, it, func(r Record) (Record, error) {
+				for i := range r.Fields {
+					r.Fields[i].Value = strings.ToUpper(r.Fields[i].Value)
+				}
+				return r, nil
+			})
+		}, nil
+	}
+	if err := RegisterOperator("test-upper", upper); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeFile(t, dir, "in.csv", "name\nann\n")
+	p, err := New(mustParse(t, config(dir, `{
+		"inputs": ["DIR/in.csv"], "decoder": {"kind": "csv"},
+		"operators": [{"kind": "test-upper"}],
+		"sink": {"kind": "csv", "options": {"path": "DIR/out.csv"}}
+	}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "out.csv")); string(got) != "name\nANN\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestDecoders_InvalidOptions(t *testing.T) {
+	cases := []struct {
+		kind, options, want string
+	}{
+		{"csv", `{"comma": "ab"}`, `invalid comma "ab"`},
+		{"csv", `{"comment": "\""}`, `invalid comment "\""`},
+		{"csv", `{"aliases": {"a": "b"}, "header_mapping": {"c": "d"}}`, "aliases and header_mapping cannot both be set"},
+		{"csv", `{"header_policy": "loose"}`, `unknown header_policy "loose"`},
+		{"csv", `{"normalize": {"snake": true}}`, `unknown field "snake"`},
+		{"lines", `{"start": "("}`, "start: error parsing regexp"},
+		{"avro", `{"schema": "x"}`, `unknown field "schema"`},
+	}
+	for _, tc := range cases {
+		f, _ := decoders.lookup(tc.kind)
+		_, err := f(json.RawMessage(tc.options))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s %s: err = %v, want %q", tc.kind, tc.options, err, tc.want)
+		}
+	}
+}
+
+func mustParse(t *testing.T, doc string) *Config {
+	t.Helper()
+	c, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return c
+}
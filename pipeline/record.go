@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/operator"
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Type is the type of a field, as set by the cast operator. Values are
+// always held as text; the type tells sinks how to render them.
+type Type int
+
+const (
+	// TypeString is the type of every decoded field.
+	TypeString Type = iota
+	// TypeInt is a base-10 integer.
+	TypeInt
+	// TypeFloat is a decimal or exponent floating-point number.
+	TypeFloat
+	// TypeBool is "true" or "false".
+	TypeBool
+	// TypeTime is a time formatted with the layout of its cast.
+	TypeTime
+)
+
+// String returns the name of t, as accepted by ParseType.
+func (t Type) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeTime:
+		return "time"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// ParseType returns the Type named s.
+func ParseType(s string) (Type, error) {
+	for t := TypeString; t <= TypeTime; t++ {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown type %q", s)
+}
+
+// Field is one named value of a Record.
+type Field struct {
+	Name  string
+	Value string
+	// Null marks a missing value; Value is then empty.
+	Null bool
+	Type Type
+}
+
+// Record is the value flowing through a pipeline: the fields of a decoded
+// record, in order, with the provenance of the record.
+//
+// Record implements transform.Extractor, so it can be passed to code
+// written against decoded records, and json.Marshaler: it encodes as an
+// object in field order, with null for null fields and bare numbers and
+// booleans for fields cast to those types.
+type Record struct {
+	Fields []Field
+	Source connector.SrcMeta
+}
+
+// NewRecord copies the fields of rec into a Record. Fields of a record
+// without names are named "col0", "col1", ... as the CSV decoder does for
+// headerless input.
+func NewRecord(rec transform.Extractor) Record {
+	names := rec.Names()
+	r := Record{Fields: make([]Field, rec.Len()), Source: rec.Meta()}
+	for i := range r.Fields {
+		f := &r.Fields[i]
+		if i < len(names) {
+			f.Name = names[i]
+		} else {
+			f.Name = "col" + strconv.Itoa(i)
+		}
+		v, ok := rec.ByIndex(i)
+		f.Value, f.Null = v, !ok
+	}
+	return r
+}
+
+// Index returns the index of the first field named name, or -1.
+func (r Record) Index(name string) int {
+	for i, f := range r.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ByIndex returns the value of field i; ok is false for a null field.
+func (r Record) ByIndex(i int) (string, bool) {
+	if i < 0 || i >= len(r.Fields) || r.Fields[i].Null {
+		return "", false
+	}
+	return r.Fields[i].Value, true
+}
+
+// ByName returns the value of the field named name; ok is false if there
+// is no such field or it is null.
+func (r Record) ByName(name string) (string, bool) {
+	return r.ByIndex(r.Index(name))
+}
+
+// Len returns the number of fields.
+func (r Record) Len() int { return len(r.Fields) }
+
+// Names returns the names of the fields.
+func (r Record) Names() []string {
+	names := make([]string, len(r.Fields))
+	for i, f := range r.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Meta returns the provenance of the record.
+func (r Record) Meta() connector.SrcMeta { return r.Source }
+
+// MarshalJSON encodes r as a JSON object in field order.
+func (r Record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	str := func(s string) error {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+		// Encode terminates every value with a newline.
+		buf.Truncate(buf.Len() - 1)
+		return nil
+	}
+	buf.WriteByte('{')
+	for i, f := range r.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := str(f.Name); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		switch {
+		case f.Null:
+			buf.WriteString("null")
+		case f.Type == TypeInt || f.Type == TypeFloat || f.Type == TypeBool:
+			// The cast operator only produces valid JSON literals.
+			buf.WriteString(f.Value)
+		default:
+			if err := str(f.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+//
+// Unexported helpers
+//
+
+// records turns decoded records into a stream of Records. The returned
+// iterator reports the SrcMeta of each record.
+func records(ctx context.Context, it transform.RecordIterator) transform.StructIterator[Record] {
+	return operator.Map(ctx, operator.FromRecords(ctx, it), func(rec transform.Extractor) (Record, error) {
+		return NewRecord(rec), nil
+	})
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/transform"
+)
+
+// stubExtractor is a decoded record with optional names and null fields.
+type stubExtractor struct {
+	vals  []string
+	names []string
+	null  map[int]bool
+}
+
+func (s stubExtractor) ByIndex(i int) (string, bool) {
+	if i < 0 || i >= len(s.vals) || s.null[i] {
+		return "", false
+	}
+	return s.vals[i], true
+}
+
+func (s stubExtractor) ByName(name string) (string, bool) {
+	return s.ByIndex(slices.Index(s.names, name))
+}
+
+func (s stubExtractor) Len() int        { return len(s.vals) }
+func (s stubExtractor) Names() []string { return s.names }
+func (s stubExtractor) Meta() connector.SrcMeta {
+	return connector.SrcMeta{Name: "a.csv", ByteOffset: 7}
+}
+
+var _ transform.Extractor = Record{}
+
+func TestNewRecord(t *testing.T) {
+	r := NewRecord(stubExtractor{vals: []string{"1", "", "x"}, names: []string{"id", "note"}, null: map[int]bool{1: true}})
+	want := []Field{{Name: "id", Value: "1"}, {Name: "note", Null: true}, {Name: "col2", Value: "x"}}
+	if !slices.Equal(r.Fields, want) || r.Source.Name != "a.csv" || r.Source.ByteOffset != 7 {
+		t.Fatalf("NewRecord = %+v", r)
+	}
+	if v, ok := r.ByName("id"); !ok || v != "1" {
+		t.Fatalf(`ByName("id") = %q, %v`, v, ok)
+	}
+	if _, ok := r.ByName("note"); ok {
+		t.Fatal(`ByName("note"): null field reported present`)
+	}
+	if _, ok := r.ByIndex(3); ok {
+		t.Fatal("ByIndex(3): out of range reported present")
+	}
+	if got := r.Names(); !slices.Equal(got, []string{"id", "note", "col2"}) || r.Len() != 3 {
+		t.Fatalf("Names() = %q, Len() = %d", got, r.Len())
+	}
+}
+
+func TestRecord_MarshalJSON(t *testing.T) {
+	r := Record{Fields: []Field{
+		{Name: "id", Value: "7", Type: TypeInt},
+		{Name: "price", Value: "1.5", Type: TypeFloat},
+		{Name: "ok", Value: "true", Type: TypeBool},
+		{Name: "note", Value: "<a & b>\n"},
+		{Name: "when", Value: "2024-10-01", Type: TypeTime},
+		{Name: "gone", Null: true, Type: TypeInt},
+	}}
+	got, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// json.Marshal escapes HTML characters of Marshaler output itself.
+	want := `{"id":7,"price":1.5,"ok":true,"note":"\u003ca \u0026 b\u003e\n","when":"2024-10-01","gone":null}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	raw, err := r.MarshalJSON()
+	if err != nil || string(raw) != `{"id":7,"price":1.5,"ok":true,"note":"<a & b>\n","when":"2024-10-01","gone":null}` {
+		t.Fatalf("MarshalJSON = %s, %v", raw, err)
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for typ := TypeString; typ <= TypeTime; typ++ {
+		got, err := ParseType(typ.String())
+		if err != nil || got != typ {
+			t.Fatalf("ParseType(%q) = %v, %v", typ.String(), got, err)
+		}
+	}
+	if _, err := ParseType("decimal"); err == nil {
+		t.Fatal(`ParseType("decimal"): no error`)
+	}
+}
@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/carlodf/cetl/load"
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// DecoderFactory builds a Decoder from the options of a decoder stage.
+// options is nil when the stage has none.
+type DecoderFactory func(options json.RawMessage) (transform.Decoder, error)
+
+// Operator is one step of the operator chain. Like the operators of the
+// operator package, it takes ownership of it.
+type Operator func(ctx context.Context, it transform.StructIterator[Record]) transform.StructIterator[Record]
+
+// OperatorFactory builds an Operator from the options of an operator
+// stage. options is nil when the stage has none.
+type OperatorFactory func(options json.RawMessage) (Operator, error)
+
+// SinkOpener creates the sink of a run. It is called once per Run, so that
+// a Pipeline can be run several times.
+type SinkOpener func(ctx context.Context) (load.Sink[Record], error)
+
+// SinkFactory builds a SinkOpener from the options of a sink stage. It
+// should validate the options without creating any output. options is nil
+// when the stage has none.
+type SinkFactory func(options json.RawMessage) (SinkOpener, error)
+
+// RegisterDecoder associates a decoder kind with a DecoderFactory.
+//
+// Registration is global for the lifetime of the process. Registering the
+// same kind twice, including a built-in kind, returns an error.
+func RegisterDecoder(kind string, f DecoderFactory) error {
+	return decoders.register(kind, f)
+}
+
+// RegisterOperator associates an operator kind with an OperatorFactory.
+// It follows the rules of RegisterDecoder.
+func RegisterOperator(kind string, f OperatorFactory) error {
+	return operators.register(kind, f)
+}
+
+// RegisterSink associates a sink kind with a SinkFactory. It follows the
+// rules of RegisterDecoder.
+func RegisterSink(kind string, f SinkFactory) error {
+	return sinks.register(kind, f)
+}
+
+//
+// Unexported helpers
+//
+
+// registry maps the kinds of one type of stage to their factories.
+type registry[F any] struct {
+	what      string
+	mu        sync.RWMutex
+	factories map[string]F
+}
+
+var (
+	decoders  = &registry[DecoderFactory]{what: "decoder", factories: map[string]DecoderFactory{}}
+	operators = &registry[OperatorFactory]{what: "operator", factories: map[string]OperatorFactory{}}
+	sinks     = &registry[SinkFactory]{what: "sink", factories: map[string]SinkFactory{}}
+)
+
+func init() {
+	builtins := []error{
+		RegisterDecoder("csv", newCSVDecoder),
+		RegisterDecoder("lines", newLineDecoder),
+		RegisterDecoder("avro", newAvroDecoder),
+		RegisterOperator("filter", newFilter),
+		RegisterOperator("select", newSelect),
+		RegisterOperator("rename", newRename),
+		RegisterOperator("cast", newCast),
+		RegisterSink("csv", newCSVSink),
+		RegisterSink("jsonl", newJSONLSink),
+		RegisterSink("files", newFileSink),
+	}
+	for _, err := range builtins {
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *registry[F]) register(kind string, f F) error {
+	if kind == "" {
+		return fmt.Errorf("empty %s kind", r.what)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[kind]; ok {
+		return fmt.Errorf("%s kind %q already registered", r.what, kind)
+	}
+	r.factories[kind] = f
+	return nil
+}
+
+func (r *registry[F]) lookup(kind string) (F, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.factories[kind]
+	if !ok {
+		kinds := make([]string, 0, len(r.factories))
+		for k := range r.factories {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return f, fmt.Errorf("unknown %s kind %q (registered: %q)", r.what, kind, kinds)
+	}
+	return f, nil
+}
+
+// decodeOptions decodes the options of a stage into v, rejecting unknown
+// fields. Missing options leave v unchanged.
+func decodeOptions(options json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(options)) == 0 || bytes.Equal(bytes.TrimSpace(options), []byte("null")) {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid options: trailing data")
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carlodf/cetl/load"
+)
+
+//
+// Unexported helpers
+//
+
+// csvSinkOptions are the options of the csv sink and of the csv format of
+// the files sink. Columns fixes the header; by default it is the field
+// names of the first record, and later records are projected onto it.
+type csvSinkOptions struct {
+	Comma    string   `json:"comma"`
+	Columns  []string `json:"columns"`
+	NoHeader bool     `json:"no_header"`
+	CRLF     bool     `json:"crlf"`
+
+	comma rune
+}
+
+func (o *csvSinkOptions) validate() error {
+	var err error
+	o.comma, err = parseDelimiter("comma", o.Comma)
+	return err
+}
+
+// newCSVSink builds the csv sink: {"path": "out.csv", ...} writes one CSV
+// file; see csvSinkOptions and pathSink.
+func newCSVSink(options json.RawMessage) (SinkOpener, error) {
+	var o struct {
+		Path string `json:"path"`
+		csvSinkOptions
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	return openPath(o.Path, func(w io.Writer) load.Sink[Record] {
+		return newRecordCSVSink(w, o.csvSinkOptions)
+	})
+}
+
+// newJSONLSink builds the jsonl sink: {"path": "out.jsonl"} writes one
+// JSON Lines file with load.NewJSONLSink; see pathSink.
+func newJSONLSink(options json.RawMessage) (SinkOpener, error) {
+	var o struct {
+		Path string `json:"path"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	return openPath(o.Path, load.NewJSONLSink[Record])
+}
+
+// newFileSink builds the files sink, a load.NewFileSink writing csv or
+// jsonl files under dir:
+//
+//	{"dir": "out", "format": "csv", "partition_by": ["dt"], "gzip": true}
+//
+// partition_by names the fields whose values, as name=value directories,
+// partition the output, e.g. "out/dt=2024-10-01/part-0000.csv.gz". Values
+// are escaped so that they cannot leave dir. The csv format accepts the
+// options of the csv sink, except that each file gets its own header.
+func newFileSink(options json.RawMessage) (SinkOpener, error) {
+	var o struct {
+		Dir          string   `json:"dir"`
+		Format       string   `json:"format"`
+		PartitionBy  []string `json:"partition_by"`
+		Prefix       string   `json:"prefix"`
+		Gzip         bool     `json:"gzip"`
+		MaxRows      int64    `json:"max_rows"`
+		MaxBytes     int64    `json:"max_bytes"`
+		MaxOpenFiles int      `json:"max_open_files"`
+		csvSinkOptions
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Dir == "" {
+		return nil, errors.New("dir is required")
+	}
+	if o.MaxRows < 0 || o.MaxBytes < 0 || o.MaxOpenFiles < 0 {
+		return nil, errors.New("max_rows, max_bytes and max_open_files must not be negative")
+	}
+	opt := load.FileSinkOptions[Record]{
+		Dir:          o.Dir,
+		Prefix:       o.Prefix,
+		Gzip:         o.Gzip,
+		MaxRows:      o.MaxRows,
+		MaxBytes:     o.MaxBytes,
+		MaxOpenFiles: o.MaxOpenFiles,
+	}
+	switch o.Format {
+	case "csv":
+		if err := o.validate(); err != nil {
+			return nil, err
+		}
+		opt.Extension = ".csv"
+		opt.Format = func(w io.Writer) load.Sink[Record] {
+			return newRecordCSVSink(w, o.csvSinkOptions)
+		}
+	case "jsonl":
+		if o.csvSinkOptions.Comma != "" || o.Columns != nil || o.NoHeader || o.CRLF {
+			return nil, errors.New("csv options do not apply to format jsonl")
+		}
+		opt.Extension = ".jsonl"
+		opt.Format = load.NewJSONLSink[Record]
+	case "":
+		return nil, errors.New("format is required")
+	default:
+		return nil, fmt.Errorf("unknown format %q", o.Format)
+	}
+	if len(o.PartitionBy) > 0 {
+		opt.Partition = func(r Record) string {
+			dirs := make([]string, len(o.PartitionBy))
+			for i, name := range o.PartitionBy {
+				v, _ := r.ByName(name)
+				dirs[i] = url.PathEscape(name) + "=" + partitionValue(v)
+			}
+			return strings.Join(dirs, "/")
+		}
+	}
+	return func(context.Context) (load.Sink[Record], error) {
+		return load.NewFileSink(opt), nil
+	}, nil
+}
+
+// partitionValue escapes v for use in a directory name. Null and empty
+// values follow the Hive convention.
+func partitionValue(v string) string {
+	switch v {
+	case "":
+		return "__HIVE_DEFAULT_PARTITION__"
+	case ".", "..":
+		// PathEscape keeps dots, but these must not stand alone.
+		return strings.ReplaceAll(v, ".", "%2E")
+	}
+	return url.PathEscape(v)
+}
+
+// openPath returns a SinkOpener writing to a file at path, or to stdout if
+// path is "-".
+//
+// The file is written under a temporary name in the same directory and
+// renamed into place by Close, replacing any previous file; Abort removes
+// it, so a failed run leaves the previous output untouched.
+func openPath(path string, format func(io.Writer) load.Sink[Record]) (SinkOpener, error) {
+	if path == "" {
+		return nil, errors.New("path is required")
+	}
+	return func(context.Context) (load.Sink[Record], error) {
+		if path == "-" {
+			return format(os.Stdout), nil
+		}
+		f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+		if err != nil {
+			return nil, err
+		}
+		// CreateTemp uses 0600, which suits the temporary name only.
+		if err := f.Chmod(0o644); err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			return nil, err
+		}
+		return &pathSink{Sink: format(f), f: f, path: path}, nil
+	}, nil
+}
+
+// pathSink is a Sink writing to a temporary file renamed to path on Close.
+type pathSink struct {
+	load.Sink[Record]
+	f    *os.File
+	path string
+	done bool
+}
+
+func (s *pathSink) Close(ctx context.Context) error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	err := s.Sink.Close(ctx)
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(s.f.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(s.f.Name())
+	}
+	return err
+}
+
+func (s *pathSink) Abort(ctx context.Context) error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	_ = s.Sink.Close(ctx)
+	_ = s.f.Close()
+	return os.Remove(s.f.Name())
+}
+
+// recordCSVSink writes Records with load.NewCSVSink, once the header is
+// known.
+type recordCSVSink struct {
+	w   io.Writer
+	opt csvSinkOptions
+	csv load.Sink[Record]
+}
+
+func newRecordCSVSink(w io.Writer, opt csvSinkOptions) *recordCSVSink {
+	s := &recordCSVSink{w: w, opt: opt}
+	if len(opt.Columns) > 0 {
+		s.start(opt.Columns)
+	}
+	return s
+}
+
+// start creates the CSV sink with the given header.
+func (s *recordCSVSink) start(header []string) {
+	opt := load.CSVSinkOptions[Record]{
+		Comma:   s.opt.comma,
+		UseCRLF: s.opt.CRLF,
+		Row: func(r Record) ([]string, error) {
+			row := make([]string, len(header))
+			for i, name := range header {
+				row[i], _ = r.ByName(name)
+			}
+			return row, nil
+		},
+	}
+	if !s.opt.NoHeader {
+		opt.Header = header
+	}
+	s.csv = load.NewCSVSink(s.w, opt)
+}
+
+func (s *recordCSVSink) Write(ctx context.Context, r Record) error {
+	if s.csv == nil {
+		s.start(r.Names())
+	}
+	return s.csv.Write(ctx, r)
+}
+
+func (s *recordCSVSink) Flush(ctx context.Context) error {
+	if s.csv == nil {
+		return nil
+	}
+	return s.csv.Flush(ctx)
+}
+
+func (s *recordCSVSink) Close(ctx context.Context) error {
+	if s.csv == nil {
+		// No record and no header: leave the output empty.
+		s.start(nil)
+	}
+	return s.csv.Close(ctx)
+}
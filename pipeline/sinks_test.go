@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/load"
+	"github.com/carlodf/cetl/transform"
+)
+
+// loadRecords writes records to the sink kind built from options.
+func loadRecords(t *testing.T, kind, options string, in ...Record) error {
+	t.Helper()
+	f, err := sinks.lookup(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, err := f(json.RawMessage(options))
+	if err != nil {
+		t.Fatalf("%s %s: %v", kind, options, err)
+	}
+	ctx := context.Background()
+	sink, err := open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = load.Run(ctx, transform.FromSeq(slices.Values(in)), sink)
+	return err
+}
+
+// readTree returns the relative path and content of every file under dir.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSinks(t *testing.T) {
+	in := []Record{
+		rec("id", "1", "dt", "2024-10-01", "note", "a,b"),
+		rec("dt", "2024-10-02", "id", "2", "note", "<null>"),
+		rec("id", "3", "dt", "../x", "note", "c"),
+	}
+	in[0].Fields[0].Type = TypeInt
+	cases := []struct {
+		name, kind, options string
+		want                map[string]string
+	}{
+		{
+			name:    "csv",
+			kind:    "csv",
+			options: `{"path": "DIR/out.csv"}`,
+			want:    map[string]string{"out.csv": "id,dt,note\n1,2024-10-01,\"a,b\"\n2,2024-10-02,\n3,../x,c\n"},
+		},
+		{
+			name:    "csv with columns",
+			kind:    "csv",
+			options: `{"path": "DIR/out.tsv", "comma": "tab", "columns": ["note", "id"], "no_header": true}`,
+			want:    map[string]string{"out.tsv": "a,b\t1\n\t2\nc\t3\n"},
+		},
+		{
+			name:    "jsonl",
+			kind:    "jsonl",
+			options: `{"path": "DIR/out.jsonl"}`,
+			want: map[string]string{"out.jsonl": `{"id":1,"dt":"2024-10-01","note":"a,b"}` + "\n" +
+				`{"dt":"2024-10-02","id":"2","note":null}` + "\n" + `{"id":"3","dt":"../x","note":"c"}` + "\n"},
+		},
+		{
+			name:    "partitioned files",
+			kind:    "files",
+			options: `{"dir": "DIR/out", "format": "csv", "partition_by": ["dt"], "columns": ["id"]}`,
+			want: map[string]string{
+				"out/dt=2024-10-01/part-0000.csv": "id\n1\n",
+				"out/dt=2024-10-02/part-0000.csv": "id\n2\n",
+				"out/dt=..%2Fx/part-0000.csv":     "id\n3\n",
+			},
+		},
+		{
+			name:    "rotated jsonl files",
+			kind:    "files",
+			options: `{"dir": "DIR/out", "format": "jsonl", "max_rows": 2, "prefix": "chunk"}`,
+			want: map[string]string{
+				"out/chunk-0000.jsonl": `{"id":1,"dt":"2024-10-01","note":"a,b"}` + "\n" + `{"dt":"2024-10-02","id":"2","note":null}` + "\n",
+				"out/chunk-0001.jsonl": `{"id":"3","dt":"../x","note":"c"}` + "\n",
+			},
+		},
+	}
+	for _, tc := range cases {
+		dir := t.TempDir()
+		options := strings.ReplaceAll(tc.options, "DIR", filepath.ToSlash(dir))
+		if err := loadRecords(t, tc.kind, options, in...); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := readTree(t, dir); !maps.Equal(got, tc.want) {
+			t.Fatalf("%s:\ngot  %q\nwant %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPathSink_Abort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.jsonl")
+	if err := os.WriteFile(path, []byte("previous\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	readErr := errors.New("bad input")
+	f, _ := sinks.lookup("jsonl")
+	open, err := f(json.RawMessage(`{"path": ` + jsonString(path) + `}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	sink, err := open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := transform.FromSeq2(func(yield func(Record, error) bool) {
+		if yield(rec("id", "1"), nil) {
+			yield(Record{}, readErr)
+		}
+	})
+	if _, err := load.Run(ctx, it, sink); !errors.Is(err, readErr) {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := readTree(t, dir); !maps.Equal(got, map[string]string{"out.jsonl": "previous\n"}) {
+		t.Fatalf("files after abort: %q", got)
+	}
+	if err := sink.(load.Aborter).Abort(ctx); err != nil {
+		t.Fatalf("second Abort: %v", err)
+	}
+	if err := sink.Close(ctx); err != nil {
+		t.Fatalf("Close after Abort: %v", err)
+	}
+}
+
+func TestPathSink_CloseTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+	f, _ := sinks.lookup("jsonl")
+	open, err := f(json.RawMessage(`{"path": ` + jsonString(path) + `}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	sink, err := open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(ctx, rec("id", "1")); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if err := sink.Close(ctx); err != nil {
+			t.Fatalf("Close %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestSinks_InvalidOptions(t *testing.T) {
+	cases := []struct {
+		kind, options, want string
+	}{
+		{"csv", `{}`, "path is required"},
+		{"csv", `{"path": "x", "comma": ";;"}`, `invalid comma ";;"`},
+		{"jsonl", `{"path": "x", "comma": ","}`, `unknown field "comma"`},
+		{"files", `{"format": "csv"}`, "dir is required"},
+		{"files", `{"dir": "x"}`, "format is required"},
+		{"files", `{"dir": "x", "format": "parquet"}`, `unknown format "parquet"`},
+		{"files", `{"dir": "x", "format": "jsonl", "no_header": true}`, "csv options do not apply"},
+	}
+	for _, tc := range cases {
+		f, _ := sinks.lookup(tc.kind)
+		_, err := f(json.RawMessage(tc.options))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s %s: err = %v, want %q", tc.kind, tc.options, err, tc.want)
+		}
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,309 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/carlodf/cetl/connector"
+)
+
+//
+// Public API
+//
+
+// NewAvroDecoder constructs a Decoder for Avro Object Container Files.
+//
+// Every source read through the connector.SrcAwareStreamer must be a
+// complete container file: the decoder reads each source's own header
+// (schema, codec and sync marker) at its boundary, so sources with
+// different schemas may be mixed. The "null" and "deflate" codecs are
+// supported.
+//
+// Records are flattened into columns:
+//
+//   - Each field of the top-level record is a column named after it.
+//   - Nested records, including ["null", record] unions, are expanded into
+//     one column per leaf field with dotted names ("address.city"). When the
+//     union is null, all of its columns are null.
+//   - Arrays, maps and other unions of complex types are one column holding
+//     the value rendered as JSON.
+//   - Logical types are rendered in their natural textual form: dates as
+//     "2006-01-02", timestamps as RFC 3339, decimals as exact decimal
+//     numbers, time-of-day as "15:04:05.000".
+//   - A top-level schema that is not a record yields a single "value"
+//     column.
+//
+// Null values are reported as missing: ByIndex and ByName return ok ==
+// false for them. Each record's Meta().ByteOffset is the offset, within its
+// source, of the data block that holds it.
+func NewAvroDecoder() Decoder {
+	return &avroDecoder{}
+}
+
+// Decode consumes a connector.SrcAwareStreamer and returns a RecordIterator
+// that yields one record per Avro datum.
+//
+// The returned iterator is not safe for concurrent use. Call Close on the
+// RecordIterator when you are done to release the underlying stream.
+func (d *avroDecoder) Decode(ctx context.Context, rc connector.SrcAwareStreamer) (RecordIterator, error) {
+	it := &avroRecordIterator{
+		srcAwareStream: rc,
+		segments:       connector.NewSegmenter(rc),
+	}
+	// Best-effort: close the underlying stream if the context is cancelled.
+	go func() {
+		<-ctx.Done()
+		_ = rc.Close()
+	}()
+	return it, nil
+}
+
+// Next advances to the next datum, crossing block and source boundaries
+// as needed.
+func (it *avroRecordIterator) Next() bool {
+	if it.decoderError != nil || it.done {
+		return false
+	}
+	for {
+		if it.file == nil {
+			if !it.segments.Next() {
+				it.decoderError = it.segments.Err()
+				it.done = true
+				return false
+			}
+			f, err := openAvroFile(it.segments)
+			if err != nil {
+				it.fail(err)
+				return false
+			}
+			it.file = f
+		}
+		if it.file.remaining == 0 {
+			more, err := it.file.nextBlock()
+			if err != nil {
+				it.fail(err)
+				return false
+			}
+			if !more {
+				it.file = nil
+				continue
+			}
+		}
+		if err := it.file.readDatum(); err != nil {
+			it.fail(err)
+			return false
+		}
+		return true
+	}
+}
+
+// Record returns an Extractor for the current datum.
+//
+// The returned Extractor is only valid until the next call to Next.
+func (it *avroRecordIterator) Record() Extractor {
+	f := it.file
+	return nullableExtractor{
+		sliceExtractor: sliceExtractor{
+			current:  f.values,
+			header:   f.columns,
+			invIndex: f.index,
+			srcMeta:  connector.SrcMeta{Name: f.source, ByteOffset: f.blockOffset},
+		},
+		present: f.present,
+	}
+}
+
+// Err reports the first non-EOF error encountered while decoding.
+func (it *avroRecordIterator) Err() error {
+	return it.decoderError
+}
+
+// Close closes the underlying SrcAwareStreamer. It is safe to call Close
+// multiple times.
+func (it *avroRecordIterator) Close() error {
+	return it.srcAwareStream.Close()
+}
+
+//
+// Unexported helpers
+//
+
+type avroDecoder struct{}
+
+type avroRecordIterator struct {
+	// srcAwareStream is the stream being decoded.
+	srcAwareStream connector.SrcAwareStreamer
+	// segments splits srcAwareStream into one container file per source.
+	segments *connector.Segmenter
+	// file is the container file being read; nil between sources.
+	file *avroFile
+
+	// decoderError is a sticky error; once set, Next returns false.
+	decoderError error
+	// done is set once the stream is exhausted.
+	done bool
+}
+
+func (it *avroRecordIterator) fail(err error) {
+	if it.file != nil {
+		err = &connector.SourceError{Op: "avro", Source: it.file.source, Err: fmt.Errorf("block at offset %d: %w", it.file.blockOffset, err)}
+	} else {
+		err = &connector.SourceError{Op: "avro", Source: it.segments.Meta().Name, Err: err}
+	}
+	it.decoderError = err
+}
+
+// avroMagic starts every Object Container File.
+var avroMagic = []byte{'O', 'b', 'j', 1}
+
+// avroFile reads one Object Container File.
+type avroFile struct {
+	// source is the name of the source holding the file.
+	source string
+	// in counts the bytes consumed from the source.
+	in *countingReader
+	// r reads the raw container (header and block framing).
+	r avroReader
+
+	schema *avroSchema
+	codec  string
+	sync   [16]byte
+
+	// columns, index are the flattened column names and their positions.
+	columns []string
+	index   map[string]int
+
+	// block decodes the datums of the current block.
+	block avroReader
+	// remaining is the number of datums left in the current block.
+	remaining int64
+	// blockOffset is the source offset of the current block.
+	blockOffset int64
+
+	// values and present hold the current datum.
+	values  []string
+	present []bool
+}
+
+// openAvroFile reads and validates the container header.
+func openAvroFile(seg *connector.Segmenter) (*avroFile, error) {
+	in := &countingReader{r: seg}
+	f := &avroFile{source: seg.Meta().Name, in: in, r: avroReader{r: bufio.NewReader(in)}}
+
+	magic, err := f.r.readFixed(len(avroMagic))
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if !bytes.Equal(magic, avroMagic) {
+		return nil, errors.New("not an Avro object container file")
+	}
+	meta := map[string][]byte{}
+	err = f.r.readBlocks(func() error {
+		k, err := f.r.readBytes()
+		if err != nil {
+			return err
+		}
+		v, err := f.r.readBytes()
+		meta[string(k)] = v
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading header metadata: %w", err)
+	}
+	sync, err := f.r.readFixed(len(f.sync))
+	if err != nil {
+		return nil, fmt.Errorf("reading sync marker: %w", err)
+	}
+	copy(f.sync[:], sync)
+
+	if f.schema, err = parseAvroSchema(meta["avro.schema"]); err != nil {
+		return nil, err
+	}
+	f.codec = string(meta["avro.codec"])
+	switch f.codec {
+	case "":
+		f.codec = "null"
+	case "null", "deflate":
+	default:
+		return nil, fmt.Errorf("unsupported codec %q", f.codec)
+	}
+	f.columns = avroColumns(f.schema)
+	if err := validateHeader(f.columns); err != nil {
+		return nil, err
+	}
+	f.index = buildIndex(f.columns)
+	f.values = make([]string, len(f.columns))
+	f.present = make([]bool, len(f.columns))
+	return f, nil
+}
+
+// nextBlock reads the next data block. It returns false at the end of the
+// file.
+func (f *avroFile) nextBlock() (bool, error) {
+	for {
+		f.blockOffset = f.in.n - int64(f.r.r.Buffered())
+		if _, err := f.r.r.Peek(1); err == io.EOF {
+			return false, nil
+		}
+		count, err := f.r.readLong()
+		if err != nil {
+			return false, unexpectedEOF(err)
+		}
+		if count < 0 {
+			return false, fmt.Errorf("invalid block count %d", count)
+		}
+		data, err := f.r.readBytes()
+		if err != nil {
+			return false, fmt.Errorf("reading block: %w", err)
+		}
+		sync, err := f.r.readFixed(len(f.sync))
+		if err != nil {
+			return false, fmt.Errorf("reading block sync marker: %w", err)
+		}
+		if !bytes.Equal(sync, f.sync[:]) {
+			return false, errors.New("sync marker mismatch")
+		}
+		if count == 0 {
+			continue
+		}
+		var br io.Reader = bytes.NewReader(data)
+		if f.codec == "deflate" {
+			br = flate.NewReader(br)
+		}
+		f.block = avroReader{r: bufio.NewReader(br)}
+		f.remaining = count
+		return true, nil
+	}
+}
+
+// readDatum decodes the next datum of the current block into values.
+func (f *avroFile) readDatum() error {
+	f.remaining--
+	if f.schema.kind == "record" {
+		_, err := f.block.readFlat(f.schema, f.values, f.present, 0, nil)
+		return err
+	}
+	v, err := f.block.readValue(f.schema)
+	if err != nil {
+		return err
+	}
+	f.values[0], f.present[0] = formatAvroValue(v), v != nil
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
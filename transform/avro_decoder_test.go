@@ -0,0 +1,301 @@
+package transform
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/opener"
+)
+
+// ---- minimal Avro binary encoder used to build fixtures ----
+
+type avroBuf struct{ bytes.Buffer }
+
+func (b *avroBuf) long(v int64) *avroBuf {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64((v<<1)^(v>>63)))
+	b.Write(tmp[:n])
+	return b
+}
+
+func (b *avroBuf) str(s string) *avroBuf {
+	b.long(int64(len(s)))
+	b.WriteString(s)
+	return b
+}
+
+func (b *avroBuf) double(f float64) *avroBuf {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(f))
+	b.Write(tmp[:])
+	return b
+}
+
+func (b *avroBuf) float(f float32) *avroBuf {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], math.Float32bits(f))
+	b.Write(tmp[:])
+	return b
+}
+
+var testSync = []byte("0123456789abcdef")
+
+// avroOCF builds a container file holding one block per entry of blocks,
+// each block being (count, encoded datums).
+func avroOCF(t *testing.T, schema, codec string, blocks ...[]any) []byte {
+	t.Helper()
+	var f avroBuf
+	f.Write(avroMagic)
+	meta := map[string]string{"avro.schema": schema}
+	if codec != "" {
+		meta["avro.codec"] = codec
+	}
+	f.long(int64(len(meta)))
+	for k, v := range meta {
+		f.str(k).str(v)
+	}
+	f.long(0)
+	f.Write(testSync)
+	for _, blk := range blocks {
+		count, data := blk[0].(int), blk[1].([]byte)
+		if codec == "deflate" {
+			var z bytes.Buffer
+			w, _ := flate.NewWriter(&z, flate.DefaultCompression)
+			_, _ = w.Write(data)
+			_ = w.Close()
+			data = z.Bytes()
+		}
+		f.long(int64(count))
+		f.long(int64(len(data)))
+		f.Write(data)
+		f.Write(testSync)
+	}
+	return f.Bytes()
+}
+
+const testEventSchema = `{
+  "type": "record", "name": "Event", "namespace": "com.example",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}},
+    {"name": "note", "type": ["null", "string"]},
+    {"name": "address", "type": ["null", {"type": "record", "name": "Address",
+      "fields": [{"name": "city", "type": "string"}, {"name": "zip", "type": "string"}]}]},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attrs", "type": {"type": "map", "values": "double"}},
+    {"name": "day", "type": {"type": "int", "logicalType": "date"}},
+    {"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "amount", "type": {"type": "bytes", "logicalType": "decimal", "precision": 9, "scale": 2}}
+  ]
+}`
+
+func encodeEvent(b *avroBuf, id int64, kind int64, note *string, city string, tags []string, attr float64) {
+	b.long(id).long(kind)
+	if note == nil {
+		b.long(0)
+	} else {
+		b.long(1).str(*note)
+	}
+	if city == "" {
+		b.long(0)
+	} else {
+		b.long(1).str(city).str("00100")
+	}
+	if len(tags) > 0 {
+		b.long(int64(len(tags)))
+		for _, tg := range tags {
+			b.str(tg)
+		}
+	}
+	b.long(0)
+	b.long(1).str("w").double(attr).long(0)
+	b.long(19997)                       // 2024-10-01
+	b.long(1727740800000 + 1500)        // 2024-10-01T00:00:01.5Z
+	b.long(2).Write([]byte{0xfe, 0x0c}) // -500 → -5.00
+}
+
+func decodeAll(t *testing.T, dec Decoder, srcs ...opener.Opener) ([]map[string]string, []connector.SrcMeta, error) {
+	t.Helper()
+	ctx := context.Background()
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, srcs))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var rows []map[string]string
+	var metas []connector.SrcMeta
+	for it.Next() {
+		rec := it.Record()
+		row := map[string]string{}
+		for _, n := range rec.Names() {
+			if v, ok := rec.ByName(n); ok {
+				row[n] = v
+			}
+		}
+		rows = append(rows, row)
+		metas = append(metas, rec.Meta())
+	}
+	return rows, metas, it.Err()
+}
+
+func TestAvroDecoder_TypesAndFlattening(t *testing.T) {
+	note := "hello"
+	var blk avroBuf
+	encodeEvent(&blk, 1, 1, &note, "Rome", []string{"x", "y"}, 0.5)
+	encodeEvent(&blk, 2, 0, nil, "", nil, 2)
+	data := avroOCF(t, testEventSchema, "", []any{2, blk.Bytes()})
+
+	rows, _, err := decodeAll(t, NewAvroDecoder(), opener.InMemorySource{SourceName: "a.avro", Data: data})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	want := map[string]string{
+		"id": "1", "kind": "B", "note": "hello", "address.city": "Rome", "address.zip": "00100",
+		"tags": `["x","y"]`, "attrs": `{"w":0.5}`, "day": "2024-10-01",
+		"at": "2024-10-01T00:00:01.5Z", "amount": "-5.00",
+	}
+	for k, v := range want {
+		if rows[0][k] != v {
+			t.Fatalf("row 0 %s = %q, want %q (row %v)", k, rows[0][k], v, rows[0])
+		}
+	}
+	for _, k := range []string{"note", "address.city", "address.zip"} {
+		if _, ok := rows[1][k]; ok {
+			t.Fatalf("row 1 %s should be null, row %v", k, rows[1])
+		}
+	}
+	if rows[1]["tags"] != "[]" || rows[1]["kind"] != "A" {
+		t.Fatalf("row 1 = %v", rows[1])
+	}
+}
+
+func TestAvroDecoder_MultipleSourcesAndDeflate(t *testing.T) {
+	schemaA := `{"type":"record","name":"R","fields":[{"name":"n","type":"long"}]}`
+	schemaB := `{"type":"record","name":"S","fields":[{"name":"s","type":"string"},{"name":"f","type":"double"}]}`
+	var a1, a2, b1 avroBuf
+	a1.long(1).long(2)
+	a2.long(3)
+	b1.str("z").double(1.25)
+
+	srcs := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.avro", Data: avroOCF(t, schemaA, "deflate", []any{2, a1.Bytes()}, []any{1, a2.Bytes()})},
+		opener.InMemorySource{SourceName: "b.avro", Data: avroOCF(t, schemaB, "null", []any{1, b1.Bytes()})},
+	}
+	rows, metas, err := decodeAll(t, NewAvroDecoder(), srcs...)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	var got []string
+	for i, r := range rows {
+		got = append(got, metas[i].Name+":"+r["n"]+r["s"]+r["f"])
+	}
+	if want := "a.avro:1,a.avro:2,a.avro:3,b.avro:z1.25"; strings.Join(got, ",") != want {
+		t.Fatalf("rows = %v, want %s", got, want)
+	}
+	if metas[0].ByteOffset == 0 || metas[2].ByteOffset <= metas[0].ByteOffset {
+		t.Fatalf("block offsets not increasing: %+v", metas)
+	}
+}
+
+func TestAvroDecoder_Errors(t *testing.T) {
+	schema := `{"type":"record","name":"R","fields":[{"name":"n","type":"long"}]}`
+	var blk avroBuf
+	blk.long(7)
+	good := avroOCF(t, schema, "", []any{1, blk.Bytes()})
+	badSync := append([]byte(nil), good...)
+	badSync[len(badSync)-1] ^= 0xff
+	var hugeKey, hugeBlock avroBuf
+	hugeKey.Write(avroMagic)
+	hugeKey.long(1).long(math.MaxInt64 >> 1)
+	hugeBlock.Write(good[:len(good)-len(testSync)-len(blk.Bytes())-2])
+	hugeBlock.long(1).long(1 << 29).Write(blk.Bytes())
+	nulls := `{"type":"record","name":"R","fields":[{"name":"n","type":{"type":"array","items":"null"}}]}`
+	var hugeCount, minCount avroBuf
+	hugeCount.long(1 << 61)
+	minCount.long(math.MinInt64).long(0)
+
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not avro", []byte("a,b\n1,2\n"), "not an Avro object container file"},
+		{"bad codec", avroOCF(t, schema, "snappy"), `unsupported codec "snappy"`},
+		{"bad sync", badSync, "sync marker mismatch"},
+		{"truncated", good[:len(good)-5], "unexpected EOF"},
+		{"huge length", hugeKey.Bytes(), "invalid length 4611686018427387903"},
+		{"truncated block", hugeBlock.Bytes(), "reading block: unexpected EOF"},
+		{"huge item count", avroOCF(t, nulls, "", []any{1, hugeCount.Bytes()}), "invalid item count 2305843009213693952"},
+		{"min item count", avroOCF(t, nulls, "", []any{1, minCount.Bytes()}), "invalid item count -9223372036854775808"},
+		{"bad fixed size", avroOCF(t, `{"type":"fixed","name":"F","size":-1}`, ""), "fixed F has invalid size -1"},
+	}
+	for _, tc := range cases {
+		_, _, err := decodeAll(t, NewAvroDecoder(), opener.InMemorySource{SourceName: "x.avro", Data: tc.data})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: err = %v, want contains %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestAvroDecoder_RecursiveSchema(t *testing.T) {
+	schema := `{"type":"record","name":"Node","fields":[
+		{"name":"v","type":"long"},
+		{"name":"next","type":["null","Node"]}]}`
+	var blk avroBuf
+	blk.long(1).long(1).long(2).long(0)
+	rows, _, err := decodeAll(t, NewAvroDecoder(), opener.InMemorySource{
+		SourceName: "n.avro", Data: avroOCF(t, schema, "", []any{1, blk.Bytes()}),
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if rows[0]["v"] != "1" || rows[0]["next"] != `{"next":null,"v":2}` {
+		t.Fatalf("row = %v", rows[0])
+	}
+}
+
+func TestAvroDecoder_Float(t *testing.T) {
+	schema := `{"type":"record","name":"R","fields":[
+		{"name":"f","type":"float"},
+		{"name":"fs","type":{"type":"array","items":"float"}}]}`
+	var blk avroBuf
+	blk.float(0.1).long(2).float(1.5).float(0.3).long(0)
+	rows, _, err := decodeAll(t, NewAvroDecoder(), opener.InMemorySource{
+		SourceName: "f.avro", Data: avroOCF(t, schema, "", []any{1, blk.Bytes()}),
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if rows[0]["f"] != "0.1" || rows[0]["fs"] != "[1.5,0.3]" {
+		t.Fatalf("row = %v", rows[0])
+	}
+}
+
+func TestAvroDecoder_Duration(t *testing.T) {
+	schema := `{"type":"record","name":"R","fields":[
+		{"name":"d","type":{"type":"fixed","name":"D","size":12,"logicalType":"duration"}}]}`
+	var blk avroBuf
+	for _, d := range [][3]uint32{{14, 2, 3004}, {0, 0, 500}} {
+		for _, v := range d {
+			_ = binary.Write(&blk, binary.LittleEndian, v)
+		}
+	}
+	rows, _, err := decodeAll(t, NewAvroDecoder(), opener.InMemorySource{
+		SourceName: "d.avro", Data: avroOCF(t, schema, "", []any{2, blk.Bytes()}),
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["d"] != "P14M2DT3.004S" || rows[1]["d"] != "P0M0DT0.500S" {
+		t.Fatalf("rows = %v", rows)
+	}
+}
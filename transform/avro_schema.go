@@ -0,0 +1,704 @@
+package transform
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Avro schema model
+//
+
+// avroSchema is a parsed Avro schema node. Named types (record, enum,
+// fixed) are shared by pointer between their definition and references.
+type avroSchema struct {
+	// kind is the Avro type: a primitive name, "record", "enum", "array",
+	// "map", "union" or "fixed".
+	kind string
+	// name is the full name of a named type.
+	name string
+	// logical is the logicalType attribute, if any.
+	logical string
+
+	// fields are the fields of a record.
+	fields []avroField
+	// symbols are the symbols of an enum.
+	symbols []string
+	// items is the element schema of an array.
+	items *avroSchema
+	// values is the value schema of a map.
+	values *avroSchema
+	// branches are the alternatives of a union.
+	branches []*avroSchema
+	// size is the length of a fixed.
+	size int
+	// precision and scale qualify the decimal logical type.
+	precision, scale int
+}
+
+type avroField struct {
+	name   string
+	schema *avroSchema
+}
+
+// parseAvroSchema parses a JSON Avro schema as embedded in an Object
+// Container File header.
+func parseAvroSchema(data []byte) (*avroSchema, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema JSON: %w", err)
+	}
+	p := avroSchemaParser{named: map[string]*avroSchema{}}
+	return p.parse(raw, "")
+}
+
+type avroSchemaParser struct {
+	// named holds every named type defined so far, by full name.
+	named map[string]*avroSchema
+}
+
+func (p *avroSchemaParser) parse(raw any, namespace string) (*avroSchema, error) {
+	switch v := raw.(type) {
+	case string:
+		return p.parseName(v, namespace)
+	case []any:
+		u := &avroSchema{kind: "union"}
+		for _, b := range v {
+			s, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			u.branches = append(u.branches, s)
+		}
+		return u, nil
+	case map[string]any:
+		return p.parseObject(v, namespace)
+	default:
+		return nil, fmt.Errorf("avro: unexpected schema element %v", raw)
+	}
+}
+
+func (p *avroSchemaParser) parseName(name, namespace string) (*avroSchema, error) {
+	switch name {
+	case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+		return &avroSchema{kind: name}, nil
+	}
+	if s, ok := p.named[fullAvroName(name, namespace)]; ok {
+		return s, nil
+	}
+	if s, ok := p.named[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("avro: unknown type %q", name)
+}
+
+func (p *avroSchemaParser) parseObject(obj map[string]any, namespace string) (*avroSchema, error) {
+	kind, _ := obj["type"].(string)
+	if kind == "" {
+		// {"type": {...}} or {"type": [...]} wraps another schema.
+		inner, ok := obj["type"]
+		if !ok {
+			return nil, errors.New("avro: schema object without type")
+		}
+		return p.parse(inner, namespace)
+	}
+	logical, _ := obj["logicalType"].(string)
+
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		name, _ := obj["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("avro: %s without name", kind)
+		}
+		if ns, ok := obj["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		full := fullAvroName(name, namespace)
+		if i := strings.LastIndexByte(full, '.'); i >= 0 {
+			namespace = full[:i]
+		}
+		s := &avroSchema{kind: kind, name: full, logical: logical}
+		if kind == "error" {
+			s.kind = "record"
+		}
+		p.named[full] = s
+		switch s.kind {
+		case "record":
+			fields, _ := obj["fields"].([]any)
+			for _, f := range fields {
+				fm, ok := f.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("avro: malformed field in record %s", full)
+				}
+				fname, _ := fm["name"].(string)
+				ft, err := p.parse(fm["type"], namespace)
+				if err != nil {
+					return nil, fmt.Errorf("avro: field %s.%s: %w", full, fname, err)
+				}
+				s.fields = append(s.fields, avroField{name: fname, schema: ft})
+			}
+		case "enum":
+			syms, _ := obj["symbols"].([]any)
+			for _, sym := range syms {
+				str, _ := sym.(string)
+				s.symbols = append(s.symbols, str)
+			}
+		case "fixed":
+			size, _ := obj["size"].(float64)
+			if size < 0 || size > maxAvroLength {
+				return nil, fmt.Errorf("avro: fixed %s has invalid size %v", full, obj["size"])
+			}
+			s.size = int(size)
+			s.precision, s.scale = avroDecimalParams(obj)
+		}
+		return s, nil
+	case "array":
+		items, err := p.parse(obj["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{kind: kind, items: items, logical: logical}, nil
+	case "map":
+		values, err := p.parse(obj["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{kind: kind, values: values, logical: logical}, nil
+	default:
+		s, err := p.parseName(kind, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if logical == "" {
+			return s, nil
+		}
+		// Primitive annotated with a logical type: copy so the annotation
+		// does not leak into other references to a named type.
+		cp := *s
+		cp.logical = logical
+		cp.precision, cp.scale = avroDecimalParams(obj)
+		return &cp, nil
+	}
+}
+
+func avroDecimalParams(obj map[string]any) (int, int) {
+	precision, _ := obj["precision"].(float64)
+	scale, _ := obj["scale"].(float64)
+	return int(precision), int(scale)
+}
+
+func fullAvroName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+//
+// Flattening of records into columns
+//
+
+// avroColumns returns the dotted column names produced when s is flattened:
+// nested records (including records inside a ["null", record] union) are
+// expanded into one column per leaf field. Any other type, and any record
+// referencing itself recursively, is one column.
+func avroColumns(s *avroSchema) []string {
+	if s.kind != "record" {
+		return []string{"value"}
+	}
+	var cols []string
+	var walk func(s *avroSchema, prefix string, stack avroStack)
+	walk = func(s *avroSchema, prefix string, stack avroStack) {
+		stack = stack.push(s)
+		for _, f := range s.fields {
+			name := prefix + f.name
+			if rec := flattenableRecord(f.schema, stack); rec != nil {
+				walk(rec, name+".", stack)
+				continue
+			}
+			cols = append(cols, name)
+		}
+	}
+	walk(s, "", nil)
+	return cols
+}
+
+// avroStack holds the records being expanded, to stop at recursive
+// references.
+type avroStack []*avroSchema
+
+func (st avroStack) push(s *avroSchema) avroStack {
+	return append(st[:len(st):len(st)], s)
+}
+
+func (st avroStack) contains(s *avroSchema) bool {
+	for _, e := range st {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenableRecord returns the record schema to expand in place of s, or
+// nil if s is a leaf column.
+func flattenableRecord(s *avroSchema, stack avroStack) *avroSchema {
+	var rec *avroSchema
+	switch s.kind {
+	case "record":
+		rec = s
+	case "union":
+		for _, b := range s.branches {
+			switch {
+			case b.kind == "null":
+			case b.kind == "record" && rec == nil:
+				rec = b
+			default:
+				return nil
+			}
+		}
+	}
+	if rec == nil || stack.contains(rec) {
+		return nil
+	}
+	return rec
+}
+
+// avroWidth returns the number of columns s occupies once flattened.
+func avroWidth(s *avroSchema, stack avroStack) int {
+	rec := flattenableRecord(s, stack)
+	if rec == nil {
+		return 1
+	}
+	stack = stack.push(rec)
+	w := 0
+	for _, f := range rec.fields {
+		w += avroWidth(f.schema, stack)
+	}
+	return w
+}
+
+//
+// Binary decoding
+//
+
+const (
+	// maxAvroLength bounds the length of bytes, strings, fixed values and
+	// blocks.
+	maxAvroLength = 1 << 30
+	// avroReadChunk is the largest length readFixed allocates at once.
+	avroReadChunk = 1 << 16
+	// maxAvroItems bounds the number of items of an array or map.
+	maxAvroItems = 1 << 24
+)
+
+// avroReader decodes Avro binary encoding.
+type avroReader struct {
+	r *bufio.Reader
+}
+
+func (a avroReader) readLong() (int64, error) {
+	u, err := binary.ReadUvarint(a.r)
+	if err != nil {
+		return 0, err
+	}
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (a avroReader) readBytes() ([]byte, error) {
+	n, err := a.readLong()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > maxAvroLength {
+		return nil, fmt.Errorf("avro: invalid length %d", n)
+	}
+	return a.readFixed(int(n))
+}
+
+// readFixed reads n bytes. Lengths come from the file, so n is checked
+// against maxAvroLength, and large values are read in chunks: a corrupt
+// length then fails at the end of the data instead of allocating n bytes
+// up front.
+func (a avroReader) readFixed(n int) ([]byte, error) {
+	if n < 0 || n > maxAvroLength {
+		return nil, fmt.Errorf("avro: invalid length %d", n)
+	}
+	if n <= avroReadChunk {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(a.r, b); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return b, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(a.r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+// readFlat decodes a record of schema s into vals/present starting at
+// column col, expanding nested records as described in avroColumns, and
+// returns the next column index.
+func (a avroReader) readFlat(s *avroSchema, vals []string, present []bool, col int, stack avroStack) (int, error) {
+	stack = stack.push(s)
+	for _, f := range s.fields {
+		rec := flattenableRecord(f.schema, stack)
+		if rec == nil {
+			v, err := a.readValue(f.schema)
+			if err != nil {
+				return col, err
+			}
+			vals[col], present[col] = formatAvroValue(v), v != nil
+			col++
+			continue
+		}
+		b := f.schema
+		if b.kind == "union" {
+			var err error
+			if b, err = a.readBranch(b); err != nil {
+				return col, err
+			}
+		}
+		if b.kind == "null" {
+			end := col + avroWidth(f.schema, stack)
+			for i := col; i < end; i++ {
+				vals[i], present[i] = "", false
+			}
+			col = end
+			continue
+		}
+		var err error
+		if col, err = a.readFlat(b, vals, present, col, stack); err != nil {
+			return col, err
+		}
+	}
+	return col, nil
+}
+
+func (a avroReader) readBranch(s *avroSchema) (*avroSchema, error) {
+	idx, err := a.readLong()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if idx < 0 || int(idx) >= len(s.branches) {
+		return nil, fmt.Errorf("avro: union branch %d out of range", idx)
+	}
+	return s.branches[idx], nil
+}
+
+// readValue decodes a single value of schema s into a Go value: nil, bool,
+// int64, float32, float64, string, []byte, []any, map[string]any, or a value
+// produced by a logical type (time.Time, *big.Rat, ...).
+func (a avroReader) readValue(s *avroSchema) (any, error) {
+	switch s.kind {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := a.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return b != 0, nil
+	case "int", "long":
+		n, err := a.readLong()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return avroLogicalInt(s, n), nil
+	case "float":
+		b, err := a.readFixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case "double":
+		b, err := a.readFixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes":
+		b, err := a.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return avroLogicalBytes(s, b), nil
+	case "string":
+		b, err := a.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case "fixed":
+		b, err := a.readFixed(s.size)
+		if err != nil {
+			return nil, err
+		}
+		return avroLogicalBytes(s, b), nil
+	case "enum":
+		idx, err := a.readLong()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if idx < 0 || int(idx) >= len(s.symbols) {
+			return nil, fmt.Errorf("avro: enum %s index %d out of range", s.name, idx)
+		}
+		return s.symbols[idx], nil
+	case "union":
+		b, err := a.readBranch(s)
+		if err != nil {
+			return nil, err
+		}
+		return a.readValue(b)
+	case "array":
+		var out []any
+		err := a.readBlocks(func() error {
+			v, err := a.readValue(s.items)
+			out = append(out, v)
+			return err
+		})
+		if out == nil {
+			out = []any{}
+		}
+		return out, err
+	case "map":
+		out := map[string]any{}
+		err := a.readBlocks(func() error {
+			k, err := a.readBytes()
+			if err != nil {
+				return err
+			}
+			v, err := a.readValue(s.values)
+			out[string(k)] = v
+			return err
+		})
+		return out, err
+	case "record":
+		out := make(map[string]any, len(s.fields))
+		for _, f := range s.fields {
+			v, err := a.readValue(f.schema)
+			if err != nil {
+				return nil, err
+			}
+			out[f.name] = v
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("avro: unsupported type %q", s.kind)
+	}
+}
+
+// readBlocks reads the block-encoded items of an array or map, calling item
+// once per element. Items such as nulls take no bytes, so the counts are
+// checked against maxAvroItems rather than against the data left.
+func (a avroReader) readBlocks(item func() error) error {
+	var total int64
+	for {
+		n, err := a.readLong()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if n == 0 {
+			return nil
+		}
+		if n < 0 {
+			// A negative count is followed by the block size in bytes.
+			n = -n
+			if _, err := a.readLong(); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+		// -n overflows for the smallest int64.
+		if n < 0 || n > maxAvroItems-total {
+			return fmt.Errorf("avro: invalid item count %d", n)
+		}
+		total += n
+		for range n {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+//
+// Logical types
+//
+
+// avroTimeOfDay is the value of the time-millis and time-micros logical
+// types.
+type avroTimeOfDay struct {
+	d      time.Duration
+	micros bool
+}
+
+// avroDate is the value of the date logical type.
+type avroDate struct {
+	t time.Time
+}
+
+// avroLocalTime is the value of the local-timestamp-* logical types.
+type avroLocalTime struct {
+	t time.Time
+}
+
+func avroLogicalInt(s *avroSchema, n int64) any {
+	switch s.logical {
+	case "date":
+		return avroDate{t: time.Unix(0, 0).UTC().AddDate(0, 0, int(n))}
+	case "time-millis":
+		return avroTimeOfDay{d: time.Duration(n) * time.Millisecond}
+	case "time-micros":
+		return avroTimeOfDay{d: time.Duration(n) * time.Microsecond, micros: true}
+	case "timestamp-millis":
+		return time.UnixMilli(n).UTC()
+	case "timestamp-micros":
+		return time.UnixMicro(n).UTC()
+	case "local-timestamp-millis":
+		return avroLocalTime{t: time.UnixMilli(n).UTC()}
+	case "local-timestamp-micros":
+		return avroLocalTime{t: time.UnixMicro(n).UTC()}
+	default:
+		return n
+	}
+}
+
+func avroLogicalBytes(s *avroSchema, b []byte) any {
+	switch s.logical {
+	case "decimal":
+		unscaled := new(big.Int).SetBytes(b)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			// Two's-complement negative number.
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(b))*8))
+		}
+		return avroDecimal{unscaled: unscaled, scale: s.scale}
+	case "duration":
+		if len(b) == 12 {
+			return avroDuration{
+				months: binary.LittleEndian.Uint32(b[0:4]),
+				days:   binary.LittleEndian.Uint32(b[4:8]),
+				millis: binary.LittleEndian.Uint32(b[8:12]),
+			}
+		}
+	}
+	return b
+}
+
+// avroDecimal is the value of the decimal logical type.
+type avroDecimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+func (d avroDecimal) String() string {
+	s := new(big.Int).Abs(d.unscaled).String()
+	sign := ""
+	if d.unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + s
+	}
+	if len(s) <= d.scale {
+		s = strings.Repeat("0", d.scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+}
+
+// avroDuration is the value of the duration logical type.
+type avroDuration struct {
+	months, days, millis uint32
+}
+
+//
+// Rendering
+//
+
+// formatAvroValue renders a decoded value as the string exposed through
+// Extractor. Scalars use their natural textual form, timestamps RFC 3339,
+// dates "2006-01-02", durations ISO 8601 such as "P1M2DT3.004S"; arrays,
+// maps and non-flattened records are rendered as JSON.
+func formatAvroValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case bool:
+		return strconv.FormatBool(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case avroDate:
+		return x.t.Format(time.DateOnly)
+	case avroLocalTime:
+		return x.t.Format("2006-01-02T15:04:05.999999999")
+	case avroTimeOfDay:
+		t := time.Time{}.Add(x.d)
+		if x.micros {
+			return t.Format("15:04:05.000000")
+		}
+		return t.Format("15:04:05.000")
+	case avroDecimal:
+		return x.String()
+	case avroDuration:
+		return fmt.Sprintf("P%dM%dDT%d.%03dS", x.months, x.days, x.millis/1000, x.millis%1000)
+	default:
+		b, err := json.Marshal(toJSONValue(v))
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+// toJSONValue converts decoded values into values encoding/json renders
+// the same way formatAvroValue renders scalars.
+func toJSONValue(v any) any {
+	switch x := v.(type) {
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = toJSONValue(e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			out[k] = toJSONValue(e)
+		}
+		return out
+	case nil, bool, int64, float32, float64, string:
+		return x
+	default:
+		return formatAvroValue(x)
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
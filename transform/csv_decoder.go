@@ -1,11 +1,15 @@
 package transform
 
 import (
+	"bufio"
 	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/carlodf/cetl/connector"
 )
@@ -22,11 +26,125 @@ import (
 // it as the header.
 //
 // Comma controls the field delimiter. If Comma is zero, ',' is used.
+//
+// Sniff enables automatic dialect detection: the first SniffBytes bytes of
+// each source (8 KiB if zero) are sampled with SniffCSV to infer its
+// delimiter, quote character, line terminator and whether it starts with a
+// header row. A detected dialect whose confidence is below
+// SniffMinConfidence (0.6 if zero) is discarded and the explicit options
+// are used for that source. OnDialect, if set, is called with every
+// detected dialect, confident or not, e.g. for logging.
+//
+// In inferred header mode the first row of the first source is always the
+// header. A source's first row is skipped if it repeats the canonical
+// header. Under HeaderStrict, when the header was inferred and a later
+// sniffed source is detected to start with a different header row,
+// decoding fails with an error naming the source rather than reading its
+// rows under the wrong names; the sniffer's guess is ignored with an
+// explicit Header or HeaderFile.
+//
+// The remaining options refine parsing; all of them apply to each source
+// separately:
+//
+//   - LazyQuotes and Comment behave as in encoding/csv.Reader.
+//   - KeepLeadingSpace disables the default trimming of leading white
+//     space in fields.
+//   - TrailingDelimiter tolerates a delimiter at the end of each record:
+//     an empty last field in excess of the header is dropped.
+//   - SkipLines discards that many physical lines (e.g. banner rows) at the
+//     start of every source, before the header and before sniffing.
+//   - SkipFooterLines discards that many physical lines at the end of every
+//     source.
+//   - VariableFields allows records to have more or fewer fields than the
+//     header. Missing trailing fields are reported as absent by ByName;
+//     extra fields are only reachable with ByIndex.
+//
+// HeaderPolicy controls how sources whose headers differ are reconciled;
+// see HeaderPolicy. HeaderMapping renames source columns to canonical
+// names (source name → canonical name) under every policy but
+// HeaderStrict.
+//
+// Headerless input:
+//
+//   - NoHeader declares that sources have no header row: no row is ever
+//     dropped as a header and HeaderPolicy is ignored. Unless Header or
+//     HeaderFile provide names, columns are named "col0", "col1", ... after
+//     the field count of the first record.
+//   - HeaderFile names a sidecar file holding the column names, either on
+//     one delimited line or one per line. It is read at Decode time and
+//     takes precedence over Header.
+//
+// Aliases maps a header spelling to a canonical name (e.g. "cust_id" →
+// "customer_id"), so that ByName finds the column under the canonical name
+// whatever spelling a source uses. Names still reports the spelling of the
+// header. Aliases only adds lookup names, whereas HeaderMapping renames the
+// columns themselves; the two cannot be combined, and Decode fails if both
+// are set.
+//
+// Normalize cleans up header names before they are used: the canonical
+// header, every source's header row (so that a repeated header in another
+// spelling is still recognized), and the keys and values of HeaderMapping
+// and Aliases. Names reports the normalized names, and ByName normalizes
+// its argument the same way, so ByName("Customer ID") finds "customer_id"
+// under SnakeCase.
 type CSVDecoderOptions struct {
 	Comma  rune
 	Header []string
+
+	NoHeader   bool
+	HeaderFile string
+	Aliases    map[string]string
+
+	Sniff              bool
+	SniffBytes         int
+	SniffMinConfidence float64
+	OnDialect          func(source string, d CSVDialect)
+
+	LazyQuotes        bool
+	Comment           rune
+	KeepLeadingSpace  bool
+	TrailingDelimiter bool
+	SkipLines         int
+	SkipFooterLines   int
+	VariableFields    bool
+
+	HeaderPolicy  HeaderPolicy
+	HeaderMapping map[string]string
+
+	Normalize HeaderNormalization
 }
 
+// HeaderPolicy selects how a CSV decoder reconciles the headers of the
+// sources it reads with the canonical header exposed through Names.
+//
+// Under every policy but HeaderStrict, each source must start with its own
+// header row. That row is read at the source boundary, its names are
+// renamed through CSVDecoderOptions.HeaderMapping, and the source's rows
+// are projected onto the canonical header by name rather than position.
+// Canonical columns the source does not have read as null: ByIndex and
+// ByName report them as missing.
+//
+// The canonical header starts as CSVDecoderOptions.Header or, when that is
+// empty, as the header of the first source. It evolves with the policy, so
+// records from different sources may report different Names.
+type HeaderPolicy int
+
+const (
+	// HeaderStrict enforces a single header positionally: every record
+	// must have as many fields as the canonical header, and a source's
+	// first row is dropped only if it repeats it.
+	HeaderStrict HeaderPolicy = iota
+	// HeaderUnion appends columns first seen in a later source to the
+	// canonical header.
+	HeaderUnion
+	// HeaderIntersection removes from the canonical header the columns a
+	// later source does not have. Decoding fails if no column is left.
+	HeaderIntersection
+	// HeaderMapped keeps the canonical header fixed; source columns that
+	// are not in it, after renaming, are ignored.
+	HeaderMapped
+)
+
 // NewCSVDecoder constructs a CSV-specific Decoder.
 //
 // The returned Decoder produces RecordIterator values backed by
@@ -54,8 +172,38 @@ func NewCSVDecoder(opt CSVDecoderOptions) Decoder {
 		optHeader = opt.Header
 	}
 	decoder := &csvDecoder{
-		comma:  optComma,
-		header: optHeader,
+		comma:         optComma,
+		header:        optHeader,
+		sniff:         opt.Sniff,
+		sniffBytes:    opt.SniffBytes,
+		minConfidence: opt.SniffMinConfidence,
+		onDialect:     opt.OnDialect,
+
+		lazyQuotes:        opt.LazyQuotes,
+		comment:           opt.Comment,
+		trimLeadingSpace:  !opt.KeepLeadingSpace,
+		trailingDelimiter: opt.TrailingDelimiter,
+		skipLines:         opt.SkipLines,
+		skipFooterLines:   opt.SkipFooterLines,
+		variableFields:    opt.VariableFields,
+
+		policy:  opt.HeaderPolicy,
+		mapping: opt.Normalize.normalizeKeys(opt.HeaderMapping),
+
+		noHeader:   opt.NoHeader,
+		headerFile: opt.HeaderFile,
+		aliases:    opt.Normalize.normalizeKeys(opt.Aliases),
+
+		normalize: opt.Normalize,
+	}
+	if decoder.noHeader {
+		decoder.policy = HeaderStrict
+	}
+	if decoder.sniffBytes <= 0 {
+		decoder.sniffBytes = 8 * 1024
+	}
+	if decoder.minConfidence <= 0 {
+		decoder.minConfidence = 0.6
 	}
 	return decoder
 }
@@ -66,7 +214,8 @@ func NewCSVDecoder(opt CSVDecoderOptions) Decoder {
 // Header handling:
 //
 //   - If the decoder was configured with an explicit Header, every record
-//     must have the same number of fields as that header.
+//     must have the same number of fields as that header, unless
+//     VariableFields is set.
 //   - If no Header was configured, Decode reads the first CSV record
 //     and uses it as the header.
 //
@@ -74,43 +223,74 @@ func NewCSVDecoder(opt CSVDecoderOptions) Decoder {
 //
 //   - The provided SrcAwareStreamer is typically a stream that concatenates
 //     multiple underlying sources (files).
-//   - csvRowIterator uses SrcMeta from rc.Current() to detect when a new
-//     source begins.
+//   - csvRowIterator splits the stream per source with a
+//     connector.Segmenter and parses each source with its own csv.Reader,
+//     so a record never spans two sources and line numbers in errors are
+//     relative to the source.
 //   - When the header was inferred, the first record of each new source
 //     is compared with the canonical header; if it matches, that record
 //     is treated as a source-local header and skipped.
+//   - When sniffing is enabled, each source's dialect is detected from its
+//     first bytes before it is parsed.
 //
 // The returned iterator is not safe for concurrent use. Call Close on the
 // RecordIterator when you are done to release the underlying stream.
 func (d *csvDecoder) Decode(ctx context.Context, rc connector.SrcAwareStreamer) (RecordIterator, error) {
-	csvReader := csv.NewReader(rc)
-	csvReader.Comma = d.comma
-	csvReader.ReuseRecord = true
-	csvReader.TrimLeadingSpace = true
+	it := &csvRowIterator{
+		decoder:        d,
+		segments:       connector.NewSegmenter(rc),
+		srcAwareStream: rc,
+	}
+	if len(d.aliases) > 0 && len(d.mapping) > 0 {
+		return nil, errors.New("Aliases and HeaderMapping cannot both be set")
+	}
+	header := d.header
+	if d.headerFile != "" {
+		names, err := readHeaderFile(d.headerFile, d.comma)
+		if err != nil {
+			return nil, fmt.Errorf("reading header file: %w", err)
+		}
+		header = names
+	}
 	var csvHeader []string
-	csvHeaderInferred := len(d.header) == 0
-	if csvHeaderInferred {
-		firstRec, err := csvReader.Read()
+	csvHeaderInferred := len(header) == 0 && !d.noHeader
+	it.headerInferred = csvHeaderInferred
+	switch {
+	case csvHeaderInferred:
+		firstRec, err := it.readFirstRecord()
 		if err != nil {
 			return nil, fmt.Errorf("unable to infer header from first record: %w", err)
 		}
 		csvHeader = append(csvHeader, firstRec...)
-	} else {
-		csvHeader = append(csvHeader, d.header...)
+	case len(header) == 0:
+		// Headerless: the first record is data; it only sizes the header.
+		firstRec, err := it.readFirstRecord()
+		if err != nil {
+			return nil, fmt.Errorf("unable to infer column count from first record: %w", err)
+		}
+		csvHeader = generatedHeader(len(firstRec))
+		it.pending = firstRec
+		it.pendingSrcMeta = it.rowMeta()
+		it.hasPending = true
+	default:
+		csvHeader = append(csvHeader, header...)
+	}
+	if d.normalize.enabled() {
+		csvHeader = d.normalize.Normalize(csvHeader)
+	}
+	sourceHeader := csvHeader
+	if d.policy != HeaderStrict && csvHeaderInferred {
+		csvHeader = d.rename(csvHeader)
 	}
-	csvReader.FieldsPerRecord = len(csvHeader)
 	if err := validateHeader(csvHeader); err != nil {
 		return nil, fmt.Errorf("malformed header: %w", err)
 	}
-	it := &csvRowIterator{
-		csvReader:      csvReader,
-		srcAwareStream: rc,
-		header:         csvHeader,
-		atStart:        false,
-		invertedIndex:  buildIndex(csvHeader),
-		decoderError:   nil,
-		current:        make([]string, len(csvHeader)),
-		lastSourceMeta: rc.Current(),
+	it.setHeader(csvHeader)
+	it.current = make([]string, len(csvHeader))
+	if d.policy != HeaderStrict && csvHeaderInferred {
+		if err := it.applySourceHeader(sourceHeader); err != nil {
+			return nil, err
+		}
 	}
 	// Best-effort: close the underlying stream if the context is cancelled.
 	go func() {
@@ -137,59 +317,60 @@ func (it *csvRowIterator) Next() bool {
 
 	// Loop to handle header rows and boundaries between sources.
 	for {
-		// 1) Serve any pending record from the pushback buffer.
+		// 0) Serve the first record of a headerless stream, read by Decode.
 		if it.hasPending {
+			it.hasPending = false
 			it.current = it.pending
 			it.currentSrcMeta = it.pendingSrcMeta
-			it.hasPending = false
 			return true
 		}
-		row, err := it.csvReader.Read()
-		meta := it.srcAwareStream.Current()
-		if it.isSourceStart(meta) {
-			it.atStart = true
+		// 1) Move to the next source when the current one is exhausted.
+		if it.csvReader == nil {
+			ok, err := it.openSource()
+			if err != nil {
+				it.decoderError = err
+				return false
+			}
+			if !ok {
+				return false
+			}
+		}
+		row, err := it.readRow()
+		if err == io.EOF {
+			it.csvReader = nil
+			continue
 		}
-		// At the start of a new source, read and classify exactly one row.
+		if err != nil {
+			it.decoderError = err
+			return false
+		}
+		// 2) At the start of a new source, drop a source-local header row.
 		if it.atStart {
-			// read
-			if err == io.EOF {
-				// Empty source: let the connector advance to the next source.
-				it.atStart = false
-				it.lastSourceMeta = meta
+			it.atStart = false
+			if it.decoder.policy != HeaderStrict {
+				if err := it.applySourceHeader(row); err != nil {
+					it.decoderError = err
+					return false
+				}
 				continue
 			}
+			skip, err := it.isSourceHeader(row)
 			if err != nil {
 				it.decoderError = err
 				return false
 			}
-			// 2) if header discrs row and keep looping
-			if it.isHeader(row) {
-				// Source-local header row: drop it and continue the loop
-				// to read the first data row of this source
-				it.atStart = false
-				it.lastSourceMeta = meta
+			if skip {
 				continue
 			}
-			// Not a header: store as pending so the normal path can serve it.
-			it.pending = row
-			it.pendingSrcMeta = meta
-			it.hasPending = true
-			it.atStart = false
-			// serve pending immediately on next iteration
-			continue
-		}
-		// 3) Normal path: read the next data row.
-		if err == io.EOF {
-			return false
 		}
-		if err != nil {
-			it.decoderError = err
+		// 3) Normal path: serve the data row.
+		if !it.decoder.variableFields && len(row) != it.fieldsPerRecord() {
+			line, _ := it.csvReader.FieldPos(0)
+			it.decoderError = &csv.ParseError{StartLine: line, Line: line, Column: 1, Err: csv.ErrFieldCount}
 			return false
 		}
-
 		it.current = row
-		it.currentSrcMeta = meta
-		it.lastSourceMeta = meta
+		it.currentSrcMeta = it.rowMeta()
 		return true
 	}
 }
@@ -199,7 +380,20 @@ func (it *csvRowIterator) Next() bool {
 // The returned Extractor is only valid until the next call to Next;
 // if you need to retain values longer, copy them out.
 func (it *csvRowIterator) Record() Extractor {
-	return sliceExtractor{current: it.current, header: it.header, invIndex: it.invertedIndex, srcMeta: it.currentSrcMeta}
+	if it.projection == nil {
+		return sliceExtractor{current: it.current, header: it.header, invIndex: it.invertedIndex, srcMeta: it.currentSrcMeta, lookup: it.lookup()}
+	}
+	for i, j := range it.projection {
+		if j >= 0 && j < len(it.current) {
+			it.projected[i], it.present[i] = it.current[j], true
+		} else {
+			it.projected[i], it.present[i] = "", false
+		}
+	}
+	return nullableExtractor{
+		sliceExtractor: sliceExtractor{current: it.projected, header: it.header, invIndex: it.invertedIndex, srcMeta: it.currentSrcMeta, lookup: it.lookup()},
+		present:        it.present,
+	}
 }
 
 // Err reports the first non-EOF error encountered while decoding.
@@ -224,8 +418,8 @@ func (s sliceExtractor) ByIndex(i int) (string, bool) {
 
 // ByName returns the field for the given header name and true if present.
 func (s sliceExtractor) ByName(name string) (string, bool) {
-	idx, ok := s.invIndex[name]
-	if !ok {
+	idx, ok := s.indexOf(name)
+	if !ok || idx >= len(s.current) {
 		return "", false
 	}
 	return s.current[idx], true
@@ -250,30 +444,286 @@ func (s sliceExtractor) Meta() connector.SrcMeta {
 // Unexported helpers
 //
 
-// isheader reports whether row matches the canonical header exactly.
+// isHeader reports whether row, once normalized, matches the canonical
+// header exactly.
 func (it *csvRowIterator) isHeader(row []string) bool {
 	hSize, rSize := len(it.header), len(row)
 	if hSize != rSize {
 		return false
 	}
 	for i := range hSize {
-		if it.header[i] != row[i] {
+		if it.header[i] != it.decoder.normalize.Name(row[i]) {
 			return false
 		}
 	}
 	return true
 }
 
-// isSourceStart reports whether meta represents the start of a new source
-// relative to the last observed SrcMeta.
-func (it *csvRowIterator) isSourceStart(meta connector.SrcMeta) bool {
-	if it.lastSourceMeta.Name == "" {
-		return true
+// isSourceHeader reports whether row, the first row of a source, is a
+// source-local header to be skipped because it repeats the canonical
+// header. When the canonical header was read from the data and the sniffed
+// dialect of the source says it starts with a header that differs, its
+// rows cannot be matched to the canonical columns under HeaderStrict, so
+// an error naming the source is returned instead. An explicit header says
+// nothing about the sources, so the sniffer's guess is not trusted then.
+func (it *csvRowIterator) isSourceHeader(row []string) (bool, error) {
+	if it.decoder.noHeader {
+		return false, nil
 	}
-	if meta.Name != it.lastSourceMeta.Name {
-		return true
+	if it.isHeader(row) {
+		return true, nil
+	}
+	if it.headerInferred && it.dialect.sniffed && it.dialect.HasHeader {
+		return false, &connector.SourceError{
+			Source: it.segments.Meta().Name,
+			Err:    fmt.Errorf("header %q differs from the canonical header %q; set a HeaderPolicy to reconcile them", row, it.header),
+		}
+	}
+	return false, nil
+}
+
+// readFirstRecord opens the first source and reads its first record.
+func (it *csvRowIterator) readFirstRecord() ([]string, error) {
+	ok, err := it.openSource()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, io.EOF
+	}
+	it.atStart = false
+	rec, err := it.readRow()
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), rec...), nil
+}
+
+// readRow reads the next record of the current source, dropping a
+// tolerated trailing delimiter.
+func (it *csvRowIterator) readRow() ([]string, error) {
+	start := it.csvReader.InputOffset()
+	if it.translated != nil {
+		start = it.translated.sourceOffset(start)
+	}
+	it.rowStart = it.skipped + start
+	row, err := it.csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	// Header rows may have any length; data rows only lose the trailing
+	// field if it is in excess.
+	headerRow := len(it.header) == 0 || (it.atStart && it.decoder.policy != HeaderStrict)
+	if it.decoder.trailingDelimiter && len(row) > 1 && row[len(row)-1] == "" &&
+		(headerRow || len(row) == it.fieldsPerRecord()+1) {
+		row = row[:len(row)-1]
 	}
-	return meta.ByteOffset == 0 && it.lastSourceMeta.ByteOffset != 0
+	return row, nil
+}
+
+// fieldsPerRecord returns the number of fields data rows of the current
+// source must have.
+func (it *csvRowIterator) fieldsPerRecord() int {
+	if it.projection != nil {
+		return it.sourceFields
+	}
+	return len(it.header)
+}
+
+// rowMeta returns the SrcMeta of the row just read from the current source,
+// whose ByteOffset is where the row starts.
+func (it *csvRowIterator) rowMeta() connector.SrcMeta {
+	return connector.SrcMeta{
+		Name:       it.segments.Meta().Name,
+		ByteOffset: it.rowStart,
+	}
+}
+
+// lookup returns the function ByName applies to its argument, or nil.
+func (it *csvRowIterator) lookup() func(string) string {
+	if !it.decoder.normalize.enabled() {
+		return nil
+	}
+	return it.decoder.normalize.Name
+}
+
+// setHeader replaces the canonical header.
+func (it *csvRowIterator) setHeader(h []string) {
+	it.header = h
+	it.invertedIndex = buildIndex(h)
+	for i, name := range h {
+		alias, ok := it.decoder.aliases[name]
+		if _, taken := it.invertedIndex[alias]; ok && !taken {
+			it.invertedIndex[alias] = i
+		}
+	}
+	it.projected = make([]string, len(h))
+	it.present = make([]bool, len(h))
+}
+
+// applySourceHeader reconciles the header row of a new source with the
+// canonical header according to the header policy, and computes how the
+// source's rows project onto it.
+func (it *csvRowIterator) applySourceHeader(row []string) error {
+	source := it.segments.Meta().Name
+	names := it.decoder.rename(it.decoder.normalize.Normalize(row))
+	if err := validateHeader(names); err != nil {
+		return &connector.SourceError{Source: source, Err: fmt.Errorf("malformed header: %w", err)}
+	}
+	srcIndex := buildIndex(names)
+
+	var canonical []string
+	switch it.decoder.policy {
+	case HeaderUnion:
+		canonical = append([]string(nil), it.header...)
+		for _, n := range names {
+			if _, ok := it.invertedIndex[n]; !ok {
+				canonical = append(canonical, n)
+			}
+		}
+	case HeaderIntersection:
+		for _, n := range it.header {
+			if _, ok := srcIndex[n]; ok {
+				canonical = append(canonical, n)
+			}
+		}
+		if len(canonical) == 0 {
+			return &connector.SourceError{Source: source, Err: fmt.Errorf("header has no column in common with %q", it.header)}
+		}
+	default:
+		canonical = it.header
+	}
+	if len(canonical) != len(it.header) {
+		it.setHeader(canonical)
+	}
+
+	it.projection = make([]int, len(it.header))
+	for i, n := range it.header {
+		j, ok := srcIndex[n]
+		if !ok {
+			j = -1
+		}
+		it.projection[i] = j
+	}
+	it.sourceFields = len(row)
+	return nil
+}
+
+// generatedHeader returns the names "col0" ... "col<n-1>".
+func generatedHeader(n int) []string {
+	h := make([]string, n)
+	for i := range h {
+		h[i] = "col" + strconv.Itoa(i)
+	}
+	return h
+}
+
+// readHeaderFile reads column names from a sidecar file: every non-empty
+// field of every record, so both "a,b,c" and one name per line work.
+func readHeaderFile(path string, comma rune) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	recs, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, rec := range recs {
+		for _, name := range rec {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no column names in %s", path)
+	}
+	return names, nil
+}
+
+// rename maps source column names to canonical names.
+func (d *csvDecoder) rename(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		if m, ok := d.mapping[n]; ok {
+			n = m
+		}
+		out[i] = n
+	}
+	return out
+}
+
+// openSource advances to the next source and prepares a csv.Reader for it,
+// sniffing its dialect first if enabled. It returns false when there are
+// no more sources.
+func (it *csvRowIterator) openSource() (bool, error) {
+	if !it.segments.Next() {
+		return false, it.segments.Err()
+	}
+	var r io.Reader = it.segments
+	it.skipped = 0
+	if it.decoder.skipLines > 0 || it.decoder.skipFooterLines > 0 {
+		br := bufio.NewReader(r)
+		for range it.decoder.skipLines {
+			n, err := skipLine(br)
+			it.skipped += n
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		r = br
+		if it.decoder.skipFooterLines > 0 {
+			r = &footerTrimmer{r: br, n: it.decoder.skipFooterLines}
+		}
+	}
+	it.dialect = it.decoder.defaultDialect()
+	if it.decoder.sniff {
+		br := bufio.NewReaderSize(r, it.decoder.sniffBytes)
+		sample, err := br.Peek(it.decoder.sniffBytes)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return false, err
+		}
+		detected := SniffCSV(sample)
+		if it.decoder.onDialect != nil {
+			it.decoder.onDialect(it.segments.Meta().Name, detected)
+		}
+		if detected.Confidence >= it.decoder.minConfidence {
+			detected.sniffed = true
+			it.dialect = detected
+		}
+		r = br
+	}
+	dr := it.dialect.reader(r)
+	it.translated, _ = dr.(*dialectReader)
+	it.csvReader = it.decoder.newCSVReader(dr, it.dialect)
+	it.atStart = true
+	return true, nil
+}
+
+// newCSVReader returns a csv.Reader configured for the decoder and the
+// dialect of the current source.
+func (d *csvDecoder) newCSVReader(r io.Reader, dialect CSVDialect) *csv.Reader {
+	csvReader := csv.NewReader(r)
+	csvReader.Comma = dialect.Comma
+	csvReader.Comment = d.comment
+	csvReader.ReuseRecord = true
+	csvReader.TrimLeadingSpace = d.trimLeadingSpace
+	// Field counts are checked by the iterator, after a tolerated trailing
+	// delimiter has been dropped.
+	csvReader.FieldsPerRecord = -1
+	// Translated single-quoted input may leave bare '"' in unquoted fields.
+	csvReader.LazyQuotes = d.lazyQuotes || dialect.Quote != '"'
+	return csvReader
 }
 
 type csvDecoder struct {
@@ -282,20 +732,79 @@ type csvDecoder struct {
 	// header holds the canonical header. When empty, it is inferred
 	// from the first record in the stream.
 	header []string
+
+	// sniff enables per-source dialect detection.
+	sniff bool
+	// sniffBytes is the size of the sample used for detection.
+	sniffBytes int
+	// minConfidence is the confidence below which a detected dialect is
+	// ignored.
+	minConfidence float64
+	// onDialect is notified of every detected dialect.
+	onDialect func(source string, d CSVDialect)
+
+	// lazyQuotes, comment and trimLeadingSpace configure csv.Reader.
+	lazyQuotes       bool
+	comment          rune
+	trimLeadingSpace bool
+	// trailingDelimiter drops an excess empty last field.
+	trailingDelimiter bool
+	// skipLines and skipFooterLines are physical lines dropped at the start
+	// and end of every source.
+	skipLines       int
+	skipFooterLines int
+	// variableFields disables the field count check.
+	variableFields bool
+
+	// policy reconciles differing source headers.
+	policy HeaderPolicy
+	// mapping renames source columns to canonical names.
+	mapping map[string]string
+
+	// noHeader declares that sources have no header row.
+	noHeader bool
+	// headerFile is a sidecar file holding the column names.
+	headerFile string
+	// aliases maps header spellings to canonical lookup names.
+	aliases map[string]string
+	// normalize is applied to header names and ByName lookups.
+	normalize HeaderNormalization
 }
 
 type csvRowIterator struct {
-	// csvReader yields one record at a time from the underlying stream.
+	// decoder holds the configuration shared by all sources.
+	decoder *csvDecoder
+	// segments splits srcAwareStream per source.
+	segments *connector.Segmenter
+	// csvReader yields one record at a time from the current source; nil
+	// between sources.
 	csvReader *csv.Reader
+	// dialect is the dialect of the current source.
+	dialect CSVDialect
 	// srcAwareStream exposes both the bytes and their source metadata.
 	srcAwareStream connector.SrcAwareStreamer
 	// header is the canonical header for all records.
 	header []string
 
-	// atStart indicates that we are at the boundary of a new source.
+	// atStart indicates that the next row is the first of a new source.
 	atStart bool
-	// hasPending is true when a peeked record is waiting to be served.
+	// hasPending is true when the first record of a headerless stream,
+	// read by Decode, is waiting to be served.
 	hasPending bool
+	// pending and pendingSrcMeta hold that record and its SrcMeta.
+	pending        []string
+	pendingSrcMeta connector.SrcMeta
+	// skipped counts the bytes of the current source dropped by SkipLines.
+	skipped int64
+	// rowStart is the offset in the current source of the row last read.
+	rowStart int64
+	// translated is the reader rewriting the current source into the form
+	// csvReader parses, if its dialect needs one; its offsets differ from
+	// the source's.
+	translated *dialectReader
+	// headerInferred is true when the canonical header was read from the
+	// first row of the stream.
+	headerInferred bool
 
 	// invertedIndex maps header name → field index in current.
 	invertedIndex map[string]int
@@ -304,17 +813,67 @@ type csvRowIterator struct {
 
 	// current holds the latest record returned by Next.
 	current []string
-	// pending holds a single pushed-back record (used when a non-header
-	// row is read while atStart == true).
-	pending []string
 
 	// currentSrcMeta is the SrcMeta associated with current.
 	currentSrcMeta connector.SrcMeta
-	// pendingSrcMeta is the SrcMeta associated with pending.
-	pendingSrcMeta connector.SrcMeta
 
-	// lastSourceMeta is the last SrcMeta observed from the stream.
-	lastSourceMeta connector.SrcMeta
+	// projection maps each canonical column to its index in the rows of
+	// the current source, or -1 if the source lacks it. It is nil under
+	// HeaderStrict, where rows are used positionally.
+	projection []int
+	// sourceFields is the number of fields in the current source's header.
+	sourceFields int
+	// projected and present hold the current row projected onto the
+	// canonical header.
+	projected []string
+	present   []bool
+}
+
+// skipLine discards one line, returning the number of bytes dropped.
+func skipLine(br *bufio.Reader) (int64, error) {
+	var n int64
+	for {
+		line, err := br.ReadSlice('\n')
+		n += int64(len(line))
+		if err != bufio.ErrBufferFull {
+			return n, err
+		}
+	}
+}
+
+// footerTrimmer withholds the last n lines of the underlying reader.
+type footerTrimmer struct {
+	r *bufio.Reader
+	n int
+	// held are the most recent lines, not yet known not to be footer.
+	held [][]byte
+	// out is the part of a released line not returned yet.
+	out []byte
+	eof bool
+}
+
+func (f *footerTrimmer) Read(p []byte) (int, error) {
+	for len(f.out) == 0 {
+		if f.eof {
+			return 0, io.EOF
+		}
+		line, err := f.r.ReadBytes('\n')
+		if len(line) > 0 {
+			f.held = append(f.held, line)
+		}
+		if len(f.held) > f.n {
+			f.out = f.held[0]
+			f.held = f.held[1:]
+		}
+		if err == io.EOF {
+			f.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	return n, nil
 }
 
 // validateHeader checks for basic header sanity (no duplicate names).
@@ -335,6 +894,17 @@ type sliceExtractor struct {
 	header   []string
 	invIndex map[string]int
 	srcMeta  connector.SrcMeta
+	// lookup, when set, normalizes names passed to ByName.
+	lookup func(string) string
+}
+
+// indexOf returns the position of the named field in the header.
+func (s sliceExtractor) indexOf(name string) (int, bool) {
+	if s.lookup != nil {
+		name = s.lookup(name)
+	}
+	idx, ok := s.invIndex[name]
+	return idx, ok
 }
 
 // buildIndex constructs a name → index map for the provided header names.
@@ -3,6 +3,10 @@ package transform
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/carlodf/cetl/connector"
@@ -134,6 +138,112 @@ var cases = []testCase{
 		expectedHeader: nil,
 		expectedErr:    errors.New("malformed header: duplicate entry col1 in header [\"col1\" \"col1\"]"),
 	},
+	{
+		name: "no header generated names",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte("1,2\n3,4\n"),
+				SourceName: "TestSource1",
+			},
+			opener.InMemorySource{
+				Data:       []byte("col0,col1\n"),
+				SourceName: "TestSource2",
+			},
+		},
+		opt:            CSVDecoderOptions{NoHeader: true},
+		expectedRows:   [][]string{{"1", "2"}, {"3", "4"}, {"col0", "col1"}},
+		expectedHeader: []string{"col0", "col1"},
+	},
+	{
+		name: "no header empty stream",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte(""),
+				SourceName: "TestSource1",
+			},
+		},
+		opt:            CSVDecoderOptions{NoHeader: true},
+		expectedRows:   nil,
+		expectedHeader: nil,
+		expectedErr:    errors.New("unable to infer column count from first record: EOF"),
+	},
+	{
+		name: "skip banner and footer lines per source",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte("EXPORT v1\ngenerated today\na,b\n1,2\nTOTAL 1\n"),
+				SourceName: "TestSource1",
+			},
+			opener.InMemorySource{
+				Data:       []byte("EXPORT v1\ngenerated today\na,b\n3,4\nTOTAL 1"),
+				SourceName: "TestSource2",
+			},
+		},
+		opt:            CSVDecoderOptions{SkipLines: 2, SkipFooterLines: 1},
+		expectedRows:   [][]string{{"1", "2"}, {"3", "4"}},
+		expectedHeader: []string{"a", "b"},
+	},
+	{
+		name: "sniff after skipping banner and footer lines",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte("BANNER LINE\na;b;c\n1;2;3\n4;5;6\nFOOTER\n"),
+				SourceName: "TestSource1",
+			},
+		},
+		opt:            CSVDecoderOptions{Sniff: true, SkipLines: 1, SkipFooterLines: 1},
+		expectedRows:   [][]string{{"1", "2", "3"}, {"4", "5", "6"}},
+		expectedHeader: []string{"a", "b", "c"},
+	},
+	{
+		name: "trailing delimiter tolerated",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte("a,b,\n1,2,\n3,4\n"),
+				SourceName: "TestSource1",
+			},
+		},
+		opt:            CSVDecoderOptions{TrailingDelimiter: true},
+		expectedRows:   [][]string{{"1", "2"}, {"3", "4"}},
+		expectedHeader: []string{"a", "b"},
+	},
+	{
+		name: "variable field counts",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte("a,b\n1\n2,3,4\n"),
+				SourceName: "TestSource1",
+			},
+		},
+		opt:            CSVDecoderOptions{VariableFields: true},
+		expectedRows:   [][]string{{"1"}, {"2", "3", "4"}},
+		expectedHeader: []string{"a", "b"},
+	},
+	{
+		name: "comments lazy quotes and leading space",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte("a;b\n# note\n x;say \"hi\"\n"),
+				SourceName: "TestSource1",
+			},
+		},
+		opt:            CSVDecoderOptions{Comma: ';', Comment: '#', LazyQuotes: true, KeepLeadingSpace: true},
+		expectedRows:   [][]string{{" x", "say \"hi\""}},
+		expectedHeader: []string{"a", "b"},
+	},
+	{
+		name: "bare quote without lazy quotes",
+		sources: []opener.Opener{
+			opener.InMemorySource{
+				Data:       []byte("a,b\nx,say \"hi\"\n"),
+				SourceName: "TestSource1",
+			},
+		},
+		opt:            CSVDecoderOptions{},
+		expectedRows:   nil,
+		expectedHeader: nil,
+		expectedErr:    errors.New("parse error on line 2, column 7: bare \" in non-quoted-field"),
+	},
 }
 
 func TestCSVDecoder(t *testing.T) {
@@ -198,3 +308,325 @@ func rowEqualRecord(a []string, b Extractor) bool {
 	}
 	return true
 }
+
+func TestCSVDecoder_HeaderPolicies(t *testing.T) {
+	sources := []opener.Opener{
+		opener.InMemorySource{Data: []byte("id,name\n1,alice\n"), SourceName: "jan.csv"},
+		opener.InMemorySource{Data: []byte("name,id,email\nbob,2,b@x\n"), SourceName: "feb.csv"},
+		opener.InMemorySource{Data: []byte("ID,email\n3,c@x\n"), SourceName: "mar.csv"},
+	}
+	mapping := map[string]string{"ID": "id"}
+	policyCases := []struct {
+		name string
+		opt  CSVDecoderOptions
+		want []string
+	}{
+		{
+			name: "union",
+			opt:  CSVDecoderOptions{HeaderPolicy: HeaderUnion, HeaderMapping: mapping},
+			want: []string{
+				"[id name]=1|alice",
+				"[id name email]=2|bob|b@x",
+				"[id name email]=3|<null>|c@x",
+			},
+		},
+		{
+			name: "intersection",
+			opt:  CSVDecoderOptions{HeaderPolicy: HeaderIntersection, HeaderMapping: mapping},
+			want: []string{
+				"[id name]=1|alice",
+				"[id name]=2|bob",
+				"[id]=3",
+			},
+		},
+		{
+			name: "mapped explicit header",
+			opt:  CSVDecoderOptions{HeaderPolicy: HeaderMapped, HeaderMapping: mapping, Header: []string{"email", "id"}},
+			want: []string{
+				"[email id]=<null>|1",
+				"[email id]=b@x|2",
+				"[email id]=c@x|3",
+			},
+		},
+	}
+	ctx := context.Background()
+	for _, tc := range policyCases {
+		it, err := NewCSVDecoder(tc.opt).Decode(ctx, connector.NewMuxReader(ctx, sources))
+		if err != nil {
+			t.Fatalf("%s: Decode: %v", tc.name, err)
+		}
+		var got []string
+		for it.Next() {
+			rec := it.Record()
+			var vals []string
+			for _, n := range rec.Names() {
+				v, ok := rec.ByName(n)
+				if !ok {
+					v = "<null>"
+				}
+				vals = append(vals, v)
+			}
+			got = append(got, fmt.Sprintf("%v=%s", rec.Names(), strings.Join(vals, "|")))
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("%s: Err: %v", tc.name, err)
+		}
+		_ = it.Close()
+		if !equalSilce(got, tc.want) {
+			t.Fatalf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCSVDecoder_HeaderIntersectionEmpty(t *testing.T) {
+	ctx := context.Background()
+	sources := []opener.Opener{
+		opener.InMemorySource{Data: []byte("a\n1\n"), SourceName: "one.csv"},
+		opener.InMemorySource{Data: []byte("b\n2\n"), SourceName: "two.csv"},
+	}
+	it, err := NewCSVDecoder(CSVDecoderOptions{HeaderPolicy: HeaderIntersection}).Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	for it.Next() {
+	}
+	if err := it.Err(); err == nil || !strings.Contains(err.Error(), "no column in common") {
+		t.Fatalf("Err = %v, want no column in common", err)
+	}
+}
+
+func TestCSVDecoder_HeaderFileAndAliases(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "schema.txt")
+	if err := os.WriteFile(path, []byte("cust_id\nname\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	sources := []opener.Opener{
+		opener.InMemorySource{Data: []byte("7,alice\n"), SourceName: "a.csv"},
+	}
+	dec := NewCSVDecoder(CSVDecoderOptions{
+		NoHeader:   true,
+		HeaderFile: path,
+		Aliases:    map[string]string{"cust_id": "customer_id"},
+	})
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("expected a row, err: %v", it.Err())
+	}
+	rec := it.Record()
+	if v, ok := rec.ByName("customer_id"); !ok || v != "7" {
+		t.Fatalf("ByName(customer_id) = %q, %v", v, ok)
+	}
+	if v, ok := rec.ByName("cust_id"); !ok || v != "7" {
+		t.Fatalf("ByName(cust_id) = %q, %v", v, ok)
+	}
+	if !equalSilce(rec.Names(), []string{"cust_id", "name"}) {
+		t.Fatalf("Names() = %q", rec.Names())
+	}
+
+	_, err = NewCSVDecoder(CSVDecoderOptions{
+		HeaderPolicy:  HeaderMapped,
+		Aliases:       map[string]string{"cust_id": "customer_id"},
+		HeaderMapping: map[string]string{"id": "cust_id"},
+	}).Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err == nil || !strings.Contains(err.Error(), "cannot both be set") {
+		t.Fatalf("Aliases with HeaderMapping err = %v", err)
+	}
+
+	_, err = NewCSVDecoder(CSVDecoderOptions{HeaderFile: filepath.Join(dir, "missing")}).
+		Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err == nil || !strings.Contains(err.Error(), "reading header file") {
+		t.Fatalf("missing header file err = %v", err)
+	}
+}
+
+func TestCSVDecoder_HeaderNormalization(t *testing.T) {
+	ctx := context.Background()
+	sources := []opener.Opener{
+		opener.InMemorySource{Data: []byte("\ufeffCustomer ID, Full Name \n1,alice\n"), SourceName: "a.csv"},
+		opener.InMemorySource{Data: []byte("customer_id,FullName\n2,bob\n"), SourceName: "b.csv"},
+		opener.InMemorySource{Data: []byte("CUSTOMER_ID,full_name\n3,carol\n"), SourceName: "c.csv"},
+	}
+	dec := NewCSVDecoder(CSVDecoderOptions{
+		KeepLeadingSpace: true,
+		Normalize:        HeaderNormalization{StripBOM: true, TrimSpace: true, SnakeCase: true},
+	})
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		rec := it.Record()
+		if !equalSilce(rec.Names(), []string{"customer_id", "full_name"}) {
+			t.Fatalf("Names() = %q", rec.Names())
+		}
+		id, ok := rec.ByName("Customer ID")
+		if !ok {
+			t.Fatalf("ByName(Customer ID) missing in %s", rec.Meta().Name)
+		}
+		name, _ := rec.ByName("full_name")
+		got = append(got, id+"="+name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := "1=alice,2=bob,3=carol"; strings.Join(got, ",") != want {
+		t.Fatalf("rows = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestCSVDecoder_HeaderNormalizationCompact(t *testing.T) {
+	ctx := context.Background()
+	sources := []opener.Opener{
+		opener.InMemorySource{Data: []byte("Customer ID\n1\n"), SourceName: "a.csv"},
+		opener.InMemorySource{Data: []byte("customer_id\n2\n"), SourceName: "b.csv"},
+		opener.InMemorySource{Data: []byte("CUSTOMERID\n3\n"), SourceName: "c.csv"},
+	}
+	dec := NewCSVDecoder(CSVDecoderOptions{Normalize: HeaderNormalization{Compact: true}})
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		for _, name := range []string{"Customer ID", "customer_id", "CUSTOMERID"} {
+			id, ok := it.Record().ByName(name)
+			if !ok {
+				t.Fatalf("ByName(%q) missing in %s", name, it.Record().Meta().Name)
+			}
+			got = append(got, id)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := "1,1,1,2,2,2,3,3,3"; strings.Join(got, ",") != want {
+		t.Fatalf("ids = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestCSVDecoder_HeaderNormalizationMapping(t *testing.T) {
+	ctx := context.Background()
+	sources := []opener.Opener{
+		opener.InMemorySource{Data: []byte("Cust ID,Name\n1,alice\n"), SourceName: "a.csv"},
+		opener.InMemorySource{Data: []byte("NAME,CUSTOMER ID\nbob,2\n"), SourceName: "b.csv"},
+	}
+	dec := NewCSVDecoder(CSVDecoderOptions{
+		HeaderPolicy:  HeaderMapped,
+		HeaderMapping: map[string]string{"Cust ID": "Customer ID"},
+		Normalize:     HeaderNormalization{TrimSpace: true, SnakeCase: true},
+	})
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		id, _ := it.Record().ByName("customer_id")
+		name, _ := it.Record().ByName("name")
+		got = append(got, id+"="+name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := "1=alice,2=bob"; strings.Join(got, ",") != want {
+		t.Fatalf("rows = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestCSVDecoder_TranscodedSources(t *testing.T) {
+	ctx := context.Background()
+	utf16le := []byte{0xff, 0xfe}
+	for _, c := range "id,name\n3,Zoë\n" {
+		utf16le = append(utf16le, byte(c), 0)
+	}
+	sources := opener.TranscodeAll([]opener.Opener{
+		opener.InMemorySource{Data: []byte("id,name\n1,alice\n"), SourceName: "a.csv"},
+		opener.InMemorySource{Data: []byte("\xef\xbb\xbfid,name\n2,bob\n"), SourceName: "b.csv"},
+		opener.InMemorySource{Data: utf16le, SourceName: "c.csv"},
+		opener.InMemorySource{Data: []byte("id,name\n4,Jos\xe9\n"), SourceName: "d.csv"},
+	}, opener.EncodingAuto)
+	it, err := NewCSVDecoder(CSVDecoderOptions{}).Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		id, _ := it.Record().ByName("id")
+		name, _ := it.Record().ByName("name")
+		got = append(got, id+"="+name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := "1=alice,2=bob,3=Zoë,4=José"; strings.Join(got, ",") != want {
+		t.Fatalf("rows = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestCSVDecoder_RecordOffsets(t *testing.T) {
+	ctx := context.Background()
+	sources := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.csv", Data: []byte("BANNER\nid,v\n1,x\n22,yy\n")},
+		opener.InMemorySource{SourceName: "b.csv", Data: []byte("BANNER\nid,v\n3,z\n")},
+	}
+	it, err := NewCSVDecoder(CSVDecoderOptions{SkipLines: 1}).Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		m := it.Record().Meta()
+		got = append(got, fmt.Sprintf("%s@%d", m.Name, m.ByteOffset))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// Offsets are where each record starts in its source.
+	if want := []string{"a.csv@12", "a.csv@16", "b.csv@12"}; !equalSilce(got, want) {
+		t.Fatalf("offsets = %q, want %q", got, want)
+	}
+}
+
+func TestCSVDecoder_SniffedHeaderOnlyWithInferredHeader(t *testing.T) {
+	ctx := context.Background()
+	for _, opt := range []CSVDecoderOptions{
+		{Sniff: true, Header: []string{"name", "city"}},
+		{Sniff: true, NoHeader: true},
+	} {
+		sources := []opener.Opener{
+			// The odd lengths of the first rows make the sniffer guess
+			// a header.
+			opener.InMemorySource{SourceName: "a.csv", Data: []byte("anna;paris\nbob;oslo\ncid;lima\n")},
+			opener.InMemorySource{SourceName: "b.csv", Data: []byte("dora;quito\neve;bern\nfay;rome\n")},
+		}
+		it, err := NewCSVDecoder(opt).Decode(ctx, connector.NewMuxReader(ctx, sources))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for it.Next() {
+			v, _ := it.Record().ByIndex(0)
+			got = append(got, v)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		it.Close()
+		if want := []string{"anna", "bob", "cid", "dora", "eve", "fay"}; !equalSilce(got, want) {
+			t.Fatalf("%+v: rows = %q, want %q", opt, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package transform
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"io"
+	"slices"
+)
+
+//
+// Public API
+//
+
+// CSVEncoderOptions configures a CSV Encoder.
+//
+// Comma is the field delimiter and defaults to ','. UseCRLF ends rows with
+// \r\n instead of \n.
+//
+// Header fixes the columns of the output: each record is projected onto it
+// by name, fields the record lacks being written empty. When Header is
+// empty, the Names of the first record are used, so a header-aware decoder
+// converts with its header; columns that only appear in later records are
+// dropped. Records without names are written by index. NoHeader omits the
+// header row, but still projects records onto Header when it is set.
+type CSVEncoderOptions struct {
+	Comma    rune
+	Header   []string
+	NoHeader bool
+	UseCRLF  bool
+}
+
+// NewCSVEncoder returns an Encoder writing records as CSV rows, with the
+// quoting rules of encoding/csv. When Header is set, the header row is
+// written even if there is no record.
+func NewCSVEncoder(opt CSVEncoderOptions) Encoder {
+	return csvEncoder{opt: opt}
+}
+
+//
+// Unexported helpers
+//
+
+type csvEncoder struct {
+	opt CSVEncoderOptions
+}
+
+func (e csvEncoder) Encode(ctx context.Context, w io.Writer, it RecordIterator) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	if e.opt.Comma != 0 {
+		cw.Comma = e.opt.Comma
+	}
+	cw.UseCRLF = e.opt.UseCRLF
+
+	header := slices.Clone(e.opt.Header)
+	writeHeader := func() error {
+		if e.opt.NoHeader || len(header) == 0 {
+			return nil
+		}
+		return cw.Write(header)
+	}
+
+	var (
+		started  bool
+		byIndex  bool
+		row      []string
+		writeErr error
+	)
+	n, err := encodeRecords(ctx, it, func(rec Extractor) error {
+		if !started {
+			started = true
+			names := rec.Names()
+			if len(header) == 0 {
+				header = names
+			}
+			// Without names there is nothing to project by.
+			byIndex = len(names) == 0
+			if err := writeHeader(); err != nil {
+				return err
+			}
+		}
+		row = row[:0]
+		if byIndex {
+			for i := range rec.Len() {
+				v, _ := rec.ByIndex(i)
+				row = append(row, v)
+			}
+		} else {
+			for _, name := range header {
+				v, _ := rec.ByName(name)
+				row = append(row, v)
+			}
+		}
+		return cw.Write(row)
+	})
+	if err == nil && !started {
+		writeErr = writeHeader()
+	}
+	cw.Flush()
+	if writeErr == nil {
+		writeErr = cw.Error()
+	}
+	if writeErr == nil {
+		writeErr = bw.Flush()
+	}
+	if err == nil {
+		err = writeErr
+	}
+	return n, err
+}
+
+// encodeRecords calls write with each record of it, checking ctx before
+// each one, then closes it. It returns the number of records written and
+// the first error of write, it or ctx.
+func encodeRecords(ctx context.Context, it RecordIterator, write func(Extractor) error) (n int64, err error) {
+	defer func() {
+		if cerr := it.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if err := write(it.Record()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, it.Err()
+}
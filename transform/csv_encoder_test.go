@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/opener"
+)
+
+func TestCSVEncoder(t *testing.T) {
+	named := func(vals ...string) Extractor {
+		return stubExtractor{vals: vals, names: []string{"id", "name"}}
+	}
+	cases := []struct {
+		name string
+		opt  CSVEncoderOptions
+		recs []Extractor
+		want string
+	}{
+		{
+			name: "header from names",
+			recs: []Extractor{named("1", "ann"), named("2", "b,c")},
+			want: "id,name\n1,ann\n2,\"b,c\"\n",
+		},
+		{
+			name: "explicit header projects by name",
+			opt:  CSVEncoderOptions{Header: []string{"name", "email"}, Comma: '|'},
+			recs: []Extractor{named("1", "ann")},
+			want: "name|email\nann|\n",
+		},
+		{
+			name: "no header",
+			opt:  CSVEncoderOptions{NoHeader: true, UseCRLF: true},
+			recs: []Extractor{named("1", "ann")},
+			want: "1,ann\r\n",
+		},
+		{
+			name: "records without names",
+			recs: []Extractor{stubExtractor{vals: []string{"a", "b", "c"}}, stubExtractor{vals: []string{"d"}}},
+			want: "a,b,c\nd\n",
+		},
+		{
+			name: "explicit header without records",
+			opt:  CSVEncoderOptions{Header: []string{"id"}},
+			want: "id\n",
+		},
+	}
+	for _, tc := range cases {
+		var buf strings.Builder
+		it := &stubRecordIterator{recs: tc.recs}
+		n, err := NewCSVEncoder(tc.opt).Encode(context.Background(), &buf, it)
+		if err != nil {
+			t.Fatalf("%s: Encode: %v", tc.name, err)
+		}
+		if buf.String() != tc.want || n != int64(len(tc.recs)) {
+			t.Fatalf("%s: got %q (%d records), want %q", tc.name, buf.String(), n, tc.want)
+		}
+		if !it.closed {
+			t.Fatalf("%s: iterator not closed", tc.name)
+		}
+	}
+}
+
+func TestCSVEncoder_Errors(t *testing.T) {
+	readErr := errors.New("bad record")
+	it := &stubRecordIterator{recs: []Extractor{stubExtractor{vals: []string{"a"}}}, err: readErr}
+	var buf strings.Builder
+	n, err := NewCSVEncoder(CSVEncoderOptions{}).Encode(context.Background(), &buf, it)
+	if !errors.Is(err, readErr) || n != 1 || buf.String() != "a\n" {
+		t.Fatalf("n = %d, err = %v, output %q", n, err, buf.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it = &stubRecordIterator{recs: []Extractor{stubExtractor{vals: []string{"a"}}}}
+	if _, err := NewCSVEncoder(CSVEncoderOptions{}).Encode(ctx, &buf, it); !errors.Is(err, context.Canceled) || !it.closed {
+		t.Fatalf("err = %v, closed %v", err, it.closed)
+	}
+}
+
+func TestCSVEncoder_ConvertsDecodedPSV(t *testing.T) {
+	ctx := context.Background()
+	sources := []opener.Opener{
+		opener.InMemorySource{Data: []byte("id|note\n1|a,b\n"), SourceName: "a.psv"},
+		opener.InMemorySource{Data: []byte("id|note\n2|\"quoted\"\n"), SourceName: "b.psv"},
+	}
+	it, err := NewCSVDecoder(CSVDecoderOptions{Comma: '|'}).Decode(ctx, connector.NewMuxReader(ctx, sources))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	var buf strings.Builder
+	n, err := NewCSVEncoder(CSVEncoderOptions{}).Encode(ctx, &buf, it)
+	if err != nil || n != 2 {
+		t.Fatalf("Encode: %d, %v", n, err)
+	}
+	if want := "id,note\n1,\"a,b\"\n2,quoted\n"; buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,326 @@
+package transform
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//
+// Public API
+//
+
+// CSVDialect describes how a CSV source is formatted.
+//
+// Dialects are detected by SniffCSV, or per source by a decoder built with
+// CSVDecoderOptions.Sniff.
+type CSVDialect struct {
+	// Comma is the field delimiter: ',', ';', '|' or '\t'.
+	Comma rune
+	// Quote is the quote character: '"' or '\''.
+	Quote rune
+	// HasHeader reports whether the first row looks like a header row.
+	HasHeader bool
+	// LineTerminator is "\n", "\r\n" or "\r".
+	LineTerminator string
+	// Confidence is a score in [0, 1]: the share of sampled lines with the
+	// same number of fields under the detected delimiter. Samples with a
+	// single line score lower.
+	Confidence float64
+
+	// sniffed is set when the dialect was detected rather than configured.
+	sniffed bool
+}
+
+// sniffDelimiters are the delimiters SniffCSV chooses from, by preference
+// when they score equally.
+var sniffDelimiters = []rune{',', ';', '|', '\t'}
+
+// SniffCSV infers the dialect of a CSV sample, typically the first few
+// kilobytes of a source. A trailing partial line is ignored.
+//
+// The delimiter is the candidate that splits the sampled lines into the
+// most consistent number of fields (at least two); among equally consistent
+// candidates, the one yielding more fields wins. The header row is
+// detected by comparing the first row with the following ones: a column
+// whose values are all numbers, or all of the same length, votes for a
+// header when the first row's cell differs in kind.
+func SniffCSV(sample []byte) CSVDialect {
+	text := string(sample)
+	d := CSVDialect{Comma: ',', Quote: '"', LineTerminator: sniffLineTerminator(text)}
+
+	if d.LineTerminator != "\n" {
+		text = strings.ReplaceAll(text, d.LineTerminator, "\n")
+	}
+	lines := strings.Split(text, "\n")
+	if last := lines[len(lines)-1]; last == "" || (len(lines) > 1 && !strings.HasSuffix(text, "\n")) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return d
+	}
+	d.Quote = sniffQuote(lines)
+
+	best, bestFields := 0.0, 0
+	for _, delim := range sniffDelimiters {
+		score, fields := delimiterConsistency(lines, delim, d.Quote)
+		if score > best || (score == best && score > 0 && fields > bestFields) {
+			best, bestFields, d.Comma = score, fields, delim
+		}
+	}
+	d.Confidence = best
+	if len(lines) < 2 {
+		d.Confidence *= 0.5
+	}
+	if best > 0 {
+		d.HasHeader = sniffHeader(strings.Join(lines, "\n"), d)
+	}
+	return d
+}
+
+//
+// Unexported helpers
+//
+
+// defaultDialect is the dialect configured by CSVDecoderOptions, used when
+// sniffing is disabled or not confident enough.
+func (d *csvDecoder) defaultDialect() CSVDialect {
+	return CSVDialect{Comma: d.comma, Quote: '"', LineTerminator: "\n", Confidence: 1}
+}
+
+// reader returns r adapted so that encoding/csv, which only understands
+// '"' quotes and "\n" or "\r\n" line endings, can parse the dialect.
+func (d CSVDialect) reader(r io.Reader) io.Reader {
+	if d.Quote != '\'' && d.LineTerminator != "\r" {
+		return r
+	}
+	return &dialectReader{r: bufio.NewReader(r), dialect: d, atFieldStart: true}
+}
+
+func sniffLineTerminator(text string) string {
+	crlf := strings.Count(text, "\r\n")
+	cr := strings.Count(text, "\r") - crlf
+	lf := strings.Count(text, "\n") - crlf
+	switch {
+	case crlf > 0 && crlf >= lf && crlf >= cr:
+		return "\r\n"
+	case cr > lf:
+		return "\r"
+	default:
+		return "\n"
+	}
+}
+
+// sniffQuote picks the quote character that most often opens a field.
+func sniffQuote(lines []string) rune {
+	count := map[rune]int{}
+	for _, line := range lines {
+		prev := rune(0)
+		for i, c := range line {
+			if (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(",;|\t", prev)) {
+				count[c]++
+			}
+			if c != ' ' {
+				prev = c
+			}
+		}
+	}
+	if count['\''] > count['"'] {
+		return '\''
+	}
+	return '"'
+}
+
+// delimiterConsistency returns the share of lines that split into the most
+// common field count under delim, or 0 if that count is below two, along
+// with that field count.
+func delimiterConsistency(lines []string, delim, quote rune) (float64, int) {
+	freq := map[int]int{}
+	for _, line := range lines {
+		freq[countFields(line, delim, quote)]++
+	}
+	mode, modeFreq := 0, 0
+	for n, f := range freq {
+		if f > modeFreq || (f == modeFreq && n > mode) {
+			mode, modeFreq = n, f
+		}
+	}
+	if mode < 2 {
+		return 0, mode
+	}
+	return float64(modeFreq) / float64(len(lines)), mode
+}
+
+// countFields counts the fields of a single line, ignoring delimiters
+// inside quotes.
+func countFields(line string, delim, quote rune) int {
+	n, inQuotes := 1, false
+	for _, c := range line {
+		switch {
+		case c == quote:
+			inQuotes = !inQuotes
+		case c == delim && !inQuotes:
+			n++
+		}
+	}
+	return n
+}
+
+// sniffHeader decides whether the first row of text is a header.
+func sniffHeader(text string, d CSVDialect) bool {
+	r := csv.NewReader(d.reader(strings.NewReader(text)))
+	r.Comma = d.Comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil || len(rows) < 2 {
+		return false
+	}
+	header, data := rows[0], rows[1:]
+	if len(data) > 20 {
+		data = data[:20]
+	}
+	votes := 0
+	for col, cell := range header {
+		numeric, length := true, -1
+		for _, row := range data {
+			if col >= len(row) {
+				numeric, length = false, -2
+				break
+			}
+			v := row[col]
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				numeric = false
+			}
+			switch {
+			case length == -1:
+				length = len(v)
+			case length != len(v):
+				length = -2
+			}
+		}
+		switch {
+		case numeric:
+			if _, err := strconv.ParseFloat(cell, 64); err != nil {
+				votes++
+			} else {
+				votes--
+			}
+		case length >= 0:
+			if len(cell) != length {
+				votes++
+			} else {
+				votes--
+			}
+		}
+	}
+	return votes > 0
+}
+
+// dialectReader rewrites a single-quoted and/or CR-terminated CSV stream
+// into the double-quoted, LF-terminated form encoding/csv expects.
+type dialectReader struct {
+	r       *bufio.Reader
+	dialect CSVDialect
+	// out holds translated bytes not yet returned.
+	out []byte
+	// inQuotes is true inside a quoted field.
+	inQuotes bool
+	// atFieldStart is true when the next byte may open a quoted field.
+	atFieldStart bool
+	// read and written count the bytes consumed from r and produced.
+	read, written int64
+	// shifts records, in order, where the distance between source and
+	// translated offsets changes, for sourceOffset.
+	shifts []offsetShift
+}
+
+// offsetShift says that translated offsets from out on are delta bytes
+// behind the source offsets.
+type offsetShift struct {
+	out, delta int64
+}
+
+// sourceOffset converts an offset in the translated stream, such as
+// csv.Reader.InputOffset, to the offset of the same byte in the source.
+// Offsets must be queried in increasing order.
+func (t *dialectReader) sourceOffset(out int64) int64 {
+	for len(t.shifts) > 1 && t.shifts[1].out <= out {
+		t.shifts = t.shifts[1:]
+	}
+	if len(t.shifts) > 0 && t.shifts[0].out <= out {
+		return out + t.shifts[0].delta
+	}
+	return out
+}
+
+func (t *dialectReader) Read(p []byte) (int, error) {
+	for len(t.out) < len(p) {
+		c, err := t.r.ReadByte()
+		if err != nil {
+			if len(t.out) > 0 {
+				break
+			}
+			return 0, err
+		}
+		t.read++
+		before := len(t.out)
+		t.translate(c)
+		t.written += int64(len(t.out) - before)
+		if delta := t.read - t.written; delta != t.delta() {
+			t.shifts = append(t.shifts, offsetShift{out: t.written, delta: delta})
+		}
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+// delta returns the current distance between source and translated
+// offsets.
+func (t *dialectReader) delta() int64 {
+	if len(t.shifts) == 0 {
+		return 0
+	}
+	return t.shifts[len(t.shifts)-1].delta
+}
+
+func (t *dialectReader) translate(c byte) {
+	if c == '\r' && t.dialect.LineTerminator == "\r" {
+		c = '\n'
+	}
+	if t.dialect.Quote != '\'' {
+		t.out = append(t.out, c)
+		return
+	}
+	switch {
+	case t.inQuotes && c == '\'':
+		if next, err := t.r.Peek(1); err == nil && next[0] == '\'' {
+			_, _ = t.r.ReadByte()
+			t.read++
+			t.out = append(t.out, '\'')
+			return
+		}
+		t.inQuotes = false
+		t.out = append(t.out, '"')
+	case t.inQuotes && c == '"':
+		t.out = append(t.out, '"', '"')
+	case t.inQuotes:
+		t.out = append(t.out, c)
+	case t.atFieldStart && c == '\'':
+		t.inQuotes = true
+		t.atFieldStart = false
+		t.out = append(t.out, '"')
+	default:
+		t.out = append(t.out, c)
+		switch {
+		case rune(c) == t.dialect.Comma || c == '\n':
+			t.atFieldStart = true
+		case c != ' ' && c != '\t' && c != '\r':
+			t.atFieldStart = false
+		}
+	}
+}
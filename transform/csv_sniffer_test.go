@@ -0,0 +1,176 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/opener"
+)
+
+func TestSniffCSV(t *testing.T) {
+	cases := []struct {
+		name   string
+		sample string
+		want   CSVDialect
+	}{
+		{
+			name:   "comma with header",
+			sample: "id,name,amount\n1,alice,10.5\n2,bob,3\n",
+			want:   CSVDialect{Comma: ',', Quote: '"', HasHeader: true, LineTerminator: "\n"},
+		},
+		{
+			name:   "semicolon crlf no header",
+			sample: "1;alice;10,5\r\n2;bob;3,0\r\n3;carol;1,0\r\n",
+			want:   CSVDialect{Comma: ';', Quote: '"', HasHeader: false, LineTerminator: "\r\n"},
+		},
+		{
+			name:   "pipe with quoted delimiters",
+			sample: "code|desc\nA1|\"x|y\"\nB2|\"z\"\n",
+			want:   CSVDialect{Comma: '|', Quote: '"', HasHeader: true, LineTerminator: "\n"},
+		},
+		{
+			name:   "tab single quotes partial last line",
+			sample: "'a'\t'b'\n'1'\t'2'\n'3'\t'4'\n'5'\t'",
+			want:   CSVDialect{Comma: '\t', Quote: '\'', HasHeader: true, LineTerminator: "\n"},
+		},
+		{
+			name:   "carriage return terminator",
+			sample: "k,v\r1,2\r3,4\r",
+			want:   CSVDialect{Comma: ',', Quote: '"', HasHeader: true, LineTerminator: "\r"},
+		},
+	}
+	for _, tc := range cases {
+		got := SniffCSV([]byte(tc.sample))
+		if got.Confidence < 0.99 {
+			t.Fatalf("%s: confidence = %v, want 1", tc.name, got.Confidence)
+		}
+		got.Confidence = 0
+		if got != tc.want {
+			t.Fatalf("%s: SniffCSV = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSniffCSV_LowConfidence(t *testing.T) {
+	if d := SniffCSV([]byte("just some words\nno delimiters here\n")); d.Confidence != 0 {
+		t.Fatalf("Confidence = %v, want 0", d.Confidence)
+	}
+	if d := SniffCSV([]byte("a,b\n")); d.Confidence >= 0.6 {
+		t.Fatalf("single line Confidence = %v, want < 0.6", d.Confidence)
+	}
+}
+
+func TestCSVDecoder_SniffPerSource(t *testing.T) {
+	ctx := context.Background()
+	srcs := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.csv", Data: []byte("id,name\n1,alice\n2,bob\n")},
+		opener.InMemorySource{SourceName: "b.csv", Data: []byte("ID;NAME\r\n3;carol\r\n4;dave\r\n")},
+		opener.InMemorySource{SourceName: "c.csv", Data: []byte("'5'|'o''neil'\n'6'|'say \"hi\"'\n")},
+	}
+	detected := map[string]CSVDialect{}
+	dec := NewCSVDecoder(CSVDecoderOptions{
+		Sniff: true,
+		OnDialect: func(source string, d CSVDialect) {
+			detected[source] = d
+		},
+		// b.csv repeats the header in upper case.
+		Normalize: HeaderNormalization{CaseFold: true},
+	})
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, srcs))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		rec := it.Record()
+		id, _ := rec.ByName("id")
+		name, _ := rec.ByName("name")
+		got = append(got, rec.Meta().Name+":"+id+"="+name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	want := `a.csv:1=alice,a.csv:2=bob,b.csv:3=carol,b.csv:4=dave,c.csv:5=o'neil,c.csv:6=say "hi"`
+	if strings.Join(got, ",") != want {
+		t.Fatalf("rows = %s\nwant   %s", strings.Join(got, ","), want)
+	}
+	if d := detected["b.csv"]; d.Comma != ';' || d.LineTerminator != "\r\n" || !d.HasHeader {
+		t.Fatalf("b.csv dialect = %+v", d)
+	}
+	if d := detected["c.csv"]; d.Comma != '|' || d.Quote != '\'' || d.HasHeader {
+		t.Fatalf("c.csv dialect = %+v", d)
+	}
+}
+
+func TestCSVDecoder_SniffedDifferentHeaderFails(t *testing.T) {
+	ctx := context.Background()
+	srcs := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.csv", Data: []byte("id,name\n1,alice\n2,bob\n")},
+		opener.InMemorySource{SourceName: "b.csv", Data: []byte("name;id\ncarol;3\ndave;4\n")},
+	}
+	it, err := NewCSVDecoder(CSVDecoderOptions{Sniff: true}).Decode(ctx, connector.NewMuxReader(ctx, srcs))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); n != 2 || err == nil || !strings.Contains(err.Error(), "b.csv") {
+		t.Fatalf("read %d rows, Err = %v; want 2 rows and an error naming b.csv", n, err)
+	}
+}
+
+func TestCSVDecoder_SniffFallsBackWhenNotConfident(t *testing.T) {
+	ctx := context.Background()
+	srcs := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.psv", Data: []byte("x|y\n")},
+	}
+	dec := NewCSVDecoder(CSVDecoderOptions{Sniff: true, Comma: '|', Header: []string{"a", "b"}})
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, srcs))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("expected a row, err: %v", it.Err())
+	}
+	if v, _ := it.Record().ByName("b"); v != "y" {
+		t.Fatalf("b = %q, want y", v)
+	}
+}
+
+func TestCSVDecoder_SingleQuotedOffsets(t *testing.T) {
+	ctx := context.Background()
+	srcs := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.csv", Data: []byte("'id'|'text'\n'1'|'it''s'\n'2'|'say \"hi\"'\n'3'|'end'\n")},
+	}
+	var dialect CSVDialect
+	dec := NewCSVDecoder(CSVDecoderOptions{Sniff: true, OnDialect: func(_ string, d CSVDialect) { dialect = d }})
+	it, err := dec.Decode(ctx, connector.NewMuxReader(ctx, srcs))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		text, _ := it.Record().ByName("text")
+		got = append(got, fmt.Sprintf("%s@%d", text, it.Record().Meta().ByteOffset))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if dialect.Quote != '\'' {
+		t.Fatalf("dialect = %+v, want single quotes", dialect)
+	}
+	// Offsets count source bytes, not the bytes of the translated stream.
+	want := `it's@12,say "hi"@24,end@39`
+	if strings.Join(got, ",") != want {
+		t.Fatalf("rows = %s\nwant   %s", strings.Join(got, ","), want)
+	}
+}
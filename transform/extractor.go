@@ -0,0 +1,27 @@
+package transform
+
+// nullableExtractor is a sliceExtractor whose fields may be null, as the
+// columns a CSV source lacks under a header policy, or Avro null values.
+// Null fields are reported as missing.
+type nullableExtractor struct {
+	sliceExtractor
+	present []bool
+}
+
+// ByIndex returns the field at i and true if i is within bounds and the
+// field is not null.
+func (n nullableExtractor) ByIndex(i int) (string, bool) {
+	if i < 0 || i >= len(n.present) || !n.present[i] {
+		return "", false
+	}
+	return n.current[i], true
+}
+
+// ByName returns the named field and true if it exists and is not null.
+func (n nullableExtractor) ByName(name string) (string, bool) {
+	idx, ok := n.indexOf(name)
+	if !ok {
+		return "", false
+	}
+	return n.ByIndex(idx)
+}
@@ -0,0 +1,190 @@
+package transform
+
+import (
+	"strings"
+	"unicode"
+)
+
+// HeaderNormalization selects the transformations applied to header names
+// so that spellings such as "Customer ID", "customer_id" and "CUSTOMERID"
+// compare equal.
+//
+// The steps run in this order:
+//
+//   - StripBOM removes a leading U+FEFF byte order mark from the first
+//     header cell, left there when a UTF-8 file with BOM is read as-is.
+//   - NormalizeUnicode folds common compatibility forms: Unicode spaces
+//     become ' ', zero-width characters are removed, full-width ASCII
+//     becomes ASCII, and Latin letters with diacritics lose them ("Año" →
+//     "Ano"). It is a lightweight stand-in for NFKC that only needs the
+//     standard library: it covers the Latin-1 Supplement and Latin
+//     Extended-A letters and drops combining marks, but leaves other
+//     scripts and compatibility characters (ligatures, superscripts, ...)
+//     unchanged.
+//   - TrimSpace removes leading and trailing white space.
+//   - SnakeCase splits words on non-alphanumeric runs and camel-case
+//     boundaries and joins them lower-cased with '_' ("CustomerID" →
+//     "customer_id").
+//   - CaseFold lower-cases the name.
+//   - Compact keeps only letters and digits, lower-cased, so that word
+//     separators do not matter: "Customer ID", "customer_id" and
+//     "CUSTOMERID" all become "customerid".
+type HeaderNormalization struct {
+	StripBOM         bool
+	NormalizeUnicode bool
+	TrimSpace        bool
+	SnakeCase        bool
+	CaseFold         bool
+	Compact          bool
+}
+
+// Normalize returns a normalized copy of a header.
+func (n HeaderNormalization) Normalize(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = n.Name(name)
+	}
+	return out
+}
+
+// Name normalizes a single name. A BOM can only occur in the first header
+// cell, so stripping it from any name is harmless and lets lookups use the
+// same function.
+func (n HeaderNormalization) Name(name string) string {
+	if n.StripBOM {
+		name = strings.TrimPrefix(name, "\ufeff")
+	}
+	if n.NormalizeUnicode {
+		name = foldUnicode(name)
+	}
+	if n.TrimSpace {
+		name = strings.TrimSpace(name)
+	}
+	if n.SnakeCase {
+		name = snakeCase(name)
+	}
+	if n.CaseFold {
+		name = strings.ToLower(name)
+	}
+	if n.Compact {
+		name = compact(name)
+	}
+	return name
+}
+
+// enabled reports whether any step is selected.
+func (n HeaderNormalization) enabled() bool {
+	return n != HeaderNormalization{}
+}
+
+// normalizeKeys returns m with keys and values normalized.
+func (n HeaderNormalization) normalizeKeys(m map[string]string) map[string]string {
+	if m == nil || !n.enabled() {
+		return m
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[n.Name(k)] = n.Name(v)
+	}
+	return out
+}
+
+// snakeCase converts s to lower-case words joined by '_'.
+func snakeCase(s string) string {
+	rs := []rune(s)
+	var b strings.Builder
+	pendingSep := false
+	for i, r := range rs {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			pendingSep = b.Len() > 0
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) {
+			prev := rs[i-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			// "customerID" → customer_id, "HTTPServer" → http_server.
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				pendingSep = b.Len() > 0
+			}
+		}
+		if pendingSep {
+			b.WriteByte('_')
+			pendingSep = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// compact returns the letters and digits of s, lower-cased.
+func compact(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// foldUnicode applies the compatibility folding described for
+// HeaderNormalization.NormalizeUnicode.
+func foldUnicode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\u200b' || r == '\u200c' || r == '\u200d' || r == '\u2060' || r == '\ufeff':
+			continue
+		case unicode.IsSpace(r):
+			b.WriteByte(' ')
+		case r >= '\uff01' && r <= '\uff5e':
+			b.WriteRune(r - 0xfee0)
+		default:
+			if base, ok := latinBase[r]; ok {
+				b.WriteString(base)
+				continue
+			}
+			if unicode.Is(unicode.Mn, r) {
+				// Stray combining marks (decomposed input) are dropped.
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// latinBase maps precomposed Latin letters to their base letters.
+var latinBase = buildLatinBase()
+
+func buildLatinBase() map[rune]string {
+	groups := map[string]string{
+		"A": "ÀÁÂÃÄÅĀĂĄ", "a": "àáâãäåāăą",
+		"C": "ÇĆĈĊČ", "c": "çćĉċč",
+		"D": "ĎĐ", "d": "ďđ",
+		"E": "ÈÉÊËĒĔĖĘĚ", "e": "èéêëēĕėęě",
+		"G": "ĜĞĠĢ", "g": "ĝğġģ",
+		"H": "ĤĦ", "h": "ĥħ",
+		"I": "ÌÍÎÏĨĪĬĮİ", "i": "ìíîïĩīĭįı",
+		"J": "Ĵ", "j": "ĵ",
+		"K": "Ķ", "k": "ķ",
+		"L": "ĹĻĽĿŁ", "l": "ĺļľŀł",
+		"N": "ÑŃŅŇ", "n": "ñńņň",
+		"O": "ÒÓÔÕÖØŌŎŐ", "o": "òóôõöøōŏő",
+		"R": "ŔŖŘ", "r": "ŕŗř",
+		"S": "ŚŜŞŠ", "s": "śŝşš",
+		"T": "ŢŤŦ", "t": "ţťŧ",
+		"U": "ÙÚÛÜŨŪŬŮŰŲ", "u": "ùúûüũūŭůűų",
+		"W": "Ŵ", "w": "ŵ",
+		"Y": "ÝŶŸ", "y": "ýÿŷ",
+		"Z": "ŹŻŽ", "z": "źżž",
+		"AE": "Æ", "ae": "æ", "OE": "Œ", "oe": "œ", "ss": "ß",
+	}
+	m := map[rune]string{}
+	for base, letters := range groups {
+		for _, r := range letters {
+			m[r] = base
+		}
+	}
+	return m
+}
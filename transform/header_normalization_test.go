@@ -0,0 +1,49 @@
+package transform
+
+import "testing"
+
+func TestHeaderNormalization_Name(t *testing.T) {
+	all := HeaderNormalization{StripBOM: true, NormalizeUnicode: true, TrimSpace: true, SnakeCase: true, CaseFold: true}
+	cases := []struct {
+		name string
+		norm HeaderNormalization
+		in   string
+		want string
+	}{
+		{name: "none", in: " Customer ID ", want: " Customer ID "},
+		{name: "bom", norm: HeaderNormalization{StripBOM: true}, in: "\ufeffid", want: "id"},
+		{name: "trim", norm: HeaderNormalization{TrimSpace: true}, in: "\t id \r", want: "id"},
+		{name: "case fold", norm: HeaderNormalization{CaseFold: true}, in: "CUSTOMERID", want: "customerid"},
+		{name: "snake spaces", norm: HeaderNormalization{SnakeCase: true}, in: "Customer ID", want: "customer_id"},
+		{name: "snake camel", norm: HeaderNormalization{SnakeCase: true}, in: "customerID", want: "customer_id"},
+		{name: "snake acronym", norm: HeaderNormalization{SnakeCase: true}, in: "HTTPServer2Port", want: "http_server2_port"},
+		{name: "snake punctuation", norm: HeaderNormalization{SnakeCase: true}, in: "--unit price (EUR)--", want: "unit_price_eur"},
+		{name: "snake idempotent", norm: HeaderNormalization{SnakeCase: true}, in: "customer_id", want: "customer_id"},
+		{name: "unicode spaces", norm: HeaderNormalization{NormalizeUnicode: true}, in: "a\u00a0b\u200bc", want: "a bc"},
+		{name: "unicode full width", norm: HeaderNormalization{NormalizeUnicode: true}, in: "ＩＤ", want: "ID"},
+		{name: "unicode diacritics", norm: HeaderNormalization{NormalizeUnicode: true}, in: "Año Straße", want: "Ano Strasse"},
+		{name: "unicode combining", norm: HeaderNormalization{NormalizeUnicode: true}, in: "Cafe\u0301", want: "Cafe"},
+		{name: "compact spaces", norm: HeaderNormalization{Compact: true}, in: "Customer ID", want: "customerid"},
+		{name: "compact underscore", norm: HeaderNormalization{Compact: true}, in: "customer_id", want: "customerid"},
+		{name: "compact upper", norm: HeaderNormalization{Compact: true}, in: "CUSTOMERID", want: "customerid"},
+		{name: "compact punctuation", norm: HeaderNormalization{Compact: true}, in: " Unit-Price (EUR)2 ", want: "unitpriceeur2"},
+		{name: "all", norm: all, in: "\ufeff Número Cliente ", want: "numero_cliente"},
+	}
+	for _, tc := range cases {
+		if got := tc.norm.Name(tc.in); got != tc.want {
+			t.Fatalf("%s: Name(%q) = %q, want %q", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestHeaderNormalization_Normalize(t *testing.T) {
+	n := HeaderNormalization{StripBOM: true, CaseFold: true}
+	in := []string{"\ufeffID", "Name"}
+	got := n.Normalize(in)
+	if !equalSilce(got, []string{"id", "name"}) {
+		t.Fatalf("Normalize = %q", got)
+	}
+	if in[0] != "\ufeffID" {
+		t.Fatalf("Normalize modified its input: %q", in)
+	}
+}
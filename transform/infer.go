@@ -0,0 +1,470 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"go/format"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//
+// Public API
+//
+
+// ColumnType is the narrowest type that every non-null value of a column
+// parses as.
+type ColumnType int
+
+const (
+	// ColumnEmpty is a column without any non-null value.
+	ColumnEmpty ColumnType = iota
+	// ColumnInt is a base-10 integer that fits in an int64.
+	ColumnInt
+	// ColumnFloat is a finite float64.
+	ColumnFloat
+	// ColumnBool is a boolean word accepted by strconv.ParseBool, such as
+	// "true" or "F"; 0 and 1 are integers.
+	ColumnBool
+	// ColumnTime is a time in the layout of ColumnProfile.Layout.
+	ColumnTime
+	// ColumnString is any other text.
+	ColumnString
+)
+
+// String returns the name of t.
+func (t ColumnType) String() string {
+	switch t {
+	case ColumnEmpty:
+		return "empty"
+	case ColumnInt:
+		return "int"
+	case ColumnFloat:
+		return "float"
+	case ColumnBool:
+		return "bool"
+	case ColumnTime:
+		return "time"
+	case ColumnString:
+		return "string"
+	}
+	return fmt.Sprintf("ColumnType(%d)", int(t))
+}
+
+// DefaultTimeLayouts are the layouts InferSchema tries, in order of
+// preference: when several layouts parse every value of a column, such as
+// "02/01/2006" and "01/02/2006" for dates whose days are all up to 12, the
+// first one wins.
+var DefaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.DateTime,
+	"2006-01-02T15:04:05",
+	time.DateOnly,
+	"02/01/2006",
+	"01/02/2006",
+	"2006/01/02",
+	"02/01/2006 15:04:05",
+	"01/02/2006 15:04:05",
+	time.TimeOnly,
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// InferOptions configures InferSchema.
+//
+// MaxRecords, if positive, stops the pass after that many records, to
+// profile a prefix of a large feed. Samples is the number of distinct
+// sample values kept per column, 5 by default; a negative value keeps
+// none. TimeLayouts replaces DefaultTimeLayouts.
+type InferOptions struct {
+	MaxRecords  int64
+	Samples     int
+	TimeLayouts []string
+}
+
+// Schema is the inferred shape of a stream of records.
+type Schema struct {
+	// Records is the number of records read.
+	Records int64
+	// Columns lists the columns in order of first appearance.
+	Columns []ColumnProfile
+}
+
+// ColumnProfile describes one column of a Schema.
+//
+// A value is null when the record lacks the column or the value is empty
+// or blank. Values are typed after trimming surrounding spaces.
+//
+// Min and Max are the extreme values in the order of Type: numeric for
+// numbers, chronological for times (as written in the data), false before
+// true, and byte-wise for strings. Both are empty for ColumnEmpty.
+//
+// Distinct is the number of distinct non-null values, exact up to 1024
+// and a HyperLogLog estimate, within a few percent, beyond. Samples holds
+// the first distinct non-null values, as written.
+type ColumnProfile struct {
+	Name     string
+	Type     ColumnType
+	Layout   string
+	Nullable bool
+	Nulls    int64
+	Distinct uint64
+	Min, Max string
+	Samples  []string
+}
+
+// InferSchema reads the records of it and profiles their columns. It owns
+// it and closes it before returning.
+//
+// Columns are identified by the record's Names, or named "col0", "col1",
+// ... for records without names, as the CSV decoder does for headerless
+// input. A column missing from some records, as with HeaderUnion, is null
+// in those records.
+func InferSchema(ctx context.Context, it RecordIterator, opt InferOptions) (s *Schema, err error) {
+	defer func() {
+		if cerr := it.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if opt.Samples == 0 {
+		opt.Samples = 5
+	}
+	if opt.TimeLayouts == nil {
+		opt.TimeLayouts = DefaultTimeLayouts
+	}
+	var (
+		cols  []*columnStats
+		index = map[string]*columnStats{}
+		n     int64
+	)
+	for (opt.MaxRecords <= 0 || n < opt.MaxRecords) && it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n++
+		rec := it.Record()
+		names := rec.Names()
+		for i := range rec.Len() {
+			var name string
+			if i < len(names) {
+				name = names[i]
+			} else {
+				name = "col" + strconv.Itoa(i)
+			}
+			c := index[name]
+			if c == nil {
+				c = newColumnStats(name, opt)
+				index[name] = c
+				cols = append(cols, c)
+			}
+			if v, ok := rec.ByIndex(i); ok {
+				c.add(v)
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	s = &Schema{Records: n, Columns: make([]ColumnProfile, len(cols))}
+	for i, c := range cols {
+		s.Columns[i] = c.profile(n)
+	}
+	return s, nil
+}
+
+// GoStruct returns the gofmt-formatted declaration of a struct type named
+// name with one field per column, for use with NewStructMapper:
+//
+//	type Order struct {
+//		ID     int64      `cetl:"id"`
+//		Amount *float64   `cetl:"amount"`
+//		PaidAt time.Time  `cetl:"paid_at" layout:"02/01/2006"`
+//		Note   string     `cetl:"note"`
+//	}
+//
+// Field names are the column names in Go style. Columns of type
+// ColumnEmpty and ColumnString are strings; other nullable columns are
+// pointers, nil for null values. The declaration imports "time" when a
+// column is ColumnTime; the import itself is not included.
+func (s *Schema) GoStruct(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s was inferred from %d records.\ntype %s struct {\n", name, s.Records, name)
+	used := map[string]int{}
+	for _, c := range s.Columns {
+		field := goFieldName(c.Name)
+		if used[field]++; used[field] > 1 {
+			field += "_" + strconv.Itoa(used[field])
+		}
+		typ := "string"
+		switch c.Type {
+		case ColumnInt:
+			typ = "int64"
+		case ColumnFloat:
+			typ = "float64"
+		case ColumnBool:
+			typ = "bool"
+		case ColumnTime:
+			typ = "time.Time"
+		}
+		if c.Nullable && typ != "string" {
+			typ = "*" + typ
+		}
+		tag := "cetl:" + strconv.Quote(c.Name)
+		if c.Type == ColumnTime {
+			tag += " layout:" + strconv.Quote(c.Layout)
+		}
+		if strings.Contains(tag, "`") {
+			tag = strconv.Quote(tag)
+		} else {
+			tag = "`" + tag + "`"
+		}
+		fmt.Fprintf(&b, "\t%s %s %s\n", field, typ, tag)
+	}
+	b.WriteString("}\n")
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		// The declaration is built from valid parts; keep it unformatted
+		// rather than fail.
+		return b.String()
+	}
+	return string(src)
+}
+
+//
+// Unexported helpers
+//
+
+// columnStats accumulates the profile of a column.
+type columnStats struct {
+	name     string
+	samples  int
+	values   int64 // non-null values
+	distinct distinctCounter
+	sample   []string
+	seen     map[string]bool // of sample
+
+	ints    extremes[int64]
+	floats  extremes[float64]
+	bools   extremes[int] // 0 for false, 1 for true
+	strs    extremes[string]
+	times   []timeCandidate
+	notInt  bool
+	notNum  bool
+	notBool bool
+}
+
+// timeCandidate is a layout that parsed every value so far.
+type timeCandidate struct {
+	layout string
+	ext    extremes[int64] // UnixNano, with the text as written
+}
+
+// extremes tracks the minimum and maximum of a series and their text.
+type extremes[T int | int64 | float64 | string] struct {
+	set              bool
+	min, max         T
+	minText, maxText string
+}
+
+func (e *extremes[T]) add(v T, text string) {
+	if !e.set || v < e.min {
+		e.min, e.minText = v, text
+	}
+	if !e.set || v > e.max {
+		e.max, e.maxText = v, text
+	}
+	e.set = true
+}
+
+func newColumnStats(name string, opt InferOptions) *columnStats {
+	c := &columnStats{name: name, samples: opt.Samples, seen: map[string]bool{}}
+	for _, l := range opt.TimeLayouts {
+		c.times = append(c.times, timeCandidate{layout: l})
+	}
+	return c
+}
+
+func (c *columnStats) add(v string) {
+	s := strings.TrimSpace(v)
+	if s == "" {
+		return
+	}
+	c.values++
+	c.distinct.add(v)
+	if len(c.sample) < c.samples && !c.seen[v] {
+		c.seen[v] = true
+		c.sample = append(c.sample, v)
+	}
+	c.strs.add(v, v)
+
+	if !c.notInt {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			c.ints.add(n, s)
+		} else {
+			c.notInt = true
+		}
+	}
+	if !c.notNum {
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			c.floats.add(f, s)
+		} else {
+			c.notNum, c.notInt = true, true
+		}
+	}
+	if !c.notBool {
+		if b, err := strconv.ParseBool(s); err == nil && s != "0" && s != "1" {
+			n := 0
+			if b {
+				n = 1
+			}
+			c.bools.add(n, strconv.FormatBool(b))
+		} else {
+			c.notBool = true
+		}
+	}
+	if len(c.times) > 0 {
+		kept := c.times[:0]
+		for _, tc := range c.times {
+			if t, err := time.Parse(tc.layout, s); err == nil {
+				tc.ext.add(t.UnixNano(), s)
+				kept = append(kept, tc)
+			}
+		}
+		c.times = kept
+	}
+}
+
+func (c *columnStats) profile(records int64) ColumnProfile {
+	p := ColumnProfile{
+		Name:     c.name,
+		Nulls:    records - c.values,
+		Distinct: c.distinct.estimate(),
+		Samples:  c.sample,
+	}
+	p.Nullable = p.Nulls > 0
+	var ext struct{ min, max string }
+	switch {
+	case c.values == 0:
+		p.Type = ColumnEmpty
+	case !c.notInt:
+		p.Type = ColumnInt
+		ext.min, ext.max = strconv.FormatInt(c.ints.min, 10), strconv.FormatInt(c.ints.max, 10)
+	case !c.notNum:
+		p.Type = ColumnFloat
+		ext.min, ext.max = c.floats.minText, c.floats.maxText
+	case !c.notBool:
+		p.Type = ColumnBool
+		ext.min, ext.max = c.bools.minText, c.bools.maxText
+	case len(c.times) > 0:
+		p.Type, p.Layout = ColumnTime, c.times[0].layout
+		ext.min, ext.max = c.times[0].ext.minText, c.times[0].ext.maxText
+	default:
+		p.Type = ColumnString
+		ext.min, ext.max = c.strs.minText, c.strs.maxText
+	}
+	p.Min, p.Max = ext.min, ext.max
+	return p
+}
+
+// exactDistinct is the number of distinct values a distinctCounter counts
+// exactly before it switches to a HyperLogLog sketch.
+const exactDistinct = 1024
+
+// hllPrecision is the number of index bits of the sketch: 4096 registers
+// of one byte, for a standard error of 1.04/sqrt(4096), about 1.6%.
+const hllPrecision = 12
+
+var hllSeed = maphash.MakeSeed()
+
+// distinctCounter counts the distinct strings added to it, exactly up to
+// exactDistinct and approximately beyond.
+type distinctCounter struct {
+	exact map[string]struct{}
+	reg   *[1 << hllPrecision]uint8
+}
+
+func (h *distinctCounter) add(s string) {
+	if h.reg == nil {
+		if h.exact == nil {
+			h.exact = map[string]struct{}{}
+		}
+		if h.exact[s] = struct{}{}; len(h.exact) <= exactDistinct {
+			return
+		}
+		h.reg = new([1 << hllPrecision]uint8)
+		for v := range h.exact {
+			h.addHash(v)
+		}
+		h.exact = nil
+	}
+	h.addHash(s)
+}
+
+func (h *distinctCounter) addHash(s string) {
+	x := maphash.String(hllSeed, s)
+	idx := x >> (64 - hllPrecision)
+	// The rank of the first 1 bit after the index bits; the sentinel bit
+	// bounds it when the remaining bits are all zero.
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.reg[idx] {
+		h.reg[idx] = rank
+	}
+}
+
+func (h *distinctCounter) estimate() uint64 {
+	if h.reg == nil {
+		return uint64(len(h.exact))
+	}
+	const m = float64(1 << hllPrecision)
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, r := range h.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
+
+// goInitialisms are the words GoStruct writes in upper case.
+var goInitialisms = map[string]bool{
+	"ID": true, "URL": true, "URI": true, "UUID": true, "HTTP": true, "API": true,
+	"JSON": true, "XML": true, "SQL": true, "IP": true, "CSV": true, "SKU": true,
+}
+
+// goFieldName turns a column name such as "customer_id" or "Paid at" into
+// an exported Go identifier such as CustomerID or PaidAt.
+func goFieldName(column string) string {
+	words := strings.FieldsFunc(column, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, w := range words {
+		if up := strings.ToUpper(w); goInitialisms[up] {
+			b.WriteString(up)
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	name := b.String()
+	if name == "" || !unicode.IsUpper([]rune(name)[0]) {
+		// Empty, or starting with a digit or an uncased letter.
+		name = "F" + name
+	}
+	return name
+}
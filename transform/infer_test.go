@@ -0,0 +1,167 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInferSchema(t *testing.T) {
+	names := []string{"id", "amount", "paid", "paid_at", "note", "gone", "at"}
+	rows := [][]string{
+		{"3", "10.50", "true", "13/10/2024", "b", "", "2024-10-01T08:00:00Z"},
+		{"-1", "7", "F", "01/10/2024", "a", " ", "2024-10-01T09:30:00+02:00"},
+		{" 12 ", "", "TRUE", "02/10/2024", "a", "", "2024-09-30T23:00:00Z"},
+	}
+	recs := make([]Extractor, len(rows))
+	for i, r := range rows {
+		recs[i] = stubExtractor{vals: r, names: names}
+	}
+	// A record of a later source lacking columns, as with HeaderUnion.
+	recs = append(recs, stubExtractor{vals: []string{"4", "1e3"}, names: []string{"id", "amount"}})
+	it := &stubRecordIterator{recs: recs}
+	s, err := InferSchema(context.Background(), it, InferOptions{Samples: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.closed {
+		t.Fatal("iterator not closed")
+	}
+	want := []ColumnProfile{
+		{Name: "id", Type: ColumnInt, Distinct: 4, Min: "-1", Max: "12", Samples: []string{"3", "-1"}},
+		{Name: "amount", Type: ColumnFloat, Nullable: true, Nulls: 1, Distinct: 3, Min: "7", Max: "1e3", Samples: []string{"10.50", "7"}},
+		{Name: "paid", Type: ColumnBool, Nullable: true, Nulls: 1, Distinct: 3, Min: "false", Max: "true", Samples: []string{"true", "F"}},
+		{Name: "paid_at", Type: ColumnTime, Layout: "02/01/2006", Nullable: true, Nulls: 1, Distinct: 3, Min: "01/10/2024", Max: "13/10/2024", Samples: []string{"13/10/2024", "01/10/2024"}},
+		{Name: "note", Type: ColumnString, Nullable: true, Nulls: 1, Distinct: 2, Min: "a", Max: "b", Samples: []string{"b", "a"}},
+		{Name: "gone", Type: ColumnEmpty, Nullable: true, Nulls: 4},
+		{Name: "at", Type: ColumnTime, Layout: time.RFC3339Nano, Nullable: true, Nulls: 1, Distinct: 3, Min: "2024-09-30T23:00:00Z", Max: "2024-10-01T08:00:00Z", Samples: []string{"2024-10-01T08:00:00Z", "2024-10-01T09:30:00+02:00"}},
+	}
+	if s.Records != 4 || len(s.Columns) != len(want) {
+		t.Fatalf("got %d records, %d columns", s.Records, len(s.Columns))
+	}
+	for i, w := range want {
+		got := s.Columns[i]
+		if fmt.Sprint(got) != fmt.Sprint(w) {
+			t.Errorf("column %d:\ngot  %+v\nwant %+v", i, got, w)
+		}
+	}
+}
+
+func TestInferSchema_Options(t *testing.T) {
+	var recs []Extractor
+	for i := range 1000 {
+		recs = append(recs, stubExtractor{vals: []string{itoa(i), "x"}})
+	}
+	s, err := InferSchema(context.Background(), &stubRecordIterator{recs: recs}, InferOptions{MaxRecords: 10, Samples: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Records != 10 || len(s.Columns) != 2 || s.Columns[0].Name != "col0" || s.Columns[1].Name != "col1" {
+		t.Fatalf("got %+v", s)
+	}
+	if c := s.Columns[0]; c.Distinct != 10 || c.Samples != nil || c.Max != "9" {
+		t.Fatalf("col0 = %+v", c)
+	}
+
+	s, err = InferSchema(context.Background(), &stubRecordIterator{recs: recs}, InferOptions{TimeLayouts: []string{"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only 1 to 9 parse in layout "2": the column is an int.
+	if c := s.Columns[0]; c.Type != ColumnInt || c.Distinct != 1000 {
+		t.Fatalf("col0 = %+v", c)
+	}
+
+	readErr := errors.New("bad input")
+	if _, err := InferSchema(context.Background(), &stubRecordIterator{recs: recs[:1], err: readErr}, InferOptions{}); !errors.Is(err, readErr) {
+		t.Fatalf("InferSchema: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := InferSchema(ctx, &stubRecordIterator{recs: recs}, InferOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("InferSchema: %v", err)
+	}
+}
+
+func TestSchema_GoStruct(t *testing.T) {
+	s := &Schema{Records: 3, Columns: []ColumnProfile{
+		{Name: "customer_id", Type: ColumnInt},
+		{Name: "Amount EUR", Type: ColumnFloat, Nullable: true},
+		{Name: "paid", Type: ColumnBool},
+		{Name: "paid at", Type: ColumnTime, Layout: "02/01/2006", Nullable: true},
+		{Name: "note", Type: ColumnString, Nullable: true},
+		{Name: "2nd", Type: ColumnEmpty, Nullable: true},
+		{Name: "paid-", Type: ColumnString},
+	}}
+	want := "// Order was inferred from 3 records.\n" +
+		"type Order struct {\n" +
+		"\tCustomerID int64      `cetl:\"customer_id\"`\n" +
+		"\tAmountEUR  *float64   `cetl:\"Amount EUR\"`\n" +
+		"\tPaid       bool       `cetl:\"paid\"`\n" +
+		"\tPaidAt     *time.Time `cetl:\"paid at\" layout:\"02/01/2006\"`\n" +
+		"\tNote       string     `cetl:\"note\"`\n" +
+		"\tF2nd       string     `cetl:\"2nd\"`\n" +
+		"\tPaid_2     string     `cetl:\"paid-\"`\n" +
+		"}\n"
+	if got := s.GoStruct("Order"); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInferSchema_GoStructMapsRecords(t *testing.T) {
+	recs := []Extractor{
+		stubExtractor{vals: []string{"1", "2024-10-01", "9.5"}, names: []string{"id", "day", "price"}},
+		stubExtractor{vals: []string{"2", "", "3"}, names: []string{"id", "day", "price"}},
+	}
+	s, err := InferSchema(context.Background(), &stubRecordIterator{recs: recs}, InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl := s.GoStruct("Row")
+	for _, want := range []string{"ID    int64      `cetl:\"id\"`", "Day   *time.Time `cetl:\"day\" layout:\"2006-01-02\"`", "Price float64    `cetl:\"price\"`"} {
+		if !strings.Contains(decl, want) {
+			t.Fatalf("declaration lacks %q:\n%s", want, decl)
+		}
+	}
+	// The declaration above, as it would be pasted into a program.
+	type Row struct {
+		ID    int64      `cetl:"id"`
+		Day   *time.Time `cetl:"day" layout:"2006-01-02"`
+		Price float64    `cetl:"price"`
+	}
+	mapper := NewStructMapper[Row]()
+	var got []Row
+	for _, rec := range recs {
+		r, err := mapper(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if got[0].ID != 1 || got[0].Day == nil || !got[0].Day.Equal(time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)) || got[1].Day != nil || got[1].Price != 3 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestDistinctCounter(t *testing.T) {
+	for _, n := range []int{0, 1, 1024, 1025, 50000} {
+		var h distinctCounter
+		for i := range n {
+			h.add(itoa(i))
+			h.add(itoa(i))
+		}
+		got := float64(h.estimate())
+		if d := got - float64(n); d < -0.05*float64(n) || d > 0.05*float64(n) {
+			t.Errorf("estimate(%d) = %v", n, got)
+		}
+	}
+	if !slices.Equal([]string{goFieldName("order-id"), goFieldName("_x_y"), goFieldName("")}, []string{"OrderID", "XY", "F"}) {
+		t.Fatal("goFieldName")
+	}
+}
+
+func itoa(i int) string { return fmt.Sprint(i) }
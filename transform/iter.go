@@ -0,0 +1,142 @@
+package transform
+
+import (
+	"iter"
+)
+
+//
+// Adapters between iterators and range-over-func sequences
+//
+
+// Records returns a single-use sequence over the records of it, for use
+// with a range loop:
+//
+//	for rec, err := range transform.Records(it) {
+//	    if err != nil { ... }
+//	    // use rec until the next iteration
+//	}
+//
+// Each record is yielded with a nil error; the Extractor follows the
+// validity rules of RecordIterator.Record. If iteration fails, or closing
+// the iterator at the end fails, a final (nil, err) pair is yielded.
+//
+// The sequence closes it when the loop ends, including when it breaks
+// early or its body panics; a Close error is then dropped.
+func Records(it RecordIterator) iter.Seq2[Extractor, error] {
+	return func(yield func(Extractor, error) bool) {
+		drain(it, it.Record, yield)
+	}
+}
+
+// Structs returns a single-use sequence over the values of it. It behaves
+// like Records: the final pair carries the iterator's error, if any, and it
+// is closed when the loop ends.
+func Structs[T any](it StructIterator[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		drain(it, it.Struct, yield)
+	}
+}
+
+// FromSeq wraps seq as a StructIterator, so that values produced by any
+// range-over-func sequence can be fed to the stages of this module. Err
+// always returns nil.
+//
+// Close stops seq if it has not finished, letting its deferred cleanup
+// run; callers must call Close unless they consume seq to the end.
+func FromSeq[T any](seq iter.Seq[T]) StructIterator[T] {
+	next, stop := iter.Pull(seq)
+	return &seqIterator[T]{
+		next: func() (T, error, bool) {
+			v, ok := next()
+			return v, nil, ok
+		},
+		stop: stop,
+	}
+}
+
+// FromSeq2 is like FromSeq for sequences of (value, error) pairs, such as
+// those returned by Records and Structs. The first non-nil error ends the
+// iteration and is reported by Err.
+func FromSeq2[T any](seq iter.Seq2[T, error]) StructIterator[T] {
+	next, stop := iter.Pull2(seq)
+	return &seqIterator[T]{next: next, stop: stop}
+}
+
+//
+// Unexported helpers
+//
+
+// iterator is the part of RecordIterator and StructIterator that drain
+// needs.
+type iterator interface {
+	Next() bool
+	Err() error
+	Close() error
+}
+
+// drain yields the values of it until it is exhausted or yield returns
+// false, then closes it. It also closes it if yield panics.
+func drain[T any](it iterator, value func() T, yield func(T, error) bool) {
+	closed := false
+	defer func() {
+		if !closed {
+			_ = it.Close()
+		}
+	}()
+	for it.Next() {
+		if !yield(value(), nil) {
+			return
+		}
+	}
+	err := it.Err()
+	closed = true
+	if cerr := it.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		var zero T
+		yield(zero, err)
+	}
+}
+
+// seqIterator implements StructIterator[T] over a pulled sequence.
+type seqIterator[T any] struct {
+	next func() (T, error, bool)
+	stop func()
+
+	cur  T
+	err  error
+	done bool
+}
+
+func (s *seqIterator[T]) Next() bool {
+	if s.done {
+		return false
+	}
+	v, err, ok := s.next()
+	if !ok || err != nil {
+		s.err = err
+		s.Close()
+		return false
+	}
+	s.cur = v
+	return true
+}
+
+func (s *seqIterator[T]) Struct() T {
+	return s.cur
+}
+
+func (s *seqIterator[T]) Err() error {
+	return s.err
+}
+
+func (s *seqIterator[T]) Close() error {
+	if !s.done {
+		s.done = true
+		var zero T
+		s.cur = zero
+		s.stop()
+	}
+	return nil
+}
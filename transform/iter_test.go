@@ -0,0 +1,170 @@
+package transform
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+type stubStructIterator[T any] struct {
+	vals   []T
+	idx    int
+	err    error
+	closed bool
+}
+
+func (s *stubStructIterator[T]) Next() bool {
+	if s.idx >= len(s.vals) {
+		return false
+	}
+	s.idx++
+	return true
+}
+
+func (s *stubStructIterator[T]) Struct() T    { return s.vals[s.idx-1] }
+func (s *stubStructIterator[T]) Err() error   { return s.err }
+func (s *stubStructIterator[T]) Close() error { s.closed = true; return nil }
+
+func TestRecords(t *testing.T) {
+	inner := &stubRecordIterator{recs: []Extractor{
+		stubExtractor{vals: []string{"a"}},
+		stubExtractor{vals: []string{"b"}},
+	}}
+	var got []string
+	for rec, err := range Records(inner) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		v, _ := rec.ByIndex(0)
+		got = append(got, v)
+	}
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("records = %q", got)
+	}
+	if !inner.closed {
+		t.Fatalf("expected iterator to be closed")
+	}
+}
+
+func TestRecords_YieldsErrorLast(t *testing.T) {
+	wantErr := errors.New("boom")
+	inner := &stubRecordIterator{recs: []Extractor{stubExtractor{vals: []string{"a"}}}, err: wantErr}
+	var errs []error
+	n := 0
+	for rec, err := range Records(inner) {
+		if err != nil {
+			if rec != nil {
+				t.Fatalf("expected nil record with error")
+			}
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	if n != 1 || len(errs) != 1 || errs[0] != wantErr {
+		t.Fatalf("records = %d, errors = %v", n, errs)
+	}
+}
+
+func TestStructs_BreakCloses(t *testing.T) {
+	inner := &stubStructIterator[int]{vals: []int{1, 2, 3}}
+	var got []int
+	for v, err := range Structs[int](inner) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, v)
+		if v == 2 {
+			break
+		}
+	}
+	if !slices.Equal(got, []int{1, 2}) {
+		t.Fatalf("values = %v", got)
+	}
+	if !inner.closed {
+		t.Fatalf("expected iterator to be closed after break")
+	}
+}
+
+func TestStructs_PanicCloses(t *testing.T) {
+	inner := &stubStructIterator[int]{vals: []int{1, 2, 3}}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected the panic to propagate")
+			}
+		}()
+		for range Structs[int](inner) {
+			panic("boom")
+		}
+	}()
+	if !inner.closed {
+		t.Fatalf("expected iterator to be closed after a panic")
+	}
+}
+
+func TestFromSeq(t *testing.T) {
+	it := FromSeq(slices.Values([]string{"x", "y"}))
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		got = append(got, it.Struct())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if !slices.Equal(got, []string{"x", "y"}) {
+		t.Fatalf("values = %q", got)
+	}
+	if it.Next() {
+		t.Fatalf("Next after end = true")
+	}
+}
+
+func TestFromSeq_CloseStopsSequence(t *testing.T) {
+	cleaned := false
+	seq := func(yield func(int) bool) {
+		defer func() { cleaned = true }()
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	it := FromSeq(seq)
+	if !it.Next() || it.Struct() != 0 {
+		t.Fatalf("expected first value 0")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !cleaned {
+		t.Fatalf("expected sequence to be stopped by Close")
+	}
+	if it.Next() {
+		t.Fatalf("Next after Close = true")
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestFromSeq2_RoundTrip(t *testing.T) {
+	wantErr := errors.New("decode failed")
+	inner := &stubStructIterator[int]{vals: []int{1, 2}, err: wantErr}
+	it := FromSeq2(Structs[int](inner))
+	defer it.Close()
+	var got []int
+	for it.Next() {
+		got = append(got, it.Struct())
+	}
+	if !slices.Equal(got, []int{1, 2}) {
+		t.Fatalf("values = %v", got)
+	}
+	if err := it.Err(); err != wantErr {
+		t.Fatalf("Err = %v, want %v", err, wantErr)
+	}
+	if !inner.closed {
+		t.Fatalf("expected inner iterator to be closed")
+	}
+}
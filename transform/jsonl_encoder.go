@@ -0,0 +1,96 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+)
+
+//
+// Public API
+//
+
+// NewJSONLEncoder returns an Encoder writing records as JSON Lines.
+//
+// A record with Names is written as an object whose keys follow the order
+// of its Names; fields the record lacks, such as the null columns of a
+// unioned CSV header, are written as null. A record without names is
+// written as an array of its fields. Every value is a JSON string, encoded
+// by encoding/json without HTML escaping.
+func NewJSONLEncoder() Encoder {
+	return jsonlEncoder{}
+}
+
+//
+// Unexported helpers
+//
+
+type jsonlEncoder struct{}
+
+func (jsonlEncoder) Encode(ctx context.Context, w io.Writer, it RecordIterator) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	n, err := encodeRecords(ctx, it, func(rec Extractor) error {
+		buf.Reset()
+		if err := writeJSONRecord(&buf, enc, rec); err != nil {
+			return err
+		}
+		_, err := bw.Write(buf.Bytes())
+		return err
+	})
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	return n, err
+}
+
+// writeJSONRecord writes rec as one line of JSON to buf, encoding strings
+// with enc, which writes to buf too.
+func writeJSONRecord(buf *bytes.Buffer, enc *json.Encoder, rec Extractor) error {
+	str := func(s string) error {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+		// Encode terminates every value with a newline.
+		buf.Truncate(buf.Len() - 1)
+		return nil
+	}
+	names := rec.Names()
+	if len(names) == 0 {
+		buf.WriteByte('[')
+		for i := range rec.Len() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			v, _ := rec.ByIndex(i)
+			if err := str(v); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]\n")
+		return nil
+	}
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := str(name); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if v, ok := rec.ByName(name); ok {
+			if err := str(v); err != nil {
+				return err
+			}
+		} else {
+			buf.WriteString("null")
+		}
+	}
+	buf.WriteString("}\n")
+	return nil
+}
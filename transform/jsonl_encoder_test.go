@@ -0,0 +1,47 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// nullableStub is a stubExtractor whose empty values read as missing.
+type nullableStub struct{ stubExtractor }
+
+func (n nullableStub) ByName(name string) (string, bool) {
+	v, ok := n.stubExtractor.ByName(name)
+	return v, ok && v != ""
+}
+
+func TestJSONLEncoder(t *testing.T) {
+	recs := []Extractor{
+		stubExtractor{vals: []string{"1", "say \"hi\"\n<b>"}, names: []string{"id", "note"}},
+		nullableStub{stubExtractor{vals: []string{"2", ""}, names: []string{"id", "note"}}},
+		stubExtractor{vals: []string{"x", "\x01\u2028\xff"}},
+	}
+	var buf strings.Builder
+	it := &stubRecordIterator{recs: recs}
+	n, err := NewJSONLEncoder().Encode(context.Background(), &buf, it)
+	if err != nil || n != 3 || !it.closed {
+		t.Fatalf("Encode: %d, %v, closed %v", n, err, it.closed)
+	}
+	want := `{"id":"1","note":"say \"hi\"\n<b>"}` + "\n" +
+		`{"id":"2","note":null}` + "\n" +
+		`["x","\u0001\u2028` + "\ufffd" + `"]` + "\n"
+	if buf.String() != want {
+		t.Fatalf("got  %q\nwant %q", buf.String(), want)
+	}
+
+	// Every line is valid JSON that round-trips the values.
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	var first map[string]string
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first["note"] != "say \"hi\"\n<b>" {
+		t.Fatalf("line 1: %v, %q", err, first)
+	}
+	var last []string
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil || last[1] != "\x01\u2028\ufffd" {
+		t.Fatalf("line 3: %v, %q", err, last)
+	}
+}
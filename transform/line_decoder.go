@@ -0,0 +1,254 @@
+package transform
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/carlodf/cetl/connector"
+)
+
+//
+// Public API
+//
+
+// LineDecoderOptions configures how a line decoder splits input into
+// records.
+//
+// Field is the name of the single field of every record. If Field is empty,
+// "line" is used.
+//
+// Group controls multi-line grouping. With the zero value every line is a
+// record of its own.
+type LineDecoderOptions struct {
+	Field string
+	Group LineGroupOptions
+}
+
+// LineGroupOptions describes how consecutive lines are grouped into a
+// single record, e.g. to keep a Java stack trace together with the log line
+// that precedes it.
+//
+//   - Start, if set, matches the first line of a record. Any line that does
+//     not match Start is appended to the record being built.
+//   - Continuation, if set, matches lines that belong to the previous
+//     record. Any line that does not match Continuation starts a new record.
+//   - If both are set, a line matching Start always opens a new record, a
+//     line matching Continuation is appended, and any other line is a record
+//     of its own: the line after it always opens a new record.
+//   - MaxLines, if positive, caps the number of lines in a record; the line
+//     after the cap starts a new record.
+//
+// Grouping is batch-oriented and has no timeout: a record is emitted when
+// the next record starts or its source ends. A record never spans two
+// sources.
+type LineGroupOptions struct {
+	Start        *regexp.Regexp
+	Continuation *regexp.Regexp
+	MaxLines     int
+}
+
+// NewLineDecoder constructs a Decoder that turns each line, or each group
+// of lines as configured by opt.Group, into a single-field record.
+//
+// Line terminators ("\n" or "\r\n") are stripped; the lines of a group are
+// joined with "\n". Each record's Meta().ByteOffset is the offset of its
+// first byte within its source.
+func NewLineDecoder(opt LineDecoderOptions) Decoder {
+	field := opt.Field
+	if field == "" {
+		field = "line"
+	}
+	return &lineDecoder{field: field, group: opt.Group}
+}
+
+// Decode consumes a connector.SrcAwareStreamer and returns a RecordIterator
+// that yields one record per line or line group.
+//
+// The returned iterator is not safe for concurrent use. Call Close on the
+// RecordIterator when you are done to release the underlying stream.
+func (d *lineDecoder) Decode(ctx context.Context, rc connector.SrcAwareStreamer) (RecordIterator, error) {
+	header := []string{d.field}
+	it := &lineRecordIterator{
+		srcAwareStream: rc,
+		segments:       connector.NewSegmenter(rc),
+		grouper:        lineGrouper{opt: d.group},
+		header:         header,
+		invertedIndex:  buildIndex(header),
+	}
+	// Best-effort: close the underlying stream if the context is cancelled.
+	go func() {
+		<-ctx.Done()
+		_ = rc.Close()
+	}()
+	return it, nil
+}
+
+// Next advances to the next record.
+func (it *lineRecordIterator) Next() bool {
+	if it.decoderError != nil || it.done {
+		return false
+	}
+	for {
+		if it.reader == nil {
+			if !it.segments.Next() {
+				it.decoderError = it.segments.Err()
+				it.done = true
+				return false
+			}
+			it.reader = bufio.NewReader(it.segments)
+			it.source = it.segments.Meta().Name
+			it.offset = 0
+		}
+		line, err := it.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			it.decoderError = err
+			return false
+		}
+		if line != "" {
+			start := it.offset
+			it.offset += int64(len(line))
+			if text, off, ok := it.grouper.push(trimEOL(line), start); ok {
+				it.setCurrent(text, off)
+				return true
+			}
+		}
+		if err == io.EOF {
+			it.reader = nil
+			if text, off, ok := it.grouper.flush(); ok {
+				it.setCurrent(text, off)
+				return true
+			}
+		}
+	}
+}
+
+// Record returns an Extractor for the current record.
+//
+// The returned Extractor is only valid until the next call to Next.
+func (it *lineRecordIterator) Record() Extractor {
+	return sliceExtractor{current: it.current, header: it.header, invIndex: it.invertedIndex, srcMeta: it.currentSrcMeta}
+}
+
+// Err reports the first non-EOF error encountered while decoding.
+func (it *lineRecordIterator) Err() error {
+	return it.decoderError
+}
+
+// Close closes the underlying SrcAwareStreamer. It is safe to call Close
+// multiple times.
+func (it *lineRecordIterator) Close() error {
+	return it.srcAwareStream.Close()
+}
+
+//
+// Unexported helpers
+//
+
+type lineDecoder struct {
+	// field is the name of the single record field.
+	field string
+	// group configures multi-line grouping.
+	group LineGroupOptions
+}
+
+type lineRecordIterator struct {
+	// srcAwareStream is the stream being decoded.
+	srcAwareStream connector.SrcAwareStreamer
+	// segments splits srcAwareStream per source.
+	segments *connector.Segmenter
+	// reader reads lines of the active segment; nil between segments.
+	reader *bufio.Reader
+	// source is the name of the active segment.
+	source string
+	// offset is the source offset of the next unread line.
+	offset int64
+
+	// grouper accumulates lines into records.
+	grouper lineGrouper
+
+	// header holds the single field name.
+	header []string
+	// invertedIndex maps header name → field index.
+	invertedIndex map[string]int
+
+	// current holds the latest record returned by Next.
+	current []string
+	// currentSrcMeta is the SrcMeta associated with current.
+	currentSrcMeta connector.SrcMeta
+
+	// decoderError is a sticky error; once set, Next returns false.
+	decoderError error
+	// done is set once the stream is exhausted.
+	done bool
+}
+
+func (it *lineRecordIterator) setCurrent(text string, off int64) {
+	it.current = []string{text}
+	it.currentSrcMeta = connector.SrcMeta{Name: it.source, ByteOffset: off}
+}
+
+// lineGrouper accumulates lines into multi-line records according to
+// LineGroupOptions.
+type lineGrouper struct {
+	opt LineGroupOptions
+	// lines holds the lines of the record being built.
+	lines []string
+	// start is the source offset of the first line in lines.
+	start int64
+	// single reports whether the record being built is a line matching
+	// neither Start nor Continuation, which takes no further lines.
+	single bool
+}
+
+// push adds a line starting at offset off. If the line opens a new record
+// while another one is being built, the completed record is returned.
+func (g *lineGrouper) push(line string, off int64) (string, int64, bool) {
+	if len(g.lines) > 0 && !g.startsRecord(line) {
+		g.lines = append(g.lines, line)
+		return "", 0, false
+	}
+	text, start, ok := g.flush()
+	g.lines = append(g.lines, line)
+	g.start = off
+	g.single = g.opt.Start != nil && g.opt.Continuation != nil &&
+		!g.opt.Start.MatchString(line) && !g.opt.Continuation.MatchString(line)
+	return text, start, ok
+}
+
+// flush returns the record being built, if any, and resets the grouper.
+func (g *lineGrouper) flush() (string, int64, bool) {
+	if len(g.lines) == 0 {
+		return "", 0, false
+	}
+	text := strings.Join(g.lines, "\n")
+	g.lines = g.lines[:0]
+	return text, g.start, true
+}
+
+// startsRecord reports whether line must open a new record, given that a
+// record is currently being built.
+func (g *lineGrouper) startsRecord(line string) bool {
+	if g.single || g.opt.MaxLines > 0 && len(g.lines) >= g.opt.MaxLines {
+		return true
+	}
+	start, cont := g.opt.Start, g.opt.Continuation
+	switch {
+	case start == nil && cont == nil:
+		return true
+	case start != nil && start.MatchString(line):
+		return true
+	case cont != nil:
+		return !cont.MatchString(line)
+	default:
+		return false
+	}
+}
+
+// trimEOL strips a trailing "\n" or "\r\n".
+func trimEOL(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/opener"
+)
+
+type lineRecord struct {
+	text   string
+	source string
+	offset int64
+}
+
+func decodeLines(t *testing.T, opt LineDecoderOptions, srcs ...opener.Opener) []lineRecord {
+	t.Helper()
+	ctx := context.Background()
+	it, err := NewLineDecoder(opt).Decode(ctx, connector.NewMuxReader(ctx, srcs))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	defer it.Close()
+	var got []lineRecord
+	for it.Next() {
+		rec := it.Record()
+		text, _ := rec.ByIndex(0)
+		got = append(got, lineRecord{text: text, source: rec.Meta().Name, offset: rec.Meta().ByteOffset})
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	return got
+}
+
+func assertLineRecords(t *testing.T, got, want []lineRecord) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d records %q, want %d %q", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLineDecoder_OneRecordPerLine(t *testing.T) {
+	got := decodeLines(t, LineDecoderOptions{},
+		opener.InMemorySource{SourceName: "a", Data: []byte("one\r\ntwo")},
+		opener.InMemorySource{SourceName: "b", Data: []byte("three\n")},
+	)
+	assertLineRecords(t, got, []lineRecord{
+		{"one", "a", 0},
+		{"two", "a", 5},
+		{"three", "b", 0},
+	})
+}
+
+func TestLineDecoder_FieldName(t *testing.T) {
+	ctx := context.Background()
+	srcs := []opener.Opener{opener.InMemorySource{SourceName: "a", Data: []byte("x\n")}}
+	it, _ := NewLineDecoder(LineDecoderOptions{Field: "msg"}).Decode(ctx, connector.NewMuxReader(ctx, srcs))
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("expected a record")
+	}
+	if v, ok := it.Record().ByName("msg"); !ok || v != "x" {
+		t.Fatalf("ByName(msg) = %q, %v", v, ok)
+	}
+}
+
+func TestLineDecoder_GroupsStackTraceByStart(t *testing.T) {
+	log := "2024-10-01 ERROR boom\n" +
+		"java.lang.IllegalStateException: x\n" +
+		"\tat a.b.C.d(C.java:1)\n" +
+		"2024-10-01 INFO ok\n"
+	got := decodeLines(t,
+		LineDecoderOptions{Group: LineGroupOptions{Start: regexp.MustCompile(`^\d{4}-\d{2}-\d{2} `)}},
+		opener.InMemorySource{SourceName: "app.log", Data: []byte(log)},
+	)
+	assertLineRecords(t, got, []lineRecord{
+		{"2024-10-01 ERROR boom\njava.lang.IllegalStateException: x\n\tat a.b.C.d(C.java:1)", "app.log", 0},
+		{"2024-10-01 INFO ok", "app.log", 79},
+	})
+}
+
+func TestLineDecoder_GroupsByContinuation(t *testing.T) {
+	got := decodeLines(t,
+		LineDecoderOptions{Group: LineGroupOptions{Continuation: regexp.MustCompile(`^\s`)}},
+		opener.InMemorySource{SourceName: "a", Data: []byte("first\n  more\nsecond\n")},
+	)
+	assertLineRecords(t, got, []lineRecord{
+		{"first\n  more", "a", 0},
+		{"second", "a", 13},
+	})
+}
+
+func TestLineDecoder_GroupsByStartAndContinuation(t *testing.T) {
+	log := "ERROR boom\n" +
+		"\tat a\n" +
+		"-- marker --\n" +
+		"\tat b\n" +
+		"\tat c\n" +
+		"INFO ok\n"
+	got := decodeLines(t,
+		LineDecoderOptions{Group: LineGroupOptions{
+			Start:        regexp.MustCompile(`^[A-Z]+ `),
+			Continuation: regexp.MustCompile(`^\s`),
+		}},
+		opener.InMemorySource{SourceName: "a", Data: []byte(log)},
+	)
+	// The marker matches neither pattern: it is a record of its own, and
+	// the continuation lines after it open a new record.
+	assertLineRecords(t, got, []lineRecord{
+		{"ERROR boom\n\tat a", "a", 0},
+		{"-- marker --", "a", 17},
+		{"\tat b\n\tat c", "a", 30},
+		{"INFO ok", "a", 42},
+	})
+}
+
+func TestLineDecoder_NeverSpansSources(t *testing.T) {
+	got := decodeLines(t,
+		LineDecoderOptions{Group: LineGroupOptions{Continuation: regexp.MustCompile(`^\s`)}},
+		opener.InMemorySource{SourceName: "a", Data: []byte("first\n  more")},
+		opener.InMemorySource{SourceName: "b", Data: []byte("  orphan\nnext\n")},
+	)
+	assertLineRecords(t, got, []lineRecord{
+		{"first\n  more", "a", 0},
+		{"  orphan", "b", 0},
+		{"next", "b", 9},
+	})
+}
+
+func TestLineDecoder_MaxLines(t *testing.T) {
+	got := decodeLines(t,
+		LineDecoderOptions{Group: LineGroupOptions{Continuation: regexp.MustCompile(`^\s`), MaxLines: 2}},
+		opener.InMemorySource{SourceName: "a", Data: []byte("x\n 1\n 2\n 3\n")},
+	)
+	assertLineRecords(t, got, []lineRecord{
+		{"x\n 1", "a", 0},
+		{" 2\n 3", "a", 5},
+	})
+}
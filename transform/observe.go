@@ -0,0 +1,72 @@
+package transform
+
+import (
+	"context"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/metrics"
+)
+
+//
+// Public API
+//
+
+// ObserveDecoder returns a Decoder reporting each record dec decodes to
+// hooks, with the name of its source. With nil hooks, ObserveDecoder
+// returns dec itself.
+func ObserveDecoder(dec Decoder, hooks *metrics.Hooks) Decoder {
+	if hooks == nil {
+		return dec
+	}
+	return &observedDecoder{dec: dec, hooks: hooks}
+}
+
+// ObserveMapper returns a Mapper reporting each error of fn to hooks, with
+// the location of the record, before returning it. With nil hooks,
+// ObserveMapper returns fn itself. Like the hooks, the returned Mapper is
+// safe for concurrent use if fn is, as NewParallelDecodeMapTransform
+// requires.
+func ObserveMapper[T any](fn Mapper[T], hooks *metrics.Hooks) Mapper[T] {
+	if hooks == nil {
+		return fn
+	}
+	return func(rec Extractor) (T, error) {
+		v, err := fn(rec)
+		if err != nil {
+			m := rec.Meta()
+			hooks.MapperError(m.Name, m.ByteOffset, err)
+		}
+		return v, err
+	}
+}
+
+//
+// Unexported helpers
+//
+
+type observedDecoder struct {
+	dec   Decoder
+	hooks *metrics.Hooks
+}
+
+func (d *observedDecoder) Decode(ctx context.Context, rc connector.SrcAwareStreamer) (RecordIterator, error) {
+	it, err := d.dec.Decode(ctx, rc)
+	if err != nil {
+		return nil, err
+	}
+	return &observedRecords{RecordIterator: it, hooks: d.hooks}, nil
+}
+
+// observedRecords reports the records of the RecordIterator it embeds.
+type observedRecords struct {
+	RecordIterator
+	hooks *metrics.Hooks
+}
+
+func (o *observedRecords) Next() bool {
+	if !o.RecordIterator.Next() {
+		return false
+	}
+	o.hooks.Record(o.Record().Meta().Name)
+	return true
+}
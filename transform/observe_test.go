@@ -0,0 +1,60 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/metrics"
+	"github.com/carlodf/cetl/opener"
+)
+
+func TestObserve(t *testing.T) {
+	run := metrics.NewRun()
+	var failedAt []int64
+	hooks := run.Hooks()
+	onMapperError := hooks.OnMapperError
+	hooks.OnMapperError = func(source string, offset int64, err error) {
+		failedAt = append(failedAt, offset)
+		onMapperError(source, offset, err)
+	}
+	ops := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.csv", Data: []byte("n\n1\n2\n")},
+		opener.InMemorySource{SourceName: "b.csv", Data: []byte("n\nx\n")},
+	}
+	ctx := context.Background()
+	mux := connector.NewMuxReader(ctx, ops, connector.WithHooks(hooks))
+	tr := NewDecodeMapTransform[int](ObserveDecoder(NewCSVDecoder(CSVDecoderOptions{}), hooks))
+	it, err := tr.Transform(ctx, mux, ObserveMapper(func(rec Extractor) (int, error) {
+		v, _ := rec.ByName("n")
+		return strconv.Atoi(v)
+	}, hooks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	sum := 0
+	for it.Next() {
+		sum += it.Struct()
+	}
+	if err := it.Err(); !errors.Is(err, strconv.ErrSyntax) || sum != 3 {
+		t.Fatalf("sum %d, Err = %v", sum, it.Err())
+	}
+	s := run.Snapshot()
+	if s.Records != 3 || s.MapperErrors != 1 || s.BytesRead != 10 || len(s.Sources) != 2 {
+		t.Fatalf("snapshot = %+v", s)
+	}
+	if a, b := s.Sources[0], s.Sources[1]; a.Records != 2 || b.Records != 1 || b.MapperErrors != 1 {
+		t.Fatalf("sources = %+v", s.Sources)
+	}
+	if len(failedAt) != 1 || failedAt[0] != 2 {
+		t.Fatalf("mapper error offsets = %v", failedAt)
+	}
+
+	dec := NewCSVDecoder(CSVDecoderOptions{})
+	if ObserveDecoder(dec, nil) != dec {
+		t.Fatal("ObserveDecoder with nil hooks wraps the decoder")
+	}
+}
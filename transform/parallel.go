@@ -0,0 +1,318 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/carlodf/cetl/connector"
+)
+
+//
+// Public API
+//
+
+// ParallelOptions configures NewParallelDecodeMapTransform.
+//
+// Workers is the number of goroutines running the Mapper; it defaults to
+// runtime.GOMAXPROCS(0). MaxInFlight bounds the number of records that
+// have been decoded but not yet returned by Next, which bounds memory use
+// when one record is slow to map; it defaults to twice Workers and is
+// raised to Workers if smaller.
+type ParallelOptions struct {
+	Workers     int
+	MaxInFlight int
+}
+
+// NewParallelDecodeMapTransform constructs a Transformer[T] like
+// NewDecodeMapTransform, but the Mapper runs on several goroutines.
+//
+// Records are decoded on a single goroutine and copied with CopyRecord
+// before being handed to a worker, so the Extractor passed to the Mapper
+// stays valid for as long as the Mapper needs it. Values are returned in
+// the order of the decoded records, and the iterator's Meta reports the
+// SrcMeta of the record each value was mapped from.
+//
+// The Mapper must be safe for concurrent use. If it fails, values mapped
+// from earlier records are still returned, then Next returns false and Err
+// reports the error; records after the failing one are discarded. Close
+// and context cancellation do not interrupt running Mapper calls; they wait
+// for them to return.
+func NewParallelDecodeMapTransform[T any](decoder Decoder, opt ParallelOptions) Transformer[T] {
+	if decoder == nil {
+		panic("NewParallelDecodeMapTransform: decoder in nil")
+	}
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	inFlight := opt.MaxInFlight
+	if inFlight <= 0 {
+		inFlight = 2 * workers
+	}
+	inFlight = max(inFlight, workers)
+	return &parallelDecodeMapTransform[T]{decoder: decoder, workers: workers, inFlight: inFlight}
+}
+
+// Transform decodes rc and starts the workers. Close the returned iterator
+// to stop them.
+func (t *parallelDecodeMapTransform[T]) Transform(
+	ctx context.Context,
+	rc connector.SrcAwareStreamer,
+	mapFn Mapper[T],
+) (StructIterator[T], error) {
+	if mapFn == nil {
+		return nil, fmt.Errorf("transform: Mapper[T] must not be nil")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	recIt, err := t.decoder.Decode(ctx, rc)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	it := &parallelIterator[T]{
+		ctx:    ctx,
+		inner:  recIt,
+		cancel: cancel,
+		order:  make(chan *parallelJob[T], t.inFlight),
+	}
+	jobs := make(chan *parallelJob[T], t.inFlight)
+	it.wg.Add(1 + t.workers)
+	go it.produce(ctx, jobs)
+	for range t.workers {
+		go it.work(ctx, jobs, mapFn)
+	}
+	return it, nil
+}
+
+// CopyRecord returns a copy of rec that remains valid after the iterator
+// that produced it advances.
+//
+// Records of the decoders in this package are copied exactly. Other
+// Extractor implementations are snapshotted through their interface: the
+// copy answers ByName only for the names reported by Names.
+func CopyRecord(rec Extractor) Extractor {
+	if c, ok := rec.(recordCopier); ok {
+		return c.copyRecord()
+	}
+	n := rec.Len()
+	s := recordSnapshot{
+		values:  make([]string, n),
+		present: make([]bool, n),
+		names:   rec.Names(),
+		meta:    rec.Meta(),
+	}
+	for i := range n {
+		s.values[i], s.present[i] = rec.ByIndex(i)
+	}
+	if s.names != nil {
+		s.index = buildIndex(s.names)
+	}
+	return s
+}
+
+//
+// Unexported helpers
+//
+
+type parallelDecodeMapTransform[T any] struct {
+	decoder  Decoder
+	workers  int
+	inFlight int
+}
+
+// parallelJob carries one record through a worker. done receives the
+// mapped value once the worker is finished.
+type parallelJob[T any] struct {
+	rec  Extractor
+	done chan parallelResult[T]
+}
+
+type parallelResult[T any] struct {
+	val T
+	err error
+}
+
+type parallelIterator[T any] struct {
+	// ctx is canceled by Close or by the caller.
+	ctx    context.Context
+	inner  RecordIterator
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// order queues the jobs in input order; it is closed by the producer
+	// once the input is exhausted or failed. Its capacity bounds the
+	// records in flight.
+	order chan *parallelJob[T]
+	// decodeErr is the input's error, or the context's if the producer
+	// was canceled, set by the producer before closing order.
+	decodeErr error
+
+	cur     T
+	curMeta connector.SrcMeta
+	err     error
+	done    bool
+	closed  bool
+}
+
+// produce decodes records and queues them, in order, for the workers and
+// for Next.
+func (it *parallelIterator[T]) produce(ctx context.Context, jobs chan<- *parallelJob[T]) {
+	defer it.wg.Done()
+	defer close(it.order)
+	defer close(jobs)
+	for it.inner.Next() {
+		job := &parallelJob[T]{rec: CopyRecord(it.inner.Record()), done: make(chan parallelResult[T], 1)}
+		select {
+		case it.order <- job:
+		case <-ctx.Done():
+			it.decodeErr = ctx.Err()
+			return
+		}
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			it.decodeErr = ctx.Err()
+			return
+		}
+	}
+	it.decodeErr = it.inner.Err()
+}
+
+func (it *parallelIterator[T]) work(ctx context.Context, jobs <-chan *parallelJob[T], mapFn Mapper[T]) {
+	defer it.wg.Done()
+	for job := range jobs {
+		if ctx.Err() != nil {
+			// Drain without mapping; nobody waits for the result.
+			continue
+		}
+		val, err := mapFn(job.rec)
+		job.done <- parallelResult[T]{val: val, err: err}
+	}
+}
+
+// Next returns the next value in input order, waiting for its worker if
+// needed.
+func (it *parallelIterator[T]) Next() bool {
+	if it.done {
+		return false
+	}
+	job, ok := <-it.order
+	if !ok {
+		it.err = it.decodeErr
+		it.finish()
+		return false
+	}
+	var res parallelResult[T]
+	select {
+	case res = <-job.done:
+	case <-it.ctx.Done():
+		// The job may never be mapped once the context is canceled.
+		res.err = it.ctx.Err()
+	}
+	if res.err != nil {
+		it.err = res.err
+		it.finish()
+		return false
+	}
+	it.cur, it.curMeta = res.val, job.rec.Meta()
+	return true
+}
+
+// Struct returns the current value.
+func (it *parallelIterator[T]) Struct() T {
+	return it.cur
+}
+
+// Meta returns the source metadata of the record the current value was
+// mapped from.
+func (it *parallelIterator[T]) Meta() connector.SrcMeta {
+	return it.curMeta
+}
+
+// Err reports the first decoding or mapping error.
+func (it *parallelIterator[T]) Err() error {
+	return it.err
+}
+
+// Close stops the producer and the workers, waits for them to exit and
+// closes the record iterator. It is safe to call Close multiple times.
+func (it *parallelIterator[T]) Close() error {
+	it.finish()
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	return it.inner.Close()
+}
+
+// finish stops the goroutines and waits for them.
+func (it *parallelIterator[T]) finish() {
+	if it.done {
+		return
+	}
+	it.done = true
+	it.cancel()
+	it.wg.Wait()
+	var zero T
+	it.cur = zero
+}
+
+// recordCopier is implemented by the Extractors of this package, which
+// know how to copy themselves exactly.
+type recordCopier interface {
+	copyRecord() Extractor
+}
+
+func (s sliceExtractor) copyRecord() Extractor {
+	s.current = slices.Clone(s.current)
+	return s
+}
+
+func (n nullableExtractor) copyRecord() Extractor {
+	n.current = slices.Clone(n.current)
+	n.present = slices.Clone(n.present)
+	return n
+}
+
+// recordSnapshot is the copy CopyRecord makes of foreign Extractors.
+type recordSnapshot struct {
+	values  []string
+	present []bool
+	names   []string
+	index   map[string]int
+	meta    connector.SrcMeta
+}
+
+func (s recordSnapshot) ByIndex(i int) (string, bool) {
+	if i < 0 || i >= len(s.values) || !s.present[i] {
+		return "", false
+	}
+	return s.values[i], true
+}
+
+func (s recordSnapshot) ByName(name string) (string, bool) {
+	idx, ok := s.index[name]
+	if !ok {
+		return "", false
+	}
+	return s.ByIndex(idx)
+}
+
+func (s recordSnapshot) Len() int {
+	return len(s.values)
+}
+
+func (s recordSnapshot) Names() []string {
+	if s.names == nil {
+		return nil
+	}
+	return append([]string(nil), s.names...)
+}
+
+func (s recordSnapshot) Meta() connector.SrcMeta {
+	return s.meta
+}
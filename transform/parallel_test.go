@@ -0,0 +1,204 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/opener"
+)
+
+func TestParallelDecodeMapTransform_PreservesOrderAndMeta(t *testing.T) {
+	ctx := context.Background()
+	var data strings.Builder
+	data.WriteString("n\n")
+	for i := range 200 {
+		fmt.Fprintf(&data, "%d\n", i)
+	}
+	srcs := []opener.Opener{
+		opener.InMemorySource{SourceName: "a.csv", Data: []byte(data.String())},
+		opener.InMemorySource{SourceName: "b.csv", Data: []byte("n\n200\n201\n")},
+	}
+	tr := NewParallelDecodeMapTransform[int](NewCSVDecoder(CSVDecoderOptions{}), ParallelOptions{Workers: 4, MaxInFlight: 8})
+	it, err := tr.Transform(ctx, connector.NewMuxReader(ctx, srcs), func(e Extractor) (int, error) {
+		v, _ := e.ByName("n")
+		n, err := strconv.Atoi(v)
+		// Later records finish first, and the CSV reader reuses its row
+		// slice meanwhile: the record must have been copied.
+		time.Sleep(time.Duration(n%5) * 100 * time.Microsecond)
+		if v2, _ := e.ByName("n"); v2 != v {
+			return 0, fmt.Errorf("record changed under the mapper: %q → %q", v, v2)
+		}
+		return n, err
+	})
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	defer it.Close()
+	want := 0
+	for it.Next() {
+		if got := it.Struct(); got != want {
+			t.Fatalf("value = %d, want %d", got, want)
+		}
+		meta := it.(MetaProvider).Meta()
+		if wantName := map[bool]string{true: "a.csv", false: "b.csv"}[want < 200]; meta.Name != wantName {
+			t.Fatalf("value %d: Meta().Name = %q, want %q", want, meta.Name, wantName)
+		}
+		want++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want != 202 {
+		t.Fatalf("got %d values, want 202", want)
+	}
+}
+
+func TestParallelDecodeMapTransform_MapperError(t *testing.T) {
+	recs := make([]Extractor, 50)
+	for i := range recs {
+		recs[i] = stubExtractor{vals: []string{strconv.Itoa(i)}}
+	}
+	inner := &stubRecordIterator{recs: recs}
+	tr := NewParallelDecodeMapTransform[string](&stubDecoder{recIt: inner}, ParallelOptions{Workers: 3})
+	wantErr := errors.New("bad record")
+	it, err := tr.Transform(context.Background(), nil, func(e Extractor) (string, error) {
+		v, _ := e.ByIndex(0)
+		if v == "10" {
+			return "", wantErr
+		}
+		return v, nil
+	})
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	n := 0
+	for it.Next() {
+		if it.Struct() != strconv.Itoa(n) {
+			t.Fatalf("value = %q, want %d", it.Struct(), n)
+		}
+		n++
+	}
+	if n != 10 || it.Err() != wantErr {
+		t.Fatalf("values = %d, Err = %v", n, it.Err())
+	}
+	if err := it.Close(); err != nil || !inner.closed {
+		t.Fatalf("Close = %v, inner closed = %v", err, inner.closed)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("second Close = %v", err)
+	}
+}
+
+func TestParallelDecodeMapTransform_DecodeError(t *testing.T) {
+	wantErr := errors.New("decoder failure")
+	inner := &stubRecordIterator{recs: []Extractor{stubExtractor{vals: []string{"x"}}}, err: wantErr}
+	tr := NewParallelDecodeMapTransform[string](&stubDecoder{recIt: inner}, ParallelOptions{})
+	it, err := tr.Transform(context.Background(), nil, func(e Extractor) (string, error) {
+		v, _ := e.ByIndex(0)
+		return v, nil
+	})
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	defer it.Close()
+	if !it.Next() || it.Struct() != "x" {
+		t.Fatalf("expected the decoded record first")
+	}
+	if it.Next() || it.Err() != wantErr {
+		t.Fatalf("Err = %v, want %v", it.Err(), wantErr)
+	}
+}
+
+func TestParallelDecodeMapTransform_BoundsInFlight(t *testing.T) {
+	recs := make([]Extractor, 100)
+	for i := range recs {
+		recs[i] = stubExtractor{vals: []string{strconv.Itoa(i)}}
+	}
+	inner := &stubRecordIterator{recs: recs}
+	tr := NewParallelDecodeMapTransform[int](&stubDecoder{recIt: inner}, ParallelOptions{Workers: 2, MaxInFlight: 4})
+	it, err := tr.Transform(context.Background(), nil, func(Extractor) (int, error) { return 0, nil })
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	if !it.Next() {
+		t.Fatalf("expected a value")
+	}
+	time.Sleep(20 * time.Millisecond)
+	// Close waits for the producer, so reading idx afterwards is safe.
+	if err := it.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// One consumed, MaxInFlight queued, one decoded and waiting for room.
+	if inner.idx > 1+4+1 {
+		t.Fatalf("decoded %d records ahead of the consumer, want at most 6", inner.idx)
+	}
+}
+
+func TestParallelDecodeMapTransform_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	recs := []Extractor{stubExtractor{vals: []string{"a"}}, stubExtractor{vals: []string{"b"}}}
+	tr := NewParallelDecodeMapTransform[string](&stubDecoder{recIt: &stubRecordIterator{recs: recs}}, ParallelOptions{Workers: 1})
+	release := make(chan struct{})
+	it, err := tr.Transform(ctx, nil, func(e Extractor) (string, error) {
+		<-release
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	cancel()
+	// Canceling does not interrupt a running Mapper: Next waits for it.
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	if it.Next() {
+		t.Fatalf("Next after cancel = true")
+	}
+	if !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("Err = %v, want context.Canceled", it.Err())
+	}
+	_ = it.Close()
+}
+
+func TestCopyRecord(t *testing.T) {
+	row := []string{"1", "alice"}
+	rec := sliceExtractor{current: row, header: []string{"id", "name"}, invIndex: buildIndex([]string{"id", "name"})}
+	cp := CopyRecord(rec)
+	row[1] = "changed"
+	if v, _ := cp.ByName("name"); v != "alice" {
+		t.Fatalf("copy shares the row: name = %q", v)
+	}
+
+	foreign := stubExtractor{vals: []string{"x", "y"}, names: []string{"a", "b"}, meta: connector.SrcMeta{Name: "s", ByteOffset: 7}}
+	cp = CopyRecord(foreign)
+	if v, ok := cp.ByName("b"); !ok || v != "y" {
+		t.Fatalf("ByName(b) = %q, %v", v, ok)
+	}
+	if v, ok := cp.ByIndex(2); ok || v != "" {
+		t.Fatalf("ByIndex(2) = %q, %v", v, ok)
+	}
+	if cp.Len() != 2 || cp.Meta() != foreign.meta || !equalSilce(cp.Names(), foreign.names) {
+		t.Fatalf("copy = %d fields, %+v, %q", cp.Len(), cp.Meta(), cp.Names())
+	}
+}
+
+func TestMappedIterator_Meta(t *testing.T) {
+	meta := connector.SrcMeta{Name: "a.csv", ByteOffset: 4}
+	inner := &stubRecordIterator{recs: []Extractor{stubExtractor{vals: []string{"x"}, meta: meta}}}
+	it, err := NewDecodeMapTransform[string](&stubDecoder{recIt: inner}).Transform(context.Background(), nil,
+		func(e Extractor) (string, error) { v, _ := e.ByIndex(0); return v, nil })
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("expected a value")
+	}
+	if got := it.(MetaProvider).Meta(); got != meta {
+		t.Fatalf("Meta() = %+v, want %+v", got, meta)
+	}
+}
@@ -0,0 +1,196 @@
+package transform
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Public API
+//
+
+// NewStructMapper returns a Mapper filling the struct type T field by
+// field from the record's named values, such as a struct emitted by
+// Schema.GoStruct.
+//
+// Exported fields map to columns named by their `cetl` struct tag, or by
+// the field name when untagged; fields tagged `cetl:"-"` are skipped and
+// the fields of embedded structs are mapped as if they were fields of T,
+// as with load.NewSQLSink (see TaggedFields). Nil embedded pointers to
+// structs are allocated.
+//
+// Fields may be strings, bools, integers, floats, time.Time values parsed
+// in the layout of their `layout` tag (time.RFC3339 by default),
+// encoding.TextUnmarshaler implementations, or pointers to any of these.
+// Values other than strings are trimmed of surrounding spaces first. A
+// null value, that is a missing column or an empty or blank value, leaves
+// a pointer nil and a string empty, and is an error for other fields.
+//
+// NewStructMapper panics if T is not a struct, if it has no mapped field,
+// or if a mapped field has an unsupported type.
+func NewStructMapper[T any]() Mapper[T] {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("NewStructMapper: %v is not a struct", t))
+	}
+	fields := mappedFields(t)
+	return func(rec Extractor) (T, error) {
+		var v T
+		rv := reflect.ValueOf(&v).Elem()
+		for _, f := range fields {
+			s, ok := rec.ByName(f.column)
+			fv, err := fieldByIndex(rv, f.index)
+			if err == nil {
+				err = f.set(fv, s, ok)
+			}
+			if err != nil {
+				return v, fmt.Errorf("column %q: %w", f.column, err)
+			}
+		}
+		return v, nil
+	}
+}
+
+//
+// Unexported helpers
+//
+
+var (
+	timeType            = reflect.TypeFor[time.Time]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// mappedField is a struct field filled by a struct mapper.
+type mappedField struct {
+	column string
+	index  []int
+	layout string
+}
+
+// mappedFields maps the exported fields of the struct type t.
+func mappedFields(t reflect.Type) []mappedField {
+	var fields []mappedField
+	for _, f := range TaggedFields(t, settable) {
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if !settable(ft) {
+			panic(fmt.Sprintf("NewStructMapper: field %s has unsupported type %v", f.Name, f.Type))
+		}
+		layout := f.Tag.Get("layout")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		fields = append(fields, mappedField{column: f.Column, index: f.Index, layout: layout})
+	}
+	if len(fields) == 0 {
+		panic(fmt.Sprintf("NewStructMapper: %v has no exported fields", t))
+	}
+	return fields
+}
+
+// fieldByIndex returns the field of v at index, allocating the nil
+// embedded pointers it crosses.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// settable reports whether a struct mapper can parse a value of type t.
+func settable(t reflect.Type) bool {
+	if t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// set parses s into v; ok is false for a missing column.
+func (f mappedField) set(v reflect.Value, s string, ok bool) error {
+	null := !ok || strings.TrimSpace(s) == ""
+	if v.Kind() == reflect.Pointer {
+		if null {
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := f.parse(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if null {
+		if v.Kind() == reflect.String {
+			return nil
+		}
+		return fmt.Errorf("missing value")
+	}
+	return f.parse(v, s)
+}
+
+// parse parses the non-null value s into v.
+func (f mappedField) parse(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok && v.Type() != timeType {
+		return u.UnmarshalText([]byte(strings.TrimSpace(s)))
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return nil
+	}
+	s = strings.TrimSpace(s)
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid int %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid uint %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid float %q", s)
+		}
+		v.SetFloat(x)
+	case reflect.Struct: // time.Time
+		t, err := time.Parse(f.layout, s)
+		if err != nil {
+			return fmt.Errorf("invalid time %q for layout %q", s, f.layout)
+		}
+		v.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package transform
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mappedBase struct {
+	ID int `cetl:"id"`
+}
+
+type mappedRow struct {
+	mappedBase
+	Name    string
+	Note    *string    `cetl:"note"`
+	Score   float32    `cetl:"score"`
+	Count   *uint8     `cetl:"count"`
+	Active  bool       `cetl:"active"`
+	Day     time.Time  `cetl:"day" layout:"02/01/2006"`
+	At      *time.Time `cetl:"at"`
+	Addr    netip.Addr `cetl:"addr"`
+	Skipped string     `cetl:"-"`
+	private string
+}
+
+func TestNewStructMapper(t *testing.T) {
+	names := []string{"id", "Name", "note", "score", "count", "active", "day", "at", "addr", "Skipped"}
+	mapper := NewStructMapper[mappedRow]()
+	got, err := mapper(stubExtractor{
+		vals:  []string{" 7 ", " ann ", "", "1.5", "", "true", "03/10/2024", "2024-10-01T08:00:00Z", "10.0.0.1", "x"},
+		names: names,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 7 || got.Name != " ann " || got.Note != nil || got.Score != 1.5 || got.Count != nil || !got.Active ||
+		!got.Day.Equal(time.Date(2024, 10, 3, 0, 0, 0, 0, time.UTC)) || got.At == nil || got.At.Hour() != 8 ||
+		got.Addr != netip.MustParseAddr("10.0.0.1") || got.Skipped != "" {
+		t.Fatalf("got %+v", got)
+	}
+
+	cases := []struct {
+		name string
+		vals []string
+		want string
+	}{
+		{"invalid int", []string{"x"}, `column "id": invalid int "x"`},
+		{"missing value", []string{"1", "", "", "1", "", ""}, `column "active": missing value`},
+		{"uint overflow", []string{"1", "", "", "1", "300"}, `column "count": invalid uint "300"`},
+		{"invalid time", []string{"1", "", "", "1", "", "t", "2024-10-03"}, `column "day": invalid time "2024-10-03" for layout "02/01/2006"`},
+		{"invalid text", []string{"1", "", "", "1", "", "t", "03/10/2024", "", "10.0.0"}, `column "addr": ParseAddr("10.0.0")`},
+	}
+	for _, tc := range cases {
+		_, err := mapper(stubExtractor{vals: tc.vals, names: names[:len(tc.vals)]})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestNewStructMapper_Panics(t *testing.T) {
+	for name, f := range map[string]func(){
+		"not a struct":     func() { NewStructMapper[int]() },
+		"no fields":        func() { NewStructMapper[struct{ x int }]() },
+		"unsupported type": func() { NewStructMapper[struct{ Tags []string }]() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+type MappedAddress struct {
+	City string `cetl:"city"`
+	Zip  *int   `cetl:"zip"`
+}
+
+type mappedInner struct {
+	Code string `cetl:"code"`
+}
+
+func TestNewStructMapper_EmbeddedPointer(t *testing.T) {
+	type row struct {
+		ID int `cetl:"id"`
+		*MappedAddress
+	}
+	mapper := NewStructMapper[row]()
+	got, err := mapper(stubExtractor{vals: []string{"1", "Rome", "100"}, names: []string{"id", "city", "zip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MappedAddress == nil || got.City != "Rome" || got.Zip == nil || *got.Zip != 100 {
+		t.Fatalf("got %+v", got)
+	}
+
+	// Embedded pointers to unexported structs cannot be allocated.
+	type hidden struct {
+		ID int `cetl:"id"`
+		*mappedInner
+	}
+	_, err = NewStructMapper[hidden]()(stubExtractor{vals: []string{"1", "x"}, names: []string{"id", "code"}})
+	if want := `column "code": cannot set embedded pointer to unexported struct transform.mappedInner`; err == nil || err.Error() != want {
+		t.Fatalf("err = %v, want %q", err, want)
+	}
+}
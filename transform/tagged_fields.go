@@ -0,0 +1,83 @@
+package transform
+
+import "reflect"
+
+//
+// Public API
+//
+
+// TaggedField is a struct field mapped to a column.
+type TaggedField struct {
+	reflect.StructField
+	// Column is the name given by the field's `cetl` tag, or the field
+	// name when untagged.
+	Column string
+}
+
+// TaggedFields lists the fields of the struct type t that map to columns,
+// in the order of reflect.VisibleFields, following the rules of the `cetl`
+// struct tag shared by NewStructMapper and load.NewSQLSink:
+//
+//   - unexported fields and fields tagged `cetl:"-"` are skipped;
+//   - a field maps to the column named by its tag, or by its name;
+//   - the fields of an untagged embedded struct, or pointer to struct,
+//     map as if they were fields of t, unless leaf reports the struct as a
+//     single value, as NewStructMapper does for time.Time;
+//   - a tagged or leaf embedded struct maps to one column, and a skipped
+//     one hides its fields.
+//
+// leaf may be nil. The Index of a field promoted through an embedded
+// pointer crosses that pointer, which may be nil in a value of t.
+func TaggedFields(t reflect.Type, leaf func(reflect.Type) bool) []TaggedField {
+	var fields []TaggedField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("cetl")
+		if tag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		// The fields of untagged embedded structs are visible on their own.
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct && (leaf == nil || !leaf(ft)) {
+			continue
+		}
+		if hiddenByParent(t, f.Index, leaf) {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, TaggedField{StructField: f, Column: name})
+	}
+	return fields
+}
+
+//
+// Unexported helpers
+//
+
+// hiddenByParent reports whether a field promoted through index belongs to
+// an embedded struct that is itself tagged or a leaf, and so mapped as one
+// column, or excluded with `cetl:"-"`.
+func hiddenByParent(t reflect.Type, index []int, leaf func(reflect.Type) bool) bool {
+	for i := 1; i < len(index); i++ {
+		parent := t.FieldByIndex(index[:i])
+		if parent.Tag.Get("cetl") != "" {
+			return true
+		}
+		pt := parent.Type
+		if pt.Kind() == reflect.Pointer {
+			pt = pt.Elem()
+		}
+		if leaf != nil && leaf(pt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package transform
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+type taggedInner struct {
+	City string `cetl:"city"`
+	Zip  string
+}
+
+type taggedRow struct {
+	ID int `cetl:"id"`
+	*taggedInner
+	Home    taggedInner `cetl:"home"`
+	Skipped struct {
+		X string
+	} `cetl:"-"`
+	time.Time
+	Note    string
+	private string
+}
+
+func TestTaggedFields(t *testing.T) {
+	columns := func(leaf func(reflect.Type) bool) []string {
+		var out []string
+		for _, f := range TaggedFields(reflect.TypeFor[taggedRow](), leaf) {
+			out = append(out, f.Column)
+		}
+		return out
+	}
+	if got, want := columns(nil), []string{"id", "city", "Zip", "home", "Note"}; !slices.Equal(got, want) {
+		t.Fatalf("columns = %q, want %q", got, want)
+	}
+	if got, want := columns(settable), []string{"id", "city", "Zip", "home", "Time", "Note"}; !slices.Equal(got, want) {
+		t.Fatalf("columns with leaf = %q, want %q", got, want)
+	}
+	f := TaggedFields(reflect.TypeFor[taggedRow](), nil)[1]
+	if f.Name != "City" || !slices.Equal(f.Index, []int{1, 0}) {
+		t.Fatalf("field = %+v", f)
+	}
+}
@@ -54,9 +54,10 @@ type mappedIterator[T any] struct {
 	inner RecordIterator
 	mapFn Mapper[T]
 
-	cur  T
-	err  error
-	done bool
+	cur     T
+	curMeta connector.SrcMeta
+	err     error
+	done    bool
 }
 
 func (m *mappedIterator[T]) Next() bool {
@@ -82,6 +83,7 @@ func (m *mappedIterator[T]) Next() bool {
 	}
 
 	m.cur = val
+	m.curMeta = m.inner.Record().Meta()
 	return true
 }
 
@@ -89,6 +91,12 @@ func (m *mappedIterator[T]) Struct() T {
 	return m.cur
 }
 
+// Meta returns the source metadata of the record the current value was
+// mapped from.
+func (m *mappedIterator[T]) Meta() connector.SrcMeta {
+	return m.curMeta
+}
+
 func (m *mappedIterator[T]) Err() error {
 	if m.err != nil {
 		return m.err
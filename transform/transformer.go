@@ -17,6 +17,7 @@ package transform
 
 import (
 	"context"
+	"io"
 
 	"github.com/carlodf/cetl/connector"
 )
@@ -119,6 +120,24 @@ type StructIterator[T any] interface {
 	Close() error
 }
 
+// MetaProvider is implemented by iterators that can report the source
+// metadata of their current value, such as the StructIterator values
+// returned by NewDecodeMapTransform and NewParallelDecodeMapTransform.
+type MetaProvider interface {
+	// Meta returns the source metadata of the record the current value
+	// was mapped from.
+	Meta() connector.SrcMeta
+}
+
+// MetaOf returns the source metadata of the current value of it if it is a
+// MetaProvider, and the zero SrcMeta otherwise.
+func MetaOf(it any) connector.SrcMeta {
+	if mp, ok := it.(MetaProvider); ok {
+		return mp.Meta()
+	}
+	return connector.SrcMeta{}
+}
+
 //
 // Decoder for a specific serialization format
 //
@@ -140,6 +159,27 @@ type Decoder interface {
 	Decode(ctx context.Context, rc connector.SrcAwareStreamer) (RecordIterator, error)
 }
 
+//
+// Encoder for a specific serialization format
+//
+
+// Encoder is the counterpart of Decoder: it writes a stream of decoded
+// records in a specific on-wire format, so that records can be converted
+// between formats without mapping them to a typed struct:
+//
+//	it, _ := transform.NewCSVDecoder(transform.CSVDecoderOptions{Comma: '|'}).Decode(ctx, mux)
+//	n, err := transform.NewJSONLEncoder().Encode(ctx, os.Stdout, it)
+//
+// As for Decoder, format-specific configuration is supplied when
+// constructing the Encoder.
+type Encoder interface {
+
+	// Encode writes every record of it to w and returns the number of
+	// records written. Encode owns it and closes it before returning; w is
+	// not closed. Encode stops at the first error of it, of w or of ctx.
+	Encode(ctx context.Context, w io.Writer, it RecordIterator) (int64, error)
+}
+
 //
 // Mapper from a record to your strongly-typed struct
 //
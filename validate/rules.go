@@ -0,0 +1,156 @@
+package validate
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// The field functions of the rules return the value a rule checks and
+// whether it is present; an absent value is null. Only NotNull checks
+// nulls: the other rules accept them, as SQL constraints do. Column and
+// ColumnFloat read the fields of records; for struct values, write a
+// function such as
+//
+//	func(o Order) (int64, bool) { return o.Qty, true }
+
+// NotNull requires the value of field to be present.
+func NotNull[T, V any](name string, field func(T) (V, bool)) Rule[T] {
+	return newRule(name, func() func(T) error {
+		return func(v T) error {
+			if _, ok := field(v); !ok {
+				return errors.New("value is null")
+			}
+			return nil
+		}
+	})
+}
+
+// Unique requires the values of field to differ across the stream. The
+// values seen are kept in memory for the whole iteration.
+func Unique[T any, V comparable](name string, field func(T) (V, bool)) Rule[T] {
+	return newRule(name, func() func(T) error {
+		seen := map[V]struct{}{}
+		return func(v T) error {
+			x, ok := field(v)
+			if !ok {
+				return nil
+			}
+			if _, dup := seen[x]; dup {
+				return fmt.Errorf("duplicate value %s", formatValue(x))
+			}
+			seen[x] = struct{}{}
+			return nil
+		}
+	})
+}
+
+// Match requires the values of field to match re.
+func Match[T any](name string, field func(T) (string, bool), re *regexp.Regexp) Rule[T] {
+	return newRule(name, func() func(T) error {
+		return func(v T) error {
+			if x, ok := field(v); ok && !re.MatchString(x) {
+				return fmt.Errorf("%q does not match %q", x, re.String())
+			}
+			return nil
+		}
+	})
+}
+
+// Range requires the values of field to be between min and max, inclusive.
+// NaN is out of any range.
+func Range[T any, V cmp.Ordered](name string, field func(T) (V, bool), min, max V) Rule[T] {
+	return newRule(name, func() func(T) error {
+		return func(v T) error {
+			if x, ok := field(v); ok && !(x >= min && x <= max) {
+				return fmt.Errorf("%s is not in [%s, %s]", formatValue(x), formatValue(min), formatValue(max))
+			}
+			return nil
+		}
+	})
+}
+
+// OneOf requires the values of field to be one of values.
+func OneOf[T any, V comparable](name string, field func(T) (V, bool), values ...V) Rule[T] {
+	set := make(map[V]struct{}, len(values))
+	list := make([]string, len(values))
+	for i, x := range values {
+		set[x] = struct{}{}
+		list[i] = formatValue(x)
+	}
+	return newRule(name, func() func(T) error {
+		return func(v T) error {
+			x, ok := field(v)
+			if !ok {
+				return nil
+			}
+			if _, in := set[x]; !in {
+				return fmt.Errorf("%s is not one of [%s]", formatValue(x), strings.Join(list, ", "))
+			}
+			return nil
+		}
+	})
+}
+
+// Check requires fn to return nil, for conditions across fields such as
+// "shipped_at is not before ordered_at"; the error fn returns describes
+// the violation.
+func Check[T any](name string, fn func(T) error) Rule[T] {
+	return newRule(name, func() func(T) error { return fn })
+}
+
+// Column returns a field function reading the named column of a record;
+// a missing column and an empty or blank value are null.
+func Column(name string) func(transform.Extractor) (string, bool) {
+	return func(r transform.Extractor) (string, bool) {
+		v, ok := r.ByName(name)
+		if !ok || strings.TrimSpace(v) == "" {
+			return "", false
+		}
+		return v, true
+	}
+}
+
+// ColumnFloat is like Column but parses the value as a float64, after
+// trimming surrounding spaces. A value that does not parse reads as NaN,
+// which Range rejects.
+func ColumnFloat(name string) func(transform.Extractor) (float64, bool) {
+	col := Column(name)
+	return func(r transform.Extractor) (float64, bool) {
+		v, ok := col(r)
+		if !ok {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return math.NaN(), true
+		}
+		return f, true
+	}
+}
+
+//
+// Unexported helpers
+//
+
+func newRule[T any](name string, check func() func(T) error) Rule[T] {
+	return Rule[T]{Name: name, New: check}
+}
+
+// formatValue formats x for a violation message, quoting strings.
+func formatValue(x any) string {
+	if s, ok := x.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(x)
+}
@@ -0,0 +1,89 @@
+package validate
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/transform"
+)
+
+// row is a record of named columns.
+type row map[string]string
+
+func (r row) ByIndex(int) (string, bool) { return "", false }
+func (r row) ByName(name string) (string, bool) {
+	v, ok := r[name]
+	return v, ok
+}
+func (r row) Len() int                { return len(r) }
+func (r row) Names() []string         { return nil }
+func (r row) Meta() connector.SrcMeta { return connector.SrcMeta{} }
+
+func TestRules(t *testing.T) {
+	cases := []struct {
+		rule Rule[transform.Extractor]
+		in   []row
+		want []string // one message per value, "" when valid
+	}{
+		{
+			rule: NotNull("r", Column("id")),
+			in:   []row{{"id": "1"}, {"id": " "}, {}},
+			want: []string{"", "value is null", "value is null"},
+		},
+		{
+			rule: Unique("r", Column("id")),
+			in:   []row{{"id": "1"}, {"id": "2"}, {}, {"id": "1"}, {}},
+			want: []string{"", "", "", `duplicate value "1"`, ""},
+		},
+		{
+			rule: Match("r", Column("sku"), regexp.MustCompile(`^[A-Z]{3}-\d+$`)),
+			in:   []row{{"sku": "ABC-1"}, {"sku": "abc-1"}, {}},
+			want: []string{"", `"abc-1" does not match "^[A-Z]{3}-\\d+$"`, ""},
+		},
+		{
+			rule: Range("r", ColumnFloat("n"), -1, 1.5),
+			in:   []row{{"n": " 1.5 "}, {"n": "-1"}, {"n": "2"}, {"n": "1,5"}, {"n": ""}},
+			want: []string{"", "", "2 is not in [-1, 1.5]", "NaN is not in [-1, 1.5]", ""},
+		},
+		{
+			rule: Range("r", Column("code"), "A", "M"),
+			in:   []row{{"code": "B"}, {"code": "Z"}},
+			want: []string{"", `"Z" is not in ["A", "M"]`},
+		},
+		{
+			rule: OneOf("r", Column("cur"), "EUR", "USD"),
+			in:   []row{{"cur": "EUR"}, {"cur": "eur"}, {}},
+			want: []string{"", `"eur" is not one of ["EUR", "USD"]`, ""},
+		},
+	}
+	for _, tc := range cases {
+		check := tc.rule.New()
+		var got []string
+		for _, r := range tc.in {
+			msg := ""
+			if err := check(r); err != nil {
+				msg = err.Error()
+			}
+			got = append(got, msg)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%v:\ngot  %q\nwant %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestColumnFloat(t *testing.T) {
+	f := ColumnFloat("n")
+	if v, ok := f(row{"n": " 2.5"}); !ok || v != 2.5 {
+		t.Fatalf("got %v, %v", v, ok)
+	}
+	if v, ok := f(row{"n": "x"}); !ok || !math.IsNaN(v) {
+		t.Fatalf("got %v, %v", v, ok)
+	}
+	if _, ok := f(row{}); ok {
+		t.Fatal("missing column reported present")
+	}
+}
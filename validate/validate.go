@@ -0,0 +1,308 @@
+// Package validate checks data-quality rules on every value of a stream
+// and reports the violations with the SrcMeta of the offending record:
+//
+//	rules := []validate.Rule[transform.Extractor]{
+//	    validate.NotNull("id required", validate.Column("id")),
+//	    validate.Unique("id unique", validate.Column("id")),
+//	    validate.OneOf("known status", validate.Column("status"), "open", "paid"),
+//	    validate.Range("amount", validate.ColumnFloat("amount"), 0, 10000).WithMode(validate.Warn),
+//	}
+//	it := validate.ValidateRecords(ctx, recs, rules, validate.Options[transform.Extractor]{})
+//	defer it.Close()
+//	for it.Next() {
+//	    // it.Struct() passed every fail and quarantine rule.
+//	}
+//	report := it.Report() // json.Marshal(report) for a machine-readable summary
+//
+// Each rule has a Mode: Fail ends the iteration with a *ViolationError,
+// Warn only records the violation, and Quarantine diverts the value to
+// Options.Quarantine instead of yielding it.
+//
+// A stage takes ownership of its input like the operators of package
+// operator: Close closes the input, Err reports the first error, and the
+// stage implements transform.MetaProvider.
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/operator"
+	"github.com/carlodf/cetl/transform"
+)
+
+//
+// Public API
+//
+
+// Mode is what a stage does with a value that breaks a rule.
+type Mode int
+
+const (
+	// Fail ends the iteration with a *ViolationError.
+	Fail Mode = iota
+	// Warn records the violation and yields the value.
+	Warn
+	// Quarantine records the violation and passes the value to
+	// Options.Quarantine instead of yielding it.
+	Quarantine
+)
+
+// String returns "fail", "warn" or "quarantine".
+func (m Mode) String() string {
+	switch m {
+	case Fail:
+		return "fail"
+	case Warn:
+		return "warn"
+	case Quarantine:
+		return "quarantine"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// MarshalText encodes m as its String.
+func (m Mode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Rule is a named check applied to every value of a stream.
+//
+// New returns the check of one stage, so that rules with state, such as
+// Unique, start afresh for each stage; the check returns an error
+// describing the violation, or nil. NotNull, Unique, Match, Range, OneOf
+// and Check build the usual rules; custom ones only need Name and New.
+type Rule[T any] struct {
+	Name string
+	Mode Mode
+	New  func() func(T) error
+}
+
+// WithMode returns a copy of r with the given mode.
+func (r Rule[T]) WithMode(m Mode) Rule[T] {
+	r.Mode = m
+	return r
+}
+
+// Violation is a broken rule.
+type Violation struct {
+	Rule    string
+	Mode    Mode
+	Message string
+	// Source locates the record the value derives from; it is zero when
+	// the input does not implement transform.MetaProvider.
+	Source connector.SrcMeta
+}
+
+// MarshalJSON encodes v as an object with the fields rule, mode, source,
+// offset and message.
+func (v Violation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Rule    string `json:"rule"`
+		Mode    Mode   `json:"mode"`
+		Source  string `json:"source"`
+		Offset  int64  `json:"offset"`
+		Message string `json:"message"`
+	}{v.Rule, v.Mode, v.Source.Name, v.Source.ByteOffset, v.Message})
+}
+
+// ViolationError is the error of a stage stopped by a Fail rule.
+type ViolationError struct {
+	Violation Violation
+}
+
+func (e *ViolationError) Error() string {
+	v := e.Violation
+	return fmt.Sprintf("validate: %s@%d: %s: %s", v.Source.Name, v.Source.ByteOffset, v.Rule, v.Message)
+}
+
+// Report summarizes the values checked by a stage.
+//
+// Every value checked counts once in Valid, Warned or Quarantined, except
+// the value that failed the stage, if any, which is described by Failure.
+// Rules lists the rules in order, with their first violations as
+// Examples.
+type Report struct {
+	Records     int64        `json:"records"`
+	Valid       int64        `json:"valid"`
+	Warned      int64        `json:"warned"`
+	Quarantined int64        `json:"quarantined"`
+	Failure     *Violation   `json:"failure,omitempty"`
+	Rules       []RuleReport `json:"rules"`
+}
+
+// RuleReport is the share of a rule in a Report.
+type RuleReport struct {
+	Name       string      `json:"name"`
+	Mode       Mode        `json:"mode"`
+	Violations int64       `json:"violations"`
+	Examples   []Violation `json:"examples,omitempty"`
+}
+
+// Options configures a validation stage.
+//
+// MaxExamples is the number of violations kept per rule in the Report, 10
+// by default; a negative value keeps none. OnViolation, if set, is called
+// with every violation as it is found, e.g. to log warnings. Quarantine,
+// if set, receives each quarantined value with all its violations; an
+// error it returns ends the iteration. Without Quarantine, quarantined
+// values are only counted.
+type Options[T any] struct {
+	MaxExamples int
+	OnViolation func(Violation)
+	Quarantine  func(v T, violations []Violation) error
+}
+
+// Stage is the StructIterator returned by Validate. It yields the values
+// of its input that break no Fail or Quarantine rule.
+type Stage[T any] struct {
+	ctx    context.Context
+	src    transform.StructIterator[T]
+	rules  []Rule[T]
+	checks []func(T) error
+	opt    Options[T]
+	report Report
+
+	cur  T
+	meta connector.SrcMeta
+	err  error
+	done bool
+}
+
+// Validate checks every value of it against rules.
+func Validate[T any](ctx context.Context, it transform.StructIterator[T], rules []Rule[T], opt Options[T]) *Stage[T] {
+	if opt.MaxExamples == 0 {
+		opt.MaxExamples = 10
+	}
+	s := &Stage[T]{ctx: ctx, src: it, rules: rules, opt: opt}
+	s.report.Rules = make([]RuleReport, len(rules))
+	for i, r := range rules {
+		s.checks = append(s.checks, r.New())
+		s.report.Rules[i] = RuleReport{Name: r.Name, Mode: r.Mode}
+	}
+	return s
+}
+
+// ValidateRecords checks every record of it against rules. Records are
+// copied as with operator.FromRecords, so yielded values remain valid
+// after Next.
+func ValidateRecords(ctx context.Context, it transform.RecordIterator, rules []Rule[transform.Extractor], opt Options[transform.Extractor]) *Stage[transform.Extractor] {
+	return Validate(ctx, operator.FromRecords(ctx, it), rules, opt)
+}
+
+func (s *Stage[T]) Next() bool {
+	for !s.done {
+		if err := s.ctx.Err(); err != nil {
+			s.stop(err)
+			break
+		}
+		if !s.src.Next() {
+			s.stop(nil)
+			break
+		}
+		v, meta := s.src.Struct(), transform.MetaOf(s.src)
+		s.report.Records++
+		var (
+			violations []Violation
+			failure    *Violation
+			quarantine bool
+		)
+		for i, check := range s.checks {
+			err := check(v)
+			if err == nil {
+				continue
+			}
+			r := s.rules[i]
+			violation := Violation{Rule: r.Name, Mode: r.Mode, Message: err.Error(), Source: meta}
+			s.add(i, violation)
+			violations = append(violations, violation)
+			switch {
+			case r.Mode == Fail && failure == nil:
+				failure = &violation
+			case r.Mode == Quarantine:
+				quarantine = true
+			}
+		}
+		switch {
+		case failure != nil:
+			s.report.Failure = failure
+			s.stop(&ViolationError{Violation: *failure})
+		case quarantine:
+			s.report.Quarantined++
+			if s.opt.Quarantine != nil {
+				if err := s.opt.Quarantine(v, violations); err != nil {
+					s.stop(fmt.Errorf("validate: quarantine %s@%d: %w", meta.Name, meta.ByteOffset, err))
+				}
+			}
+		default:
+			if len(violations) > 0 {
+				s.report.Warned++
+			} else {
+				s.report.Valid++
+			}
+			s.cur, s.meta = v, meta
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Stage[T]) Struct() T {
+	return s.cur
+}
+
+func (s *Stage[T]) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.src.Err()
+}
+
+// Meta returns the SrcMeta of the input value the current value is, or
+// the zero SrcMeta if the input does not implement transform.MetaProvider.
+func (s *Stage[T]) Meta() connector.SrcMeta {
+	return s.meta
+}
+
+func (s *Stage[T]) Close() error {
+	s.done = true
+	return s.src.Close()
+}
+
+// Report returns the summary of the values checked so far; it is complete
+// once Next has returned false.
+func (s *Stage[T]) Report() Report {
+	r := s.report
+	r.Rules = make([]RuleReport, len(s.report.Rules))
+	for i, rr := range s.report.Rules {
+		rr.Examples = append([]Violation(nil), rr.Examples...)
+		r.Rules[i] = rr
+	}
+	return r
+}
+
+//
+// Unexported helpers
+//
+
+// add records a violation of the i-th rule.
+func (s *Stage[T]) add(i int, v Violation) {
+	rr := &s.report.Rules[i]
+	rr.Violations++
+	if len(rr.Examples) < s.opt.MaxExamples {
+		rr.Examples = append(rr.Examples, v)
+	}
+	if s.opt.OnViolation != nil {
+		s.opt.OnViolation(v)
+	}
+}
+
+// stop ends the iteration with err, which may be nil.
+func (s *Stage[T]) stop(err error) {
+	var zero T
+	s.cur, s.meta = zero, connector.SrcMeta{}
+	s.err = err
+	s.done = true
+}
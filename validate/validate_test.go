@@ -0,0 +1,201 @@
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/carlodf/cetl/connector"
+	"github.com/carlodf/cetl/opener"
+	"github.com/carlodf/cetl/transform"
+)
+
+// decodeCSV decodes the CSV sources given as name, content pairs.
+func decodeCSV(t *testing.T, sources ...string) transform.RecordIterator {
+	t.Helper()
+	var ops []opener.Opener
+	for i := 0; i < len(sources); i += 2 {
+		ops = append(ops, opener.InMemorySource{SourceName: sources[i], Data: []byte(sources[i+1])})
+	}
+	ctx := context.Background()
+	it, err := transform.NewCSVDecoder(transform.CSVDecoderOptions{}).Decode(ctx, connector.NewMuxReader(ctx, ops))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return it
+}
+
+func orderRules() []Rule[transform.Extractor] {
+	return []Rule[transform.Extractor]{
+		NotNull("id required", Column("id")),
+		Unique("id unique", Column("id")).WithMode(Quarantine),
+		OneOf("known status", Column("status"), "open", "paid").WithMode(Warn),
+		Range("amount range", ColumnFloat("amount"), 0, 100).WithMode(Quarantine),
+	}
+}
+
+func TestValidateRecords(t *testing.T) {
+	recs := decodeCSV(t,
+		"a.csv", "id,status,amount\n1,open,10\n2,lost,5\n1,paid,3\n",
+		"b.csv", "id,status,amount\n3,paid,x\n4,,101\n5,paid,\n",
+	)
+	var (
+		quarantined []string
+		seen        int
+	)
+	opt := Options[transform.Extractor]{
+		MaxExamples: 1,
+		OnViolation: func(Violation) { seen++ },
+		Quarantine: func(r transform.Extractor, vs []Violation) error {
+			id, _ := r.ByName("id")
+			quarantined = append(quarantined, fmt.Sprintf("%s:%d", id, len(vs)))
+			return nil
+		},
+	}
+	it := ValidateRecords(context.Background(), recs, orderRules(), opt)
+	var got []string
+	for it.Next() {
+		id, _ := it.Struct().ByName("id")
+		got = append(got, fmt.Sprintf("%s@%s:%d", id, it.Meta().Name, it.Meta().ByteOffset))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1@a.csv:17", "2@a.csv:27", "5@b.csv:33"}; !slices.Equal(got, want) {
+		t.Fatalf("yielded %q, want %q", got, want)
+	}
+	if want := []string{"1:1", "3:1", "4:1"}; !slices.Equal(quarantined, want) {
+		t.Fatalf("quarantined %q, want %q", quarantined, want)
+	}
+	if seen != 4 {
+		t.Fatalf("OnViolation called %d times", seen)
+	}
+
+	report, err := json.Marshal(it.Report())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"records":6,"valid":2,"warned":1,"quarantined":3,"rules":[` +
+		`{"name":"id required","mode":"fail","violations":0},` +
+		`{"name":"id unique","mode":"quarantine","violations":1,"examples":[{"rule":"id unique","mode":"quarantine","source":"a.csv","offset":36,"message":"duplicate value \"1\""}]},` +
+		`{"name":"known status","mode":"warn","violations":1,"examples":[{"rule":"known status","mode":"warn","source":"a.csv","offset":27,"message":"\"lost\" is not one of [\"open\", \"paid\"]"}]},` +
+		`{"name":"amount range","mode":"quarantine","violations":2,"examples":[{"rule":"amount range","mode":"quarantine","source":"b.csv","offset":17,"message":"NaN is not in [0, 100]"}]}]}`
+	if string(report) != want {
+		t.Fatalf("report:\ngot  %s\nwant %s", report, want)
+	}
+}
+
+func TestValidateRecords_Fail(t *testing.T) {
+	recs := decodeCSV(t, "a.csv", "id,status,amount\n1,open,1\n,open,2\n3,open,3\n")
+	it := ValidateRecords(context.Background(), recs, orderRules(), Options[transform.Extractor]{})
+	defer it.Close()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	var verr *ViolationError
+	if !errors.As(it.Err(), &verr) || n != 1 {
+		t.Fatalf("Err = %v after %d values", it.Err(), n)
+	}
+	if want := "validate: a.csv@26: id required: value is null"; verr.Error() != want {
+		t.Fatalf("Error() = %q, want %q", verr.Error(), want)
+	}
+	r := it.Report()
+	if r.Records != 2 || r.Valid != 1 || r.Failure == nil || r.Failure.Rule != "id required" || r.Rules[0].Violations != 1 {
+		t.Fatalf("report = %+v", r)
+	}
+}
+
+func TestValidate_Structs(t *testing.T) {
+	type order struct {
+		ID      int
+		Email   string
+		Ordered int
+		Shipped *int
+	}
+	day := func(d int) *int { return &d }
+	in := []order{
+		{1, "a@x.io", 1, day(2)},
+		{2, "nope", 5, day(3)},
+		{3, "c@x.io", 2, nil},
+	}
+	rules := []Rule[order]{
+		Match("email", func(o order) (string, bool) { return o.Email, o.Email != "" }, regexp.MustCompile(`^[^@]+@[^@]+$`)).WithMode(Warn),
+		Check("shipped after ordered", func(o order) error {
+			if o.Shipped != nil && *o.Shipped < o.Ordered {
+				return fmt.Errorf("shipped on day %d, ordered on day %d", *o.Shipped, o.Ordered)
+			}
+			return nil
+		}).WithMode(Quarantine),
+		NotNull("shipped", func(o order) (int, bool) {
+			if o.Shipped == nil {
+				return 0, false
+			}
+			return *o.Shipped, true
+		}).WithMode(Warn),
+	}
+	var msgs []string
+	it := Validate(context.Background(), transform.FromSeq(slices.Values(in)), rules, Options[order]{
+		OnViolation: func(v Violation) { msgs = append(msgs, v.Rule+": "+v.Message) },
+	})
+	var ids []int
+	for it.Next() {
+		ids = append(ids, it.Struct().ID)
+	}
+	if err := it.Err(); err != nil || !slices.Equal(ids, []int{1, 3}) {
+		t.Fatalf("ids = %v, err = %v", ids, err)
+	}
+	want := []string{
+		`email: "nope" does not match "^[^@]+@[^@]+$"`,
+		"shipped after ordered: shipped on day 3, ordered on day 5",
+		"shipped: value is null",
+	}
+	if !slices.Equal(msgs, want) {
+		t.Fatalf("violations:\ngot  %q\nwant %q", msgs, want)
+	}
+	if r := it.Report(); r.Records != 3 || r.Valid != 1 || r.Warned != 1 || r.Quarantined != 1 {
+		t.Fatalf("report = %+v", r)
+	}
+}
+
+func TestValidate_Errors(t *testing.T) {
+	quarantineErr := errors.New("disk full")
+	recs := decodeCSV(t, "a.csv", "id,status,amount\n1,open,1\n1,open,2\n")
+	it := ValidateRecords(context.Background(), recs, orderRules(), Options[transform.Extractor]{
+		Quarantine: func(transform.Extractor, []Violation) error { return quarantineErr },
+	})
+	for it.Next() {
+	}
+	if err := it.Err(); !errors.Is(err, quarantineErr) || !strings.Contains(err.Error(), "validate: quarantine a.csv@") {
+		t.Fatalf("Err = %v", err)
+	}
+	it.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it = ValidateRecords(ctx, decodeCSV(t, "a.csv", "id\n1\n"), nil, Options[transform.Extractor]{})
+	if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("Err = %v", it.Err())
+	}
+	it.Close()
+
+	// Each stage starts with fresh rule state.
+	rules := []Rule[transform.Extractor]{Unique("id unique", Column("id"))}
+	for range 2 {
+		it := ValidateRecords(context.Background(), decodeCSV(t, "a.csv", "id\n1\n2\n"), rules, Options[transform.Extractor]{})
+		for it.Next() {
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		it.Close()
+	}
+}